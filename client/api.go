@@ -1,112 +1,422 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
-	"strings"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"time"
 )
 
-func registerUser(username string) (*User, error) {
-	url := fmt.Sprintf("%s/api/users/register", serverURL)
+var authToken string
 
-	reqBody := map[string]string{"username": username}
-	jsonData, _ := json.Marshal(reqBody)
+func apiRequest(method, url string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(jsonData)
+	}
 
-	resp, err := http.Post(url, "application/json", strings.NewReader(string(jsonData)))
+	req, err := http.NewRequest(method, url, reqBody)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return doRequest(req, out)
+}
+
+// doRequest sends req with the session token and decodes the data of the API
+// response into out.
+func doRequest(req *http.Request, out interface{}) error {
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 
 	var apiResp APIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-		return nil, err
+		return err
 	}
 
 	if !apiResp.Success {
-		return nil, fmt.Errorf(apiResp.Error)
+		return fmt.Errorf("%s", apiResp.Error)
 	}
 
-	userData, _ := json.Marshal(apiResp.Data)
-	var user User
-	_ = json.Unmarshal(userData, &user)
+	if out != nil {
+		data, _ := json.Marshal(apiResp.Data)
+		_ = json.Unmarshal(data, out)
+	}
 
-	return &user, nil
+	return nil
 }
 
-func getAllRooms() ([]Room, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/api/rooms/all", serverURL))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+func registerUser(username, password string) (*User, error) {
+	return authenticate("register", username, password)
+}
 
-	var apiResp APIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+func loginUser(username, password string) (*User, error) {
+	return authenticate("login", username, password)
+}
+
+func authenticate(action, username, password string) (*User, error) {
+	url := fmt.Sprintf("%s/api/users/%s", serverURL, action)
+
+	reqBody := map[string]string{"username": username, "password": password}
+
+	var auth AuthResponse
+	if err := apiRequest(http.MethodPost, url, reqBody, &auth); err != nil {
 		return nil, err
 	}
 
-	if !apiResp.Success {
-		return nil, fmt.Errorf(apiResp.Error)
-	}
+	authToken = auth.Token
+	return &auth.User, nil
+}
 
-	roomsData, _ := json.Marshal(apiResp.Data)
+func getAllRooms() ([]Room, error) {
 	var rooms []Room
-	_ = json.Unmarshal(roomsData, &rooms)
+	if err := apiRequest(http.MethodGet, fmt.Sprintf("%s/api/rooms/all", serverURL), nil, &rooms); err != nil {
+		return nil, err
+	}
 
 	return rooms, nil
 }
 
-func createRoom(name string) (*Room, error) {
+func getOnlineUsers(roomID string) ([]Presence, error) {
+	var online []Presence
+	if err := apiRequest(http.MethodGet, fmt.Sprintf("%s/api/rooms/online?id=%s", serverURL, roomID), nil, &online); err != nil {
+		return nil, err
+	}
+
+	return online, nil
+}
+
+func createRoom(name string, private bool) (*Room, error) {
 	url := fmt.Sprintf("%s/api/rooms/create", serverURL)
 
-	reqBody := map[string]string{"name": name}
-	jsonData, _ := json.Marshal(reqBody)
+	reqBody := map[string]interface{}{"name": name, "private": private}
 
-	resp, err := http.Post(url, "application/json", strings.NewReader(string(jsonData)))
-	if err != nil {
+	var room Room
+	if err := apiRequest(http.MethodPost, url, reqBody, &room); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var apiResp APIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+	return &room, nil
+}
+
+func getRoom(roomID string) (*Room, error) {
+	url := fmt.Sprintf("%s/api/rooms/get?id=%s", serverURL, roomID)
+
+	var room Room
+	if err := apiRequest(http.MethodGet, url, nil, &room); err != nil {
 		return nil, err
 	}
 
-	if !apiResp.Success {
-		return nil, fmt.Errorf(apiResp.Error)
+	return &room, nil
+}
+
+// openDirectRoom returns the direct room with username, which the server
+// creates on first use.
+func openDirectRoom(username string) (*Room, error) {
+	url := fmt.Sprintf("%s/api/rooms/direct?username=%s", serverURL, neturl.QueryEscape(username))
+
+	var room Room
+	if err := apiRequest(http.MethodPost, url, nil, &room); err != nil {
+		return nil, err
 	}
 
-	roomData, _ := json.Marshal(apiResp.Data)
+	return &room, nil
+}
+
+func inviteUser(roomID, username string) error {
+	url := fmt.Sprintf("%s/api/rooms/invite?id=%s&username=%s", serverURL, roomID, neturl.QueryEscape(username))
+	return apiRequest(http.MethodPost, url, nil, nil)
+}
+
+func getInvitations() ([]Invitation, error) {
+	var invitations []Invitation
+	if err := apiRequest(http.MethodGet, fmt.Sprintf("%s/api/rooms/invitations", serverURL), nil, &invitations); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+func acceptInvitation(roomID string) (*Room, error) {
+	url := fmt.Sprintf("%s/api/rooms/accept?id=%s", serverURL, roomID)
+
 	var room Room
-	_ = json.Unmarshal(roomData, &room)
+	if err := apiRequest(http.MethodPost, url, nil, &room); err != nil {
+		return nil, err
+	}
 
 	return &room, nil
 }
 
-func getMessagesHistory(roomID string, limit, offset int) ([]Message, error) {
-	url := fmt.Sprintf("%s/api/messages/history?room_id=%s&limit=%d&offset=%d", serverURL, roomID, limit, offset)
+// moderateUser applies a moderation action (kick, ban, unban, mute, unmute)
+// to username in the room. duration may be empty for a permanent ban or mute.
+func moderateUser(action, roomID, username, duration string) error {
+	url := fmt.Sprintf("%s/api/rooms/%s?id=%s&username=%s", serverURL, action, roomID, neturl.QueryEscape(username))
+	if duration != "" {
+		url += "&duration=" + neturl.QueryEscape(duration)
+	}
+	return apiRequest(http.MethodPost, url, nil, nil)
+}
+
+func setRole(roomID, username, role string) error {
+	url := fmt.Sprintf("%s/api/rooms/role?id=%s&username=%s&role=%s", serverURL, roomID, neturl.QueryEscape(username), role)
+	return apiRequest(http.MethodPost, url, nil, nil)
+}
+
+// setTopic replaces the topic of the room; an empty topic clears it.
+func setTopic(roomID, topic string) error {
+	url := fmt.Sprintf("%s/api/rooms/topic?id=%s", serverURL, roomID)
+	reqBody := map[string]string{"topic": topic}
+	return apiRequest(http.MethodPost, url, reqBody, nil)
+}
+
+// changePin pins or unpins a message of the room, action being "pin" or
+// "unpin".
+func changePin(action, roomID, messageID string) error {
+	url := fmt.Sprintf("%s/api/rooms/%s?id=%s&message_id=%s", serverURL, action, roomID, messageID)
+	return apiRequest(http.MethodPost, url, nil, nil)
+}
+
+func getPinnedMessages(roomID string) ([]Message, error) {
+	url := fmt.Sprintf("%s/api/rooms/pins?id=%s", serverURL, roomID)
+
+	var messages []Message
+	if err := apiRequest(http.MethodGet, url, nil, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// leaveRoomMembership gives up membership of a room, as opposed to /leave,
+// which only stops following it.
+// markRoomRead moves the read marker of the room to the message with seq, or
+// to the newest message if seq is 0.
+func markRoomRead(roomID string, seq int64) error {
+	url := fmt.Sprintf("%s/api/rooms/read?id=%s", serverURL, roomID)
+	if seq > 0 {
+		url += fmt.Sprintf("&seq=%d", seq)
+	}
+	return apiRequest(http.MethodPost, url, nil, nil)
+}
+
+func leaveRoomMembership(roomID string) error {
+	url := fmt.Sprintf("%s/api/rooms/leave?id=%s", serverURL, roomID)
+	return apiRequest(http.MethodPost, url, nil, nil)
+}
+
+// searchMessages finds messages containing the words of text. roomID,
+// author and since narrow the search when set.
+func searchMessages(text, roomID, author string, since time.Time) ([]SearchHit, error) {
+	query := neturl.Values{}
+	query.Set("q", text)
+	if roomID != "" {
+		query.Set("room_id", roomID)
+	}
+	if author != "" {
+		query.Set("user", author)
+	}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339))
+	}
+
+	var hits []SearchHit
+	if err := apiRequest(http.MethodGet, serverURL+"/api/messages/search?"+query.Encode(), nil, &hits); err != nil {
+		return nil, err
+	}
+
+	return hits, nil
+}
+
+// getNotifications returns up to limit messages mentioning the user that
+// they have not marked seen, oldest first.
+func getNotifications(limit int) ([]Message, error) {
+	url := fmt.Sprintf("%s/api/notifications?limit=%d", serverURL, limit)
+
+	var messages []Message
+	if err := apiRequest(http.MethodGet, url, nil, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func markNotificationsSeen(messageIDs []string) error {
+	reqBody := map[string][]string{"message_ids": messageIDs}
+	return apiRequest(http.MethodPost, serverURL+"/api/notifications/seen", reqBody, nil)
+}
+
+// getMessagesHistory returns the newest limit messages of the room, or those
+// just before the before cursor if it is set.
+func getMessagesHistory(roomID, before string, limit int) (*HistoryPage, error) {
+	url := fmt.Sprintf("%s/api/messages/history?room_id=%s&limit=%d", serverURL, roomID, limit)
+	if before != "" {
+		url += "&before=" + neturl.QueryEscape(before)
+	}
 
-	resp, err := http.Get(url)
+	var page HistoryPage
+	if err := apiRequest(http.MethodGet, url, nil, &page); err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+func sendMessage(roomID, parentID, content string) (*Message, error) {
+	url := fmt.Sprintf("%s/api/messages/send?room_id=%s", serverURL, roomID)
+
+	reqBody := map[string]string{"content": content}
+	if parentID != "" {
+		reqBody["parent_id"] = parentID
+	}
+
+	var message Message
+	if err := apiRequest(http.MethodPost, url, reqBody, &message); err != nil {
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return &message, nil
+}
+
+// uploadFile sends the file at path to the room as a message with caption as
+// its text.
+func uploadFile(roomID, path, caption string) (*Message, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if caption != "" {
+		if err := form.WriteField("content", caption); err != nil {
+			return nil, err
+		}
+	}
+	part, err := form.CreateFormFile("file", filepath.Base(path))
 	if err != nil {
 		return nil, err
 	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/messages/upload?room_id=%s", serverURL, roomID), &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	var message Message
+	if err := doRequest(req, &message); err != nil {
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return &message, nil
+}
+
+// downloadAttachment copies the content of an attachment to w.
+func downloadAttachment(attachmentID string, w io.Writer) error {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/messages/attachment?id=%s", serverURL, attachmentID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+authToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
 	defer resp.Body.Close()
 
-	var apiResp APIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+	// Errors come back as the usual JSON response instead of the file.
+	if resp.StatusCode != http.StatusOK {
+		var apiResp APIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+			return fmt.Errorf("download failed: %s", resp.Status)
+		}
+		return fmt.Errorf("%s", apiResp.Error)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func getThread(messageID string, limit, offset int) (*ThreadResponse, error) {
+	url := fmt.Sprintf("%s/api/messages/thread?id=%s&limit=%d&offset=%d", serverURL, messageID, limit, offset)
+
+	var thread ThreadResponse
+	if err := apiRequest(http.MethodGet, url, nil, &thread); err != nil {
 		return nil, err
 	}
 
-	if !apiResp.Success {
-		return nil, fmt.Errorf(apiResp.Error)
+	return &thread, nil
+}
+
+func addReaction(messageID, emoji string) (*Message, error) {
+	return changeReaction("add", messageID, emoji)
+}
+
+func removeReaction(messageID, emoji string) (*Message, error) {
+	return changeReaction("remove", messageID, emoji)
+}
+
+func changeReaction(action, messageID, emoji string) (*Message, error) {
+	url := fmt.Sprintf("%s/api/messages/reactions/%s?id=%s", serverURL, action, messageID)
+
+	reqBody := map[string]string{"emoji": emoji}
+
+	var message Message
+	if err := apiRequest(http.MethodPost, url, reqBody, &message); err != nil {
+		return nil, fmt.Errorf("failed to %s reaction: %w", action, err)
 	}
 
-	messagesData, _ := json.Marshal(apiResp.Data)
-	var messages []Message
-	_ = json.Unmarshal(messagesData, &messages)
+	return &message, nil
+}
 
-	return messages, nil
+func editMessage(messageID, content string) (*Message, error) {
+	url := fmt.Sprintf("%s/api/messages/edit?id=%s", serverURL, messageID)
+
+	reqBody := map[string]string{"content": content}
+
+	var message Message
+	if err := apiRequest(http.MethodPost, url, reqBody, &message); err != nil {
+		return nil, fmt.Errorf("failed to edit message: %w", err)
+	}
+
+	return &message, nil
+}
+
+func deleteMessage(messageID string) error {
+	url := fmt.Sprintf("%s/api/messages/delete?id=%s", serverURL, messageID)
+
+	if err := apiRequest(http.MethodPost, url, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+
+	return nil
 }
@@ -1,14 +1,16 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
-func (c *ChatClient) handleCommand(cmd string, reader *bufio.Reader) error {
+func (c *ChatClient) handleCommand(cmd string) error {
 	parts := strings.Fields(cmd)
 	if len(parts) == 0 {
 		return nil
@@ -20,16 +22,40 @@ func (c *ChatClient) handleCommand(cmd string, reader *bufio.Reader) error {
 		return nil
 
 	case "/create":
+		private := len(parts) > 1 && parts[1] == "--private"
+		if private {
+			parts = parts[1:]
+		}
 		if len(parts) < 2 {
-			fmt.Println("Usage: /create <room_name>")
+			fmt.Fprintln(out, "Usage: /create [--private] <room_name>")
 			return nil
 		}
 		roomName := strings.Join(parts[1:], " ")
-		return c.createNewRoom(roomName)
+		return c.createNewRoom(roomName, private)
+
+	case "/invite":
+		if len(parts) < 2 {
+			fmt.Fprintln(out, "Usage: /invite <username>")
+			return nil
+		}
+		return c.invite(parts[1])
+
+	case "/invites":
+		return c.showInvitations()
+
+	case "/accept":
+		if len(parts) < 2 {
+			fmt.Fprintln(out, "Usage: /accept <invitation_number>")
+			return nil
+		}
+		return c.accept(parts[1])
+
+	case "/forget":
+		return c.forgetRoom()
 
 	case "/join":
 		if len(parts) < 2 {
-			fmt.Println("Usage: /join <room_number>")
+			fmt.Fprintln(out, "Usage: /join <room_number>")
 			c.showRooms()
 			return nil
 		}
@@ -42,7 +68,148 @@ func (c *ChatClient) handleCommand(cmd string, reader *bufio.Reader) error {
 	case "/leave":
 		return c.leaveRoom()
 
+	case "/msg":
+		if len(parts) < 2 {
+			fmt.Fprintln(out, "Usage: /msg <username> [text]")
+			return nil
+		}
+		content := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(cmd, parts[0])), parts[1]))
+		return c.messageUser(parts[1], content)
+
+	case "/reply":
+		if len(parts) < 3 {
+			fmt.Fprintln(out, "Usage: /reply <message_number> <text>")
+			return nil
+		}
+		msg, err := c.listedMessage(parts[1])
+		if err != nil {
+			return err
+		}
+		content := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(cmd, parts[0])), parts[1]))
+		return c.replyTo(msg, content)
+
+	case "/thread":
+		if len(parts) < 2 {
+			fmt.Fprintln(out, "Usage: /thread <message_number>")
+			return nil
+		}
+		msg, err := c.listedMessage(parts[1])
+		if err != nil {
+			return err
+		}
+		return c.showThread(msg)
+
+	case "/react", "/unreact":
+		if len(parts) < 3 {
+			fmt.Fprintf(out, "Usage: %s <message_number> <emoji>\n", parts[0])
+			return nil
+		}
+		msg, err := c.listedMessage(parts[1])
+		if err != nil {
+			return err
+		}
+		return c.react(msg, parts[2], parts[0] == "/react")
+
+	case "/edit":
+		if len(parts) < 2 {
+			fmt.Fprintln(out, "Usage: /edit <new text>")
+			return nil
+		}
+		content := strings.TrimSpace(strings.TrimPrefix(cmd, parts[0]))
+		return c.editLastMessage(content)
+
+	case "/delete":
+		if len(parts) >= 2 {
+			msg, err := c.listedMessage(parts[1])
+			if err != nil {
+				return err
+			}
+			return c.deleteListedMessage(msg)
+		}
+		return c.deleteLastMessage()
+
+	case "/kick", "/ban", "/unban", "/mute", "/unmute":
+		if len(parts) < 2 {
+			fmt.Fprintf(out, "Usage: %s <username>\n", parts[0])
+			return nil
+		}
+		duration := ""
+		if len(parts) >= 3 && (parts[0] == "/ban" || parts[0] == "/mute") {
+			duration = parts[2]
+		}
+		return c.moderate(strings.TrimPrefix(parts[0], "/"), parts[1], duration)
+
+	case "/mod", "/unmod":
+		if len(parts) < 2 {
+			fmt.Fprintf(out, "Usage: %s <username>\n", parts[0])
+			return nil
+		}
+		role := "moderator"
+		if parts[0] == "/unmod" {
+			role = "member"
+		}
+		return c.changeRole(parts[1], role)
+
+	case "/who":
+		return c.showOnlineUsers()
+
+	case "/search":
+		if len(parts) < 2 {
+			fmt.Fprintln(out, "Usage: /search [in:here] [from:<user>] [since:<duration>] <words>")
+			return nil
+		}
+		return c.search(parts[1:])
+
+	case "/upload":
+		if len(parts) < 2 {
+			fmt.Fprintln(out, "Usage: /upload <path> [caption]")
+			return nil
+		}
+		caption := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(cmd, parts[0])), parts[1]))
+		return c.upload(parts[1], caption)
+
+	case "/download":
+		if len(parts) < 2 {
+			fmt.Fprintln(out, "Usage: /download <message_number>")
+			return nil
+		}
+		msg, err := c.listedMessage(parts[1])
+		if err != nil {
+			return err
+		}
+		return c.download(msg)
+
+	case "/topic":
+		topic := strings.TrimSpace(strings.TrimPrefix(cmd, parts[0]))
+		return c.changeTopic(topic)
+
+	case "/pins":
+		return c.showPins()
+
+	case "/pin", "/unpin":
+		if len(parts) < 2 {
+			fmt.Fprintf(out, "Usage: %s <message_number>\n", parts[0])
+			return nil
+		}
+		msg, err := c.listedMessage(parts[1])
+		if err != nil {
+			return err
+		}
+		return c.pin(msg, parts[0] == "/pin")
+
+	case "/mentions":
+		return c.showMentions()
+
+	case "/away", "/back":
+		return c.setAway(parts[0] == "/away")
+
+	case "/reconnect":
+		return c.reconnectRoom()
+
 	case "/history":
+		if len(parts) >= 2 && parts[1] == "more" {
+			return c.showOlderHistory()
+		}
 		limit := 10
 		if len(parts) >= 2 {
 			if parsedLimit, err := fmt.Sscanf(parts[1], "%d", &limit); err != nil || parsedLimit == 0 {
@@ -52,7 +219,7 @@ func (c *ChatClient) handleCommand(cmd string, reader *bufio.Reader) error {
 		return c.showHistory(limit)
 
 	case "/exit":
-		os.Exit(0)
+		c.exit()
 		return nil
 
 	case "/help":
@@ -60,40 +227,86 @@ func (c *ChatClient) handleCommand(cmd string, reader *bufio.Reader) error {
 		return nil
 
 	default:
-		fmt.Printf("Unknown command: %s\n", parts[0])
-		fmt.Println("Type '/help' to see available commands")
+		fmt.Fprintf(out, "Unknown command: %s\n", parts[0])
+		fmt.Fprintln(out, "Type '/help' to see available commands")
 		return nil
 	}
 }
 
 func (c *ChatClient) showRooms() {
 	if err := c.refreshRooms(); err != nil {
-		fmt.Printf("Failed to refresh rooms: %v\n", err)
+		fmt.Fprintf(out, "Failed to refresh rooms: %v\n", err)
 		return
 	}
 
-	if len(c.rooms) == 0 {
-		fmt.Println("No rooms available. Use '/create <name>' to create one.")
+	direct := c.directRooms()
+	if len(c.rooms) == 0 && len(direct) == 0 {
+		fmt.Fprintln(out, "No rooms available. Use '/create <name>' to create one.")
 		return
 	}
 
-	fmt.Println("\nAvailable rooms:")
+	if len(c.rooms) > 0 {
+		fmt.Fprintln(out, "\nAvailable rooms:")
+	}
 	for i, room := range c.rooms {
-		current := ""
-		if room.ID == c.roomID {
-			current = " (current)"
+		status := ""
+		switch {
+		case room.ID == c.roomID:
+			status = " (current)"
+		case c.isJoined(room.ID):
+			if unread := c.unreadCount(room.ID); unread > 0 {
+				status = fmt.Sprintf(" (joined, %d unread)", unread)
+			} else {
+				status = " (joined)"
+			}
+		case room.UnreadCount > 0:
+			status = fmt.Sprintf(" (%d unread)", room.UnreadCount)
 		}
-		fmt.Printf("  %d. %s%s\n", i+1, room.Name, current)
+		if room.Type == roomTypePrivate {
+			status = " (private)" + status
+		}
+		fmt.Fprintf(out, "  %d. %s%s\n", i+1, room.Name, status)
+	}
+
+	if len(direct) > 0 {
+		fmt.Fprintln(out, "\nDirect messages:")
+		for _, line := range direct {
+			fmt.Fprintf(out, "  %s\n", line)
+		}
+	}
+	fmt.Fprintln(out)
+}
+
+// directRooms describes the direct conversations of this session, sorted by
+// name.
+func (c *ChatClient) directRooms() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lines := make([]string, 0)
+	for roomID, state := range c.joined {
+		if !state.direct {
+			continue
+		}
+		line := state.name
+		switch {
+		case roomID == c.roomID:
+			line += " (current)"
+		case state.unread > 0:
+			line += fmt.Sprintf(" (%d unread)", state.unread)
+		}
+		lines = append(lines, line)
 	}
-	fmt.Println()
+	sort.Strings(lines)
+	return lines
 }
 
-func (c *ChatClient) createNewRoom(roomName string) error {
+func (c *ChatClient) createNewRoom(roomName string, private bool) error {
 	if roomName == "" {
 		return fmt.Errorf("room name cannot be empty")
 	}
 
-	newRoom, err := createRoom(roomName)
+	newRoom, err := createRoom(roomName, private)
 	if err != nil {
 		return fmt.Errorf("failed to create room: %w", err)
 	}
@@ -102,7 +315,7 @@ func (c *ChatClient) createNewRoom(roomName string) error {
 		log.Printf("Failed to refresh rooms: %v", err)
 	}
 
-	fmt.Printf("Room '%s' created successfully! Use '/join %d' to join it.\n", newRoom.Name, len(c.rooms))
+	fmt.Fprintf(out, "Room '%s' created successfully! Use '/join %d' to join it.\n", newRoom.Name, len(c.rooms))
 	return nil
 }
 
@@ -115,79 +328,721 @@ func (c *ChatClient) joinRoom(roomIndex int) error {
 		return fmt.Errorf("invalid room number. Use '/rooms' to see available rooms")
 	}
 
-	newRoom := &c.rooms[roomIndex-1]
+	return c.enterRoom(&c.rooms[roomIndex-1])
+}
+
+// messageUser sends content to username in a direct conversation, or makes
+// the conversation the active room if content is empty.
+func (c *ChatClient) messageUser(username, content string) error {
+	room, err := openDirectRoom(username)
+	if err != nil {
+		return fmt.Errorf("failed to open conversation with %s: %w", username, err)
+	}
+
+	if content == "" {
+		return c.enterRoom(room)
+	}
+
+	if err := c.subscribe(room); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to connect to WebSocket: %v\n", err)
+	}
+
+	if err := c.sendMessage(room.ID, "", content); err != nil {
+		return err
+	}
+
+	if !c.isConnected() {
+		fmt.Fprintf(out, "[%s -> @%s]: %s\n", c.username, username, content)
+	}
+	return nil
+}
+
+// enterRoom makes the room the active one, subscribing to it first if it is
+// not joined yet, and shows its recent messages.
+func (c *ChatClient) enterRoom(newRoom *Room) error {
 	if newRoom.ID == c.roomID {
-		fmt.Println("You are already in this room.")
+		fmt.Fprintln(out, "You are already in this room.")
 		return nil
 	}
 
-	if c.conn != nil {
-		c.disconnect()
+	// Rooms joined earlier stay subscribed in the background; switching to
+	// one of them only changes which room is shown.
+	rejoin := c.isJoined(newRoom.ID)
+	if !rejoin {
+		if err := c.subscribe(newRoom); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to connect to WebSocket: %v\n", err)
+			fmt.Fprintln(out, "You can still send messages, but won't receive real-time updates.")
+		}
 	}
 
-	c.roomID = newRoom.ID
-	c.roomName = newRoom.Name
+	c.markActiveRoomRead()
+	name := c.roomLabel(newRoom)
+	c.setActiveRoom(newRoom.ID, name)
 
-	if err := c.connect(); err != nil {
-		fmt.Printf("Warning: Failed to connect to WebSocket: %v\n", err)
-		fmt.Println("You can still send messages, but won't receive real-time updates.")
+	if rejoin {
+		fmt.Fprintf(out, "Switched to room: %s\n", name)
 	} else {
-		go c.readMessages()
+		fmt.Fprintf(out, "Joined room: %s\n", name)
 	}
 
-	fmt.Printf("Joined room: %s\n", newRoom.Name)
+	if newRoom.Topic != "" {
+		fmt.Fprintf(out, "Topic: %s\n", newRoom.Topic)
+	}
+	c.showPinnedSummary(newRoom)
 
-	messages, err := getMessagesHistory(newRoom.ID, 10, 0)
-	if err == nil && len(messages) > 0 {
-		fmt.Println("\n--- Recent Messages ---")
-		for _, msg := range messages {
-			fmt.Printf("[%s]: %s\n", msg.Username, msg.Content)
-		}
-		fmt.Println("--- End History ---")
+	page, err := getMessagesHistory(newRoom.ID, "", 10)
+	if err == nil && len(page.Messages) > 0 {
+		fmt.Fprintln(out, "\n--- Recent Messages ---")
+		c.printListing(page.Messages)
+		fmt.Fprintln(out, "--- End History ---")
+		c.setOlderCursor(newRoom.ID, page.PrevCursor)
+		c.observeSeq(newRoom.ID, page.Messages[len(page.Messages)-1].Seq)
+	}
+
+	if err := markRoomRead(newRoom.ID, 0); err != nil {
+		log.Printf("Failed to mark room as read: %v", err)
 	}
 
 	return nil
 }
 
+// markActiveRoomRead records on the server that the messages received live
+// in the active room were read, before the user switches away from it.
+func (c *ChatClient) markActiveRoomRead() {
+	c.mu.Lock()
+	roomID := c.roomID
+	var seq int64
+	if state, ok := c.joined[roomID]; ok {
+		seq = state.lastSeq
+	}
+	c.mu.Unlock()
+
+	// Without messages there is nothing past what /join marked.
+	if seq == 0 {
+		return
+	}
+	if err := markRoomRead(roomID, seq); err != nil {
+		log.Printf("Failed to mark room as read: %v", err)
+	}
+}
+
+func (c *ChatClient) reconnectRoom() error {
+	if c.isConnected() {
+		fmt.Fprintln(out, "Already connected.")
+		return nil
+	}
+
+	if err := c.connect(); err != nil {
+		return fmt.Errorf("failed to reconnect: %w", err)
+	}
+
+	fmt.Fprintln(out, "Connected. Missed messages will be delivered now.")
+	return nil
+}
+
 func (c *ChatClient) leaveRoom() error {
 	if c.roomID == "" {
-		fmt.Println("You are not in any room.")
+		fmt.Fprintln(out, "You are not in any room.")
 		return nil
 	}
 
-	fmt.Printf("Leaving room: %s\n", c.roomName)
+	fmt.Fprintf(out, "Leaving room: %s\n", c.roomName)
+
+	c.markActiveRoomRead()
+	c.unsubscribe(c.roomID)
+	c.setActiveRoom("", "")
 
-	if c.conn != nil {
-		c.disconnect()
+	fmt.Fprintln(out, "Left the room. Use '/join <number>' to join another room.")
+	return nil
+}
+
+func (c *ChatClient) invite(username string) error {
+	if c.roomID == "" {
+		fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+		return nil
+	}
+
+	if err := inviteUser(c.roomID, username); err != nil {
+		return fmt.Errorf("failed to invite %s: %w", username, err)
+	}
+
+	fmt.Fprintf(out, "Invited %s to %s.\n", username, c.roomName)
+	return nil
+}
+
+func (c *ChatClient) showInvitations() error {
+	invitations, err := getInvitations()
+	if err != nil {
+		return fmt.Errorf("failed to get invitations: %w", err)
+	}
+	c.invites = invitations
+
+	if len(invitations) == 0 {
+		fmt.Fprintln(out, "You have no pending invitations.")
+		return nil
 	}
 
-	c.roomID = ""
-	c.roomName = ""
-	fmt.Println("Left the room. Use '/join <number>' to join another room.")
+	fmt.Fprintln(out, "\nInvitations:")
+	for i, invitation := range invitations {
+		fmt.Fprintf(out, "  %d. %s (from %s)\n", i+1, invitation.RoomName, invitation.InviterName)
+	}
+	fmt.Fprintln(out, "Use '/accept <number>' to join.")
+	return nil
+}
+
+func (c *ChatClient) accept(arg string) error {
+	var n int
+	if _, err := fmt.Sscanf(arg, "%d", &n); err != nil || n < 1 || n > len(c.invites) {
+		return fmt.Errorf("invalid invitation number. Use '/invites' to list invitations")
+	}
+
+	room, err := acceptInvitation(c.invites[n-1].RoomID)
+	if err != nil {
+		return fmt.Errorf("failed to accept invitation: %w", err)
+	}
+	c.invites = append(c.invites[:n-1:n-1], c.invites[n:]...)
+
+	return c.enterRoom(room)
+}
+
+// forgetRoom leaves the current room for good: unlike /leave, it gives up
+// membership, so a private room needs a new invitation to come back.
+func (c *ChatClient) forgetRoom() error {
+	if c.roomID == "" {
+		fmt.Fprintln(out, "You are not in any room.")
+		return nil
+	}
+
+	if err := leaveRoomMembership(c.roomID); err != nil {
+		return fmt.Errorf("failed to leave room: %w", err)
+	}
+
+	fmt.Fprintf(out, "You are no longer a member of %s.\n", c.roomName)
+	c.unsubscribe(c.roomID)
+	c.setActiveRoom("", "")
 	return nil
 }
 
 func (c *ChatClient) showHistory(limit int) error {
 	if c.roomID == "" {
-		fmt.Println("You are not in any room. Use '/join <number>' to join a room first.")
+		fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+		return nil
+	}
+
+	page, err := getMessagesHistory(c.roomID, "", limit)
+	if err != nil {
+		return fmt.Errorf("failed to get history: %w", err)
+	}
+
+	if len(page.Messages) == 0 {
+		fmt.Fprintln(out, "No messages in this room.")
+		return nil
+	}
+
+	fmt.Fprintf(out, "\n--- Message History (last %d) ---\n", len(page.Messages))
+	c.printListing(page.Messages)
+	fmt.Fprintln(out, "--- End History ---")
+	c.setOlderCursor(c.roomID, page.PrevCursor)
+	return nil
+}
+
+// showOlderHistory prints the page of history before the oldest one printed
+// so far, so that repeated /history more walks back through the room.
+func (c *ChatClient) showOlderHistory() error {
+	if c.roomID == "" {
+		fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+		return nil
+	}
+
+	cursor := c.olderCursor(c.roomID)
+	if cursor == "" {
+		fmt.Fprintln(out, "No older messages.")
 		return nil
 	}
 
-	messages, err := getMessagesHistory(c.roomID, limit, 0)
+	page, err := getMessagesHistory(c.roomID, cursor, 10)
 	if err != nil {
 		return fmt.Errorf("failed to get history: %w", err)
 	}
 
+	fmt.Fprintln(out, "\n--- Older Messages ---")
+	c.printListing(page.Messages)
+	fmt.Fprintln(out, "--- End History ---")
+	c.setOlderCursor(c.roomID, page.PrevCursor)
+	return nil
+}
+
+// printListing prints messages numbered from 1 and remembers them for
+// /reply and /thread.
+func (c *ChatClient) printListing(messages []Message) {
+	c.mu.Lock()
+	c.listed = messages
+	c.mu.Unlock()
+
+	for i := range messages {
+		fmt.Fprintf(out, "%3d. %s\n", i+1, c.showMessage(&messages[i]))
+	}
+}
+
+func (c *ChatClient) listedMessage(arg string) (*Message, error) {
+	var n int
+	if _, err := fmt.Sscanf(arg, "%d", &n); err != nil || n < 1 || n > len(c.listed) {
+		return nil, fmt.Errorf("invalid message number. Use '/history' to list messages")
+	}
+
+	msg := &c.listed[n-1]
+	if msg.RoomID != c.roomID {
+		return nil, fmt.Errorf("message %d is not in the current room. Use '/history' to list messages", n)
+	}
+	return msg, nil
+}
+
+func (c *ChatClient) replyTo(parent *Message, content string) error {
+	if content == "" {
+		return fmt.Errorf("reply cannot be empty")
+	}
+
+	if err := c.sendMessage(c.roomID, parent.ID, content); err != nil {
+		return err
+	}
+
+	if !c.isConnected() {
+		fmt.Fprintf(out, "↳ [%s]: %s\n", c.username, content)
+	}
+	return nil
+}
+
+func (c *ChatClient) react(msg *Message, emoji string, add bool) error {
+	var (
+		updated *Message
+		err     error
+	)
+	if add {
+		updated, err = addReaction(msg.ID, emoji)
+	} else {
+		updated, err = removeReaction(msg.ID, emoji)
+	}
+	if err != nil {
+		return err
+	}
+
+	msg.Reactions = updated.Reactions
+	fmt.Fprintln(out, formatMessage(msg))
+	return nil
+}
+
+func (c *ChatClient) showThread(msg *Message) error {
+	const limit = 50
+
+	thread, err := getThread(msg.ID, limit, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get thread: %w", err)
+	}
+
+	fmt.Fprintln(out, "\n--- Thread ---")
+	messages := append([]Message{thread.Parent}, thread.Replies...)
+	c.printListing(messages)
+	if thread.Parent.ReplyCount > len(thread.Replies) {
+		fmt.Fprintf(out, "(showing %d of %d replies)\n", len(thread.Replies), thread.Parent.ReplyCount)
+	}
+	fmt.Fprintln(out, "--- End Thread ---")
+	return nil
+}
+
+func (c *ChatClient) editLastMessage(content string) error {
+	if c.roomID == "" {
+		fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+		return nil
+	}
+
+	messageID := c.lastSent(c.roomID)
+	if messageID == "" {
+		fmt.Fprintln(out, "You have not sent a message in this room yet.")
+		return nil
+	}
+
+	msg, err := editMessage(messageID, content)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, formatMessage(msg))
+	return nil
+}
+
+func (c *ChatClient) deleteLastMessage() error {
+	if c.roomID == "" {
+		fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+		return nil
+	}
+
+	messageID := c.lastSent(c.roomID)
+	if messageID == "" {
+		fmt.Fprintln(out, "You have not sent a message in this room yet.")
+		return nil
+	}
+
+	if err := deleteMessage(messageID); err != nil {
+		return err
+	}
+
+	c.clearLastSent(c.roomID, messageID)
+	fmt.Fprintln(out, "Message deleted.")
+	return nil
+}
+
+func (c *ChatClient) deleteListedMessage(msg *Message) error {
+	if err := deleteMessage(msg.ID); err != nil {
+		return err
+	}
+
+	c.clearLastSent(msg.RoomID, msg.ID)
+	fmt.Fprintln(out, "Message deleted.")
+	return nil
+}
+
+func (c *ChatClient) upload(path, caption string) error {
+	if c.roomID == "" {
+		fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+		return nil
+	}
+
+	msg, err := uploadFile(c.roomID, path, caption)
+	if err != nil {
+		return err
+	}
+
+	c.setLastSent(msg)
+	for _, attachment := range msg.Attachments {
+		fmt.Fprintf(out, "Sent %s (%s).\n", attachment.Filename, formatSize(attachment.Size))
+	}
+	return nil
+}
+
+// download saves the attachments of msg in the current directory, keeping
+// their names but never overwriting a file.
+func (c *ChatClient) download(msg *Message) error {
+	if len(msg.Attachments) == 0 {
+		fmt.Fprintln(out, "That message has no attachments.")
+		return nil
+	}
+
+	for _, attachment := range msg.Attachments {
+		name := filepath.Base(attachment.Filename)
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to save %s: %w", name, err)
+		}
+
+		err = downloadAttachment(attachment.ID, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(name)
+			return fmt.Errorf("failed to download %s: %w", name, err)
+		}
+
+		fmt.Fprintf(out, "Saved %s (%s).\n", name, formatSize(attachment.Size))
+	}
+	return nil
+}
+
+func (c *ChatClient) moderate(action, username, duration string) error {
+	if c.roomID == "" {
+		fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+		return nil
+	}
+
+	if err := moderateUser(action, c.roomID, username, duration); err != nil {
+		return fmt.Errorf("failed to %s %s: %w", action, username, err)
+	}
+	// The room hears about it, including us, through a moderation frame.
+	return nil
+}
+
+func (c *ChatClient) changeRole(username, role string) error {
+	if c.roomID == "" {
+		fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+		return nil
+	}
+
+	if err := setRole(c.roomID, username, role); err != nil {
+		return fmt.Errorf("failed to change the role of %s: %w", username, err)
+	}
+	return nil
+}
+
+// search lists the messages matching the words among args, which may also
+// hold filters: in:here for the current room, from:<user> and
+// since:<duration>, e.g. since:24h. The hits become the numbered listing, so
+// /reply, /react and /thread work on those from the current room.
+func (c *ChatClient) search(args []string) error {
+	var (
+		roomID, author string
+		since          time.Time
+		words          []string
+	)
+	for _, arg := range args {
+		switch {
+		case arg == "in:here":
+			if c.roomID == "" {
+				fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+				return nil
+			}
+			roomID = c.roomID
+		case strings.HasPrefix(arg, "from:"):
+			author = strings.TrimPrefix(arg, "from:")
+		case strings.HasPrefix(arg, "since:"):
+			duration, err := time.ParseDuration(strings.TrimPrefix(arg, "since:"))
+			if err != nil || duration <= 0 {
+				fmt.Fprintln(out, "Invalid duration. Use something like since:30m or since:48h")
+				return nil
+			}
+			since = time.Now().Add(-duration)
+		default:
+			words = append(words, arg)
+		}
+	}
+	if len(words) == 0 {
+		fmt.Fprintln(out, "Usage: /search [in:here] [from:<user>] [since:<duration>] <words>")
+		return nil
+	}
+
+	text := strings.Join(words, " ")
+	hits, err := searchMessages(text, roomID, author, since)
+	if err != nil {
+		return fmt.Errorf("failed to search: %w", err)
+	}
+
+	if len(hits) == 0 {
+		fmt.Fprintf(out, "No messages found for %q.\n", text)
+		return nil
+	}
+
+	messages := make([]Message, len(hits))
+	for i, hit := range hits {
+		messages[i] = hit.Message
+	}
+	c.mu.Lock()
+	c.listed = messages
+	c.mu.Unlock()
+
+	fmt.Fprintf(out, "\n--- Search: %s ---\n", text)
+	for i, hit := range hits {
+		fmt.Fprintf(out, "%3d. %s [%s]: %s\n", i+1, c.describeRoom(hit.Message.RoomID), hit.Message.Username, c.highlight(hit.Snippet))
+	}
+	fmt.Fprintln(out, "--- End Search ---")
+	return nil
+}
+
+// showPinnedSummary prints the first few pinned messages of a room being
+// entered.
+func (c *ChatClient) showPinnedSummary(room *Room) {
+	const shown = 3
+
+	if len(room.PinnedMessageIDs) == 0 {
+		return
+	}
+
+	pinned, err := getPinnedMessages(room.ID)
+	if err != nil {
+		log.Printf("Failed to get pinned messages: %v", err)
+		return
+	}
+
+	for i := range pinned {
+		if i == shown {
+			fmt.Fprintf(out, "📌 (%d more, use '/pins' to see all)\n", len(pinned)-shown)
+			break
+		}
+		fmt.Fprintf(out, "📌 %s\n", formatMessage(&pinned[i]))
+	}
+}
+
+// showPins lists the pinned messages of the current room, numbered for
+// /reply, /unpin and the other commands that take a message number.
+func (c *ChatClient) showPins() error {
+	if c.roomID == "" {
+		fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+		return nil
+	}
+
+	pinned, err := getPinnedMessages(c.roomID)
+	if err != nil {
+		return fmt.Errorf("failed to get pinned messages: %w", err)
+	}
+
+	if len(pinned) == 0 {
+		fmt.Fprintln(out, "No pinned messages in this room.")
+		return nil
+	}
+
+	fmt.Fprintln(out, "\n--- Pinned Messages ---")
+	c.printListing(pinned)
+	fmt.Fprintln(out, "--- End Pinned ---")
+	return nil
+}
+
+// changeTopic shows the topic of the current room, or sets it to topic;
+// "-" clears it.
+func (c *ChatClient) changeTopic(topic string) error {
+	if c.roomID == "" {
+		fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+		return nil
+	}
+
+	if topic == "" {
+		room, err := getRoom(c.roomID)
+		if err != nil {
+			return fmt.Errorf("failed to get room: %w", err)
+		}
+		if room.Topic == "" {
+			fmt.Fprintln(out, "This room has no topic. Use '/topic <text>' to set one.")
+		} else {
+			fmt.Fprintf(out, "Topic: %s\n", room.Topic)
+		}
+		return nil
+	}
+
+	if topic == "-" {
+		topic = ""
+	}
+	if err := setTopic(c.roomID, topic); err != nil {
+		return fmt.Errorf("failed to set the topic: %w", err)
+	}
+	// The room hears about it, including us, through a room.updated frame.
+	return nil
+}
+
+func (c *ChatClient) pin(msg *Message, pin bool) error {
+	action := "unpin"
+	if pin {
+		action = "pin"
+	}
+
+	if err := changePin(action, c.roomID, msg.ID); err != nil {
+		return fmt.Errorf("failed to %s the message: %w", action, err)
+	}
+	return nil
+}
+
+// showMentions lists the messages mentioning the user that they have not
+// seen yet, from every room, and marks them seen.
+func (c *ChatClient) showMentions() error {
+	messages, err := getNotifications(50)
+	if err != nil {
+		return fmt.Errorf("failed to get mentions: %w", err)
+	}
+
 	if len(messages) == 0 {
-		fmt.Println("No messages in this room.")
+		fmt.Fprintln(out, "No new mentions.")
+		return nil
+	}
+
+	c.mu.Lock()
+	c.listed = messages
+	c.mu.Unlock()
+
+	ids := make([]string, len(messages))
+	fmt.Fprintln(out, "\n--- Mentions ---")
+	for i := range messages {
+		ids[i] = messages[i].ID
+		fmt.Fprintf(out, "%3d. %s %s\n", i+1, c.describeRoom(messages[i].RoomID), formatMessage(&messages[i]))
+	}
+	fmt.Fprintln(out, "--- End Mentions ---")
+
+	return markNotificationsSeen(ids)
+}
+
+// describeRoom names a room for listings that span several rooms.
+func (c *ChatClient) describeRoom(roomID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.joined[roomID]; ok {
+		if state.direct {
+			return state.name
+		}
+		return "#" + state.name
+	}
+	for _, room := range c.rooms {
+		if room.ID == roomID {
+			return "#" + room.Name
+		}
+	}
+	return "(direct message)"
+}
+
+// highlight shows the words a snippet marks with "**" in bold on a terminal
+// and leaves the markers otherwise.
+func (c *ChatClient) highlight(snippet string) string {
+	if c.console == nil {
+		return snippet
+	}
+
+	parts := strings.Split(snippet, "**")
+	var b strings.Builder
+	for i, part := range parts {
+		if i%2 == 1 && i < len(parts)-1 {
+			b.WriteString("\x1b[1m" + part + "\x1b[0m")
+		} else if i%2 == 1 {
+			b.WriteString("**" + part)
+		} else {
+			b.WriteString(part)
+		}
+	}
+	return b.String()
+}
+
+func (c *ChatClient) showOnlineUsers() error {
+	if c.roomID == "" {
+		fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
+		return nil
+	}
+
+	online, err := getOnlineUsers(c.roomID)
+	if err != nil {
+		return fmt.Errorf("failed to get online users: %w", err)
+	}
+
+	if len(online) == 0 {
+		fmt.Fprintln(out, "Nobody is online in this room.")
 		return nil
 	}
 
-	fmt.Printf("\n--- Message History (last %d) ---\n", len(messages))
-	for _, msg := range messages {
-		fmt.Printf("[%s]: %s\n", msg.Username, msg.Content)
+	fmt.Fprintf(out, "\nOnline in %s:\n", c.roomName)
+	for _, presence := range online {
+		name := presence.Username
+		if presence.UserID == c.userID {
+			name += " (you)"
+		}
+		if presence.Status == presenceAway {
+			name += " - away"
+		}
+		fmt.Fprintf(out, "  %s\n", name)
+	}
+	return nil
+}
+
+// setAway marks the user away on every room they follow, or back again.
+func (c *ChatClient) setAway(away bool) error {
+	c.mu.Lock()
+	c.away = away
+	connected := c.conn != nil
+	c.mu.Unlock()
+
+	status := presenceOnline
+	if away {
+		status = presenceAway
 	}
-	fmt.Println("--- End History ---")
+	if connected {
+		if err := c.writeFrame(framePresence, c.nextFrameID(), StatusPayload{Status: status}); err != nil {
+			return fmt.Errorf("failed to update status: %w", err)
+		}
+	}
+
+	fmt.Fprintf(out, "You are now %s.\n", status)
 	return nil
 }
 
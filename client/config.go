@@ -2,20 +2,33 @@ package main
 
 import (
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 var (
-	serverURL string
-	wsURL     string
+	serverURL            string
+	wsURL                string
+	maxReconnectAttempts int
 )
 
 func init() {
 	_ = godotenv.Load()
 	serverURL = getServerURL()
 	wsURL = getWebSocketURL()
+	maxReconnectAttempts = getMaxReconnectAttempts()
+}
+
+func getMaxReconnectAttempts() int {
+	const defaultAttempts = 8
+
+	attempts, err := strconv.Atoi(os.Getenv("RECONNECT_MAX_ATTEMPTS"))
+	if err != nil || attempts <= 0 {
+		return defaultAttempts
+	}
+	return attempts
 }
 
 func getServerURL() string {
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"os"
+	"unicode"
+
+	"golang.org/x/term"
+)
+
+// out is where the client prints. Once the console is started it is the
+// console's line editor, which redraws the prompt and the line being typed
+// around whatever arrives from the server.
+var out io.Writer = os.Stdout
+
+// console reads commands from an interactive terminal in raw mode, so that
+// the client sees every keystroke rather than only finished lines.
+type console struct {
+	fd       int
+	state    *term.State
+	terminal *term.Terminal
+}
+
+// startConsole switches stdin to raw mode and routes output through a line
+// editor. onKey is called with the line typed so far and each printable key
+// added to it. It returns nil if stdin is not a terminal, in which case
+// input is read line by line as before.
+func startConsole(onKey func(line string, key rune)) (*console, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, nil
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "")
+	terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if unicode.IsPrint(key) {
+			onKey(line, key)
+		}
+		return "", 0, false
+	}
+
+	out = terminal
+	return &console{fd: fd, state: state, terminal: terminal}, nil
+}
+
+// readLine returns the next line typed. Ctrl-C, and Ctrl-D on an empty
+// line, end the input with io.EOF.
+func (c *console) readLine() (string, error) {
+	return c.terminal.ReadLine()
+}
+
+// setPrompt replaces the prompt and redraws it if a line is being read.
+func (c *console) setPrompt(prompt string) {
+	c.terminal.SetPrompt(prompt)
+	_, _ = c.terminal.Write(nil)
+}
+
+// restore puts the terminal back into the mode it was in before the console
+// started.
+func (c *console) restore() {
+	out = os.Stdout
+	_ = term.Restore(c.fd, c.state)
+}
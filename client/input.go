@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"log"
@@ -9,26 +8,58 @@ import (
 	"strings"
 )
 
+// exit restores the terminal and quits.
+func (c *ChatClient) exit() {
+	if c.console != nil {
+		c.console.restore()
+	}
+	os.Exit(0)
+}
+
 func showCommands() {
-	fmt.Println("Available commands:")
-	fmt.Println("  /rooms              - Show all rooms")
-	fmt.Println("  /create <name>      - Create a new room")
-	fmt.Println("  /join <number>      - Join a room by number")
-	fmt.Println("  /leave              - Leave current room")
-	fmt.Println("  /history [limit]    - Show message history (default: 10)")
-	fmt.Println("  /exit               - Quit application")
-	fmt.Println()
+	fmt.Fprintln(out, "Available commands:")
+	fmt.Fprintln(out, "  /rooms              - Show all rooms")
+	fmt.Fprintln(out, "  /create [--private] <name> - Create a new room, private ones are invite-only")
+	fmt.Fprintln(out, "  /join <number>      - Join a room by number, or switch to a joined one")
+	fmt.Fprintln(out, "  /leave              - Leave current room")
+	fmt.Fprintln(out, "  /forget             - Leave current room and give up its membership")
+	fmt.Fprintln(out, "  /invite <user>      - Invite a user to the current private room")
+	fmt.Fprintln(out, "  /invites            - Show your pending invitations")
+	fmt.Fprintln(out, "  /accept <n>         - Accept invitation number n and join the room")
+	fmt.Fprintln(out, "  /msg <user> [text]  - Send a direct message, or open the conversation")
+	fmt.Fprintln(out, "  /history [limit]    - Show the latest messages (default: 10)")
+	fmt.Fprintln(out, "  /history more       - Show the messages before those shown last")
+	fmt.Fprintln(out, "  /reply <n> <text>   - Reply to message number n of the last listing")
+	fmt.Fprintln(out, "  /thread <n>         - Show the thread of message number n")
+	fmt.Fprintln(out, "  /react <n> <emoji>  - React to message number n")
+	fmt.Fprintln(out, "  /unreact <n> <emoji> - Take back a reaction")
+	fmt.Fprintln(out, "  /edit <text>        - Replace the text of your last message")
+	fmt.Fprintln(out, "  /delete [n]         - Delete your last message, or message number n as a moderator")
+	fmt.Fprintln(out, "  /kick <user>        - Remove a user from the current room")
+	fmt.Fprintln(out, "  /ban <user> [for]   - Ban a user, optionally for a while (e.g. 30m, 24h)")
+	fmt.Fprintln(out, "  /mute <user> [for]  - Stop a user from posting, optionally for a while")
+	fmt.Fprintln(out, "  /unban, /unmute <user> - Lift a ban or a mute")
+	fmt.Fprintln(out, "  /mod, /unmod <user> - Make a user a moderator or take the role away (owner only)")
+	fmt.Fprintln(out, "  /who                - Show who is online in the current room")
+	fmt.Fprintln(out, "  /topic [text]       - Show the topic of the current room, or set it ('-' clears it)")
+	fmt.Fprintln(out, "  /pins               - Show the pinned messages of the current room")
+	fmt.Fprintln(out, "  /pin, /unpin <n>    - Pin message number n, or unpin it")
+	fmt.Fprintln(out, "  /search <words>     - Search messages; add in:here, from:<user> or since:<duration> to narrow it")
+	fmt.Fprintln(out, "  /upload <path> [caption] - Send a file to the current room")
+	fmt.Fprintln(out, "  /download <n>       - Save the attachments of message number n here")
+	fmt.Fprintln(out, "  /mentions           - Show messages that mention you and mark them seen")
+	fmt.Fprintln(out, "  /away, /back        - Mark yourself away or back")
+	fmt.Fprintln(out, "  /reconnect          - Reconnect after a connection loss")
+	fmt.Fprintln(out, "  /exit               - Quit application")
+	fmt.Fprintln(out)
 }
 
-func (c *ChatClient) readInput(reader *bufio.Reader) {
+// readInput handles lines from readLine until the input ends.
+func (c *ChatClient) readInput(readLine func() (string, error)) {
 	for {
-		if c.roomID == "" {
-			fmt.Print("(not in room) > ")
-		} else {
-			fmt.Printf("[%s] > ", c.roomName)
-		}
+		c.printPrompt()
 
-		text, err := reader.ReadString('\n')
+		text, err := readLine()
 		if err != nil {
 			if err == io.EOF {
 				return
@@ -43,26 +74,26 @@ func (c *ChatClient) readInput(reader *bufio.Reader) {
 		}
 
 		if strings.HasPrefix(text, "/") {
-			if err := c.handleCommand(text, reader); err != nil {
+			if err := c.handleCommand(text); err != nil {
 				log.Printf("Command error: %v", err)
 			}
 			continue
 		}
 
 		if text == "exit" || text == "/exit" {
-			os.Exit(0)
+			c.exit()
 		}
 
 		if c.roomID == "" {
-			fmt.Println("You are not in any room. Use '/join <number>' to join a room first.")
+			fmt.Fprintln(out, "You are not in any room. Use '/join <number>' to join a room first.")
 			continue
 		}
 
-		if err := c.sendMessage(text); err != nil {
+		if err := c.sendMessage(c.roomID, "", text); err != nil {
 			log.Printf("Failed to send message: %v", err)
 		} else {
-			if c.conn == nil {
-				fmt.Printf("[%s]: %s\n", c.username, text)
+			if !c.isConnected() {
+				fmt.Fprintf(out, "[%s]: %s\n", c.username, text)
 			}
 		}
 	}
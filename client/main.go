@@ -9,39 +9,52 @@ import (
 	"strings"
 	"syscall"
 	"time"
+
+	"golang.org/x/term"
 )
 
 func main() {
 	reader := bufio.NewReader(os.Stdin)
 
 	fmt.Println("=== Go Chat Client ===")
-	fmt.Print("Enter your username: ")
-	username, _ := reader.ReadString('\n')
-	username = strings.TrimSpace(username)
-
-	if username == "" {
-		log.Fatal("Username cannot be empty")
-	}
 
-	user, err := registerUser(username)
+	user, err := signIn(reader)
 	if err != nil {
-		log.Fatalf("Failed to register user: %v", err)
+		log.Fatalf("Failed to sign in: %v", err)
 	}
 
-	fmt.Printf("Registered as: %s (ID: %s)\n\n", user.Username, user.ID)
+	fmt.Printf("Signed in as: %s (ID: %s)\n\n", user.Username, user.ID)
 
 	chatClient := &ChatClient{
 		userID:   user.ID,
 		username: user.Username,
+		joined:   make(map[string]*roomState),
 		done:     make(chan struct{}),
 	}
 
+	console, err := startConsole(chatClient.notifyTyping)
+	if err != nil {
+		log.Fatalf("Failed to set up the terminal: %v", err)
+	}
+	readLine := func() (string, error) { return reader.ReadString('\n') }
+	if console != nil {
+		chatClient.console = console
+		readLine = console.readLine
+		log.SetOutput(out)
+	}
+
+	// Connect right away so that direct messages arrive before any room is
+	// joined.
+	if err := chatClient.connect(); err != nil {
+		log.Printf("Warning: Failed to connect to WebSocket: %v", err)
+	}
+
 	if err := chatClient.refreshRooms(); err != nil {
 		log.Printf("Warning: Failed to get rooms: %v", err)
 	}
 
 	if len(chatClient.rooms) == 0 {
-		fmt.Println("No rooms available. Use '/create <name>' to create a room.")
+		fmt.Fprintln(out, "No rooms available. Use '/create <name>' to create a room.")
 	}
 
 	showCommands()
@@ -62,9 +75,73 @@ func main() {
 		}
 	}()
 
-	go chatClient.readInput(reader)
+	go func() {
+		chatClient.readInput(readLine)
+		// The console reads Ctrl-C as a key rather than a signal and ends
+		// the input instead.
+		if console != nil {
+			sigChan <- os.Interrupt
+		}
+	}()
 
 	<-sigChan
+	if console != nil {
+		console.restore()
+		log.SetOutput(os.Stderr)
+	}
 	fmt.Println("\nDisconnecting...")
+	close(chatClient.done)
 	chatClient.disconnect()
 }
+
+func signIn(reader *bufio.Reader) (*User, error) {
+	fmt.Print("Do you have an account? [l]ogin / [r]egister: ")
+	choice, _ := reader.ReadString('\n')
+	choice = strings.ToLower(strings.TrimSpace(choice))
+
+	register := strings.HasPrefix(choice, "r")
+	if !register && !strings.HasPrefix(choice, "l") {
+		return nil, fmt.Errorf("unknown choice %q", choice)
+	}
+
+	fmt.Print("Username: ")
+	username, _ := reader.ReadString('\n')
+	username = strings.TrimSpace(username)
+
+	if username == "" {
+		return nil, fmt.Errorf("username cannot be empty")
+	}
+
+	password, err := readPassword(reader, "Password: ")
+	if err != nil {
+		return nil, err
+	}
+
+	if !register {
+		return loginUser(username, password)
+	}
+
+	confirm, err := readPassword(reader, "Repeat password: ")
+	if err != nil {
+		return nil, err
+	}
+	if confirm != password {
+		return nil, fmt.Errorf("passwords do not match")
+	}
+
+	return registerUser(username, password)
+}
+
+func readPassword(reader *bufio.Reader, prompt string) (string, error) {
+	fmt.Print(prompt)
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		password, err := reader.ReadString('\n')
+		return strings.TrimRight(password, "\r\n"), err
+	}
+
+	password, err := term.ReadPassword(fd)
+	fmt.Println()
+	return string(password), err
+}
@@ -1,21 +1,139 @@
 package main
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type User struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
 }
 
+const (
+	// roomTypePrivate rooms are listed only for their members.
+	roomTypePrivate = "private"
+	// roomTypeDirect marks a one-to-one conversation opened with /msg.
+	roomTypeDirect = "direct"
+)
+
 type Room struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID               string   `json:"id"`
+	Name             string   `json:"name"`
+	Type             string   `json:"type"`
+	Topic            string   `json:"topic,omitempty"`
+	PinnedMessageIDs []string `json:"pinned_message_ids,omitempty"`
+	UnreadCount      int      `json:"unread_count,omitempty"`
+}
+
+type Invitation struct {
+	RoomID      string `json:"room_id"`
+	RoomName    string `json:"room_name"`
+	InviterName string `json:"inviter_name"`
 }
 
+// messageKindSystem marks messages the server writes itself, e.g. when
+// someone enters a room; they have no author.
+const messageKindSystem = "system"
+
 type Message struct {
-	ID       string `json:"id"`
-	RoomID   string `json:"room_id"`
+	ID        string     `json:"id"`
+	RoomID    string     `json:"room_id"`
+	Seq       int64      `json:"seq"`
+	Kind      string     `json:"kind"`
+	ParentID  string     `json:"parent_id,omitempty"`
+	UserID    string     `json:"user_id"`
+	Username  string     `json:"username"`
+	Content   string     `json:"content"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	ReplyCount  int             `json:"reply_count,omitempty"`
+	Reactions   []ReactionCount `json:"reactions,omitempty"`
+	Attachments []Attachment    `json:"attachments,omitempty"`
+	Mentions    []Mention       `json:"mentions,omitempty"`
+}
+
+type Mention struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
-	Content  string `json:"content"`
+}
+
+type Attachment struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+type Presence struct {
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username"`
+	Status   string    `json:"status"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+type PresencePayload struct {
+	RoomID string `json:"room_id"`
+	Presence
+}
+
+type StatusPayload struct {
+	Status string `json:"status"`
+}
+
+type SearchHit struct {
+	Message Message `json:"message"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+type TypingPayload struct {
+	RoomID   string `json:"room_id"`
+	UserID   string `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+type ModerationPayload struct {
+	RoomID        string     `json:"room_id"`
+	Action        string     `json:"action"`
+	UserID        string     `json:"user_id"`
+	Username      string     `json:"username"`
+	ModeratorName string     `json:"moderator_name"`
+	Role          string     `json:"role,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+}
+
+type ReactionPayload struct {
+	MessageID string          `json:"message_id"`
+	RoomID    string          `json:"room_id"`
+	UserID    string          `json:"user_id"`
+	Username  string          `json:"username"`
+	Emoji     string          `json:"emoji"`
+	Reactions []ReactionCount `json:"reactions"`
+}
+
+// HistoryPage is a page of room history, oldest first. PrevCursor is empty
+// when the page starts at the first message of the room.
+type HistoryPage struct {
+	Messages   []Message `json:"messages"`
+	PrevCursor string    `json:"prev_cursor"`
+	NextCursor string    `json:"next_cursor"`
+}
+
+type ThreadResponse struct {
+	Parent  Message   `json:"parent"`
+	Replies []Message `json:"replies"`
+}
+
+type AuthResponse struct {
+	User  User   `json:"user"`
+	Token string `json:"token"`
 }
 
 type APIResponse struct {
@@ -23,3 +141,69 @@ type APIResponse struct {
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
 }
+
+const protocolVersion = 1
+
+const (
+	frameMessage = "message"
+	frameError   = "error"
+	frameAck     = "ack"
+	frameSystem  = "system"
+	framePing    = "ping"
+	framePong    = "pong"
+
+	frameSubscribe   = "subscribe"
+	frameUnsubscribe = "unsubscribe"
+
+	frameMessageEdited  = "message.edited"
+	frameMessageDeleted = "message.deleted"
+
+	frameReactionAdded   = "reaction.added"
+	frameReactionRemoved = "reaction.removed"
+
+	frameRoomInvited    = "room.invited"
+	frameMention        = "mention"
+	frameRoomModeration = "room.moderation"
+	frameRoomUpdated    = "room.updated"
+
+	framePresence        = "presence"
+	framePresenceJoined  = "presence.joined"
+	framePresenceLeft    = "presence.left"
+	framePresenceChanged = "presence.changed"
+
+	frameTyping        = "typing"
+	frameTypingStarted = "typing.started"
+	frameTypingStopped = "typing.stopped"
+)
+
+const (
+	presenceOnline  = "online"
+	presenceAway    = "away"
+	presenceOffline = "offline"
+)
+
+type Envelope struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type SendMessagePayload struct {
+	RoomID   string `json:"room_id"`
+	ParentID string `json:"parent_id,omitempty"`
+	Content  string `json:"content"`
+}
+
+type SubscriptionPayload struct {
+	RoomID   string `json:"room_id"`
+	SinceSeq *int64 `json:"since_seq,omitempty"`
+}
+
+type ErrorPayload struct {
+	Message string `json:"message"`
+}
+
+type SystemPayload struct {
+	Text string `json:"text"`
+}
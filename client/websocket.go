@@ -3,24 +3,72 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// roomState tracks a room the user has joined during this session. Every
+// joined room stays subscribed on the socket until /leave, so activity in
+// rooms other than the active one can be counted as unread.
+type roomState struct {
+	name   string
+	direct bool
+	// lastSeq is the highest message seq seen in the room, from the history
+	// printed on /join or received live; it is sent as since_seq on
+	// reconnect so the server replays the gap. Zero means the room had no
+	// messages yet and it is resubscribed without a replay.
+	lastSeq int64
+	unread  int
+	// lastSentID is the user's most recent message in the room, the target
+	// of /edit and /delete.
+	lastSentID string
+	// typing holds the names of other users typing in the room, shown in
+	// the prompt while the room is active.
+	typing map[string]bool
+	// olderCursor is where /history more continues: the cursor of the page
+	// before the oldest history printed, empty at the start of the room.
+	olderCursor string
+}
+
+// typingInterval is how often a typing frame is repeated while the user keeps
+// typing; the server clears the indicator after a few seconds without one.
+const typingInterval = 3 * time.Second
+
 type ChatClient struct {
 	userID   string
 	username string
 	roomID   string
 	roomName string
 	conn     *websocket.Conn
+	joined   map[string]*roomState
+	mu       sync.Mutex
+	writeMu  sync.Mutex
+	frameSeq uint64
 	done     chan struct{}
 	rooms    []Room
+	// listed is the last list of messages printed with numbers; /reply and
+	// /thread refer to messages by their position in it.
+	listed []Message
+	// invites is the last list printed by /invites, which /accept refers to.
+	invites []Invitation
+	// away is set by /away and sent again after every reconnect.
+	away bool
+	// console is the line editor reading input, nil when stdin is not a
+	// terminal.
+	console *console
+	// typingRoom and typingSentAt throttle the typing frames sent for the
+	// active room.
+	typingRoom   string
+	typingSentAt time.Time
 }
 
 func (c *ChatClient) connect() error {
@@ -29,88 +77,824 @@ func (c *ChatClient) connect() error {
 		return fmt.Errorf("invalid WebSocket URL: %w", err)
 	}
 
-	q := u.Query()
-	q.Set("room_id", c.roomID)
-	q.Set("user_id", c.userID)
-	u.RawQuery = q.Encode()
-
 	dialer := websocket.Dialer{
 		HandshakeTimeout: 10 * time.Second,
 	}
 
-	conn, _, err := dialer.Dial(u.String(), nil)
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+authToken)
+
+	conn, _, err := dialer.Dial(u.String(), header)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
 
+	c.mu.Lock()
 	c.conn = conn
+	resume := make([]SubscriptionPayload, 0, len(c.joined))
+	for roomID, state := range c.joined {
+		// Typing indicators are not replayed; a stale one would never stop.
+		state.typing = nil
+
+		payload := SubscriptionPayload{RoomID: roomID}
+		if state.lastSeq > 0 {
+			since := state.lastSeq
+			payload.SinceSeq = &since
+		}
+		resume = append(resume, payload)
+	}
+	away := c.away
+	c.mu.Unlock()
+
+	go c.readMessages(conn)
+
+	if away {
+		if err := c.writeFrame(framePresence, c.nextFrameID(), StatusPayload{Status: presenceAway}); err != nil {
+			return fmt.Errorf("failed to restore away status: %w", err)
+		}
+	}
+
+	for _, payload := range resume {
+		if err := c.writeFrame(frameSubscribe, c.nextFrameID(), payload); err != nil {
+			return fmt.Errorf("failed to subscribe: %w", err)
+		}
+	}
+
 	return nil
 }
 
 func (c *ChatClient) disconnect() {
-	if c.conn != nil {
-		_ = c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-		c.conn.Close()
-		c.conn = nil
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+
+	if conn != nil {
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		conn.Close()
 	}
 }
 
-func (c *ChatClient) readMessages() {
-	defer func() {
-		if c.conn != nil {
-			c.conn.Close()
-			c.conn = nil
+func (c *ChatClient) isConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// releaseConn forgets conn if it is still the active connection. It returns
+// false when conn was already replaced or closed on purpose by disconnect.
+func (c *ChatClient) releaseConn(conn *websocket.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != conn {
+		return false
+	}
+	c.conn = nil
+	return true
+}
+
+func (c *ChatClient) isJoined(roomID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.joined[roomID]
+	return ok
+}
+
+// setActiveRoom makes the room the one shown on screen and clears its unread
+// count. An empty roomID leaves no room active.
+func (c *ChatClient) setActiveRoom(roomID, roomName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.roomID = roomID
+	c.roomName = roomName
+	if state, ok := c.joined[roomID]; ok {
+		state.unread = 0
+	}
+}
+
+func (c *ChatClient) setLastSent(msg *Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.joined[msg.RoomID]; ok && msg.UserID == c.userID {
+		state.lastSentID = msg.ID
+	}
+}
+
+func (c *ChatClient) setOlderCursor(roomID, cursor string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.joined[roomID]; ok {
+		state.olderCursor = cursor
+	}
+}
+
+// observeSeq raises the lastSeq of a joined room to seq.
+func (c *ChatClient) observeSeq(roomID string, seq int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.joined[roomID]; ok && seq > state.lastSeq {
+		state.lastSeq = seq
+	}
+}
+
+func (c *ChatClient) olderCursor(roomID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.joined[roomID]; ok {
+		return state.olderCursor
+	}
+	return ""
+}
+
+func (c *ChatClient) lastSent(roomID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.joined[roomID]; ok {
+		return state.lastSentID
+	}
+	return ""
+}
+
+func (c *ChatClient) clearLastSent(roomID, messageID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.joined[roomID]; ok && state.lastSentID == messageID {
+		state.lastSentID = ""
+	}
+}
+
+func (c *ChatClient) unreadCount(roomID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.joined[roomID]; ok {
+		return state.unread
+	}
+	return 0
+}
+
+// subscribe starts following a room on the socket, connecting first if
+// needed. The room is remembered even if that fails, so a later reconnect
+// picks it up.
+func (c *ChatClient) subscribe(room *Room) error {
+	c.mu.Lock()
+	if _, ok := c.joined[room.ID]; ok {
+		c.mu.Unlock()
+		return nil
+	}
+	c.joined[room.ID] = &roomState{name: c.roomLabel(room), direct: room.Type == roomTypeDirect}
+	connected := c.conn != nil
+	c.mu.Unlock()
+
+	if !connected {
+		return c.connect()
+	}
+	return c.writeFrame(frameSubscribe, c.nextFrameID(), SubscriptionPayload{RoomID: room.ID})
+}
+
+func (c *ChatClient) unsubscribe(roomID string) {
+	c.mu.Lock()
+	delete(c.joined, roomID)
+	connected := c.conn != nil
+	c.mu.Unlock()
+
+	if connected {
+		if err := c.writeFrame(frameUnsubscribe, c.nextFrameID(), SubscriptionPayload{RoomID: roomID}); err != nil {
+			log.Printf("Failed to unsubscribe: %v", err)
 		}
-	}()
+	}
+}
 
-	_ = c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	c.conn.SetPongHandler(func(string) error {
-		_ = c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+func (c *ChatClient) readMessages(conn *websocket.Conn) {
+	defer conn.Close()
+
+	const readWait = 60 * time.Second
+
+	// The server pings periodically; treat that as proof of life too,
+	// otherwise an idle room would hit the read deadline.
+	_ = conn.SetReadDeadline(time.Now().Add(readWait))
+	conn.SetPingHandler(func(data string) error {
+		_ = conn.SetReadDeadline(time.Now().Add(readWait))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(10*time.Second))
+	})
+	conn.SetPongHandler(func(string) error {
+		_ = conn.SetReadDeadline(time.Now().Add(readWait))
 		return nil
 	})
 
 	for {
-		_, message, err := c.conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if !c.releaseConn(conn) {
+				return
+			}
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseTryAgainLater) {
 				log.Printf("WebSocket error: %v", err)
 			}
+			c.reconnect()
 			return
 		}
 
+		_ = conn.SetReadDeadline(time.Now().Add(readWait))
+
+		var env Envelope
+		if err := json.Unmarshal(message, &env); err != nil {
+			log.Printf("Failed to unmarshal frame: %v", err)
+			continue
+		}
+
+		c.handleFrame(&env)
+	}
+}
+
+func (c *ChatClient) handleFrame(env *Envelope) {
+	switch env.Type {
+	case frameMessage:
 		var msg Message
-		if err := json.Unmarshal(message, &msg); err != nil {
+		if err := json.Unmarshal(env.Payload, &msg); err != nil {
 			log.Printf("Failed to unmarshal message: %v", err)
-			continue
+			return
 		}
 
-		if msg.UserID != c.userID {
-			fmt.Printf("\n[%s]: %s\n", msg.Username, msg.Content)
-			if c.roomID == "" {
-				fmt.Print("(not in room) > ")
+		c.handleMessage(&msg)
+
+	case frameMessageEdited, frameMessageDeleted:
+		var msg Message
+		if err := json.Unmarshal(env.Payload, &msg); err != nil {
+			log.Printf("Failed to unmarshal message: %v", err)
+			return
+		}
+
+		if msg.DeletedAt != nil {
+			c.clearLastSent(msg.RoomID, msg.ID)
+		}
+
+		if msg.RoomID == c.activeRoom() && msg.UserID != c.userID {
+			if msg.DeletedAt != nil {
+				fmt.Fprintf(out, "\n* A message from %s was deleted\n", msg.Username)
 			} else {
-				fmt.Printf("[%s] > ", c.roomName)
+				fmt.Fprintf(out, "\n* %s edited a message: %s\n", msg.Username, c.showMessage(&msg))
 			}
+			c.printPrompt()
+		}
+
+	case frameError:
+		var payload ErrorPayload
+		_ = json.Unmarshal(env.Payload, &payload)
+		fmt.Fprintf(out, "\nError: %s\n", payload.Message)
+		c.printPrompt()
+
+	case frameSystem:
+		var payload SystemPayload
+		_ = json.Unmarshal(env.Payload, &payload)
+		fmt.Fprintf(out, "\n* %s\n", payload.Text)
+		c.printPrompt()
+
+	case framePing:
+		if err := c.writeFrame(framePong, env.ID, nil); err != nil {
+			log.Printf("Failed to answer ping: %v", err)
+		}
+
+	case frameReactionAdded:
+		var payload ReactionPayload
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			log.Printf("Failed to unmarshal reaction: %v", err)
+			return
+		}
+
+		if payload.RoomID == c.activeRoom() && payload.UserID != c.userID {
+			fmt.Fprintf(out, "\n* %s reacted %s to %s\n", payload.Username, payload.Emoji, c.describeListed(payload.MessageID))
+			c.printPrompt()
+		}
+
+	case frameReactionRemoved:
+		// Removals are quiet; the next listing shows the new counts.
+
+	case frameAck:
+		// Acks need no output, but the one for a sent message tells which
+		// message /edit and /delete act on.
+		var msg Message
+		if err := json.Unmarshal(env.Payload, &msg); err == nil && msg.ID != "" {
+			c.setLastSent(&msg)
+		}
+
+	case frameRoomInvited:
+		var invitation Invitation
+		if err := json.Unmarshal(env.Payload, &invitation); err != nil {
+			log.Printf("Failed to unmarshal invitation: %v", err)
+			return
+		}
+
+		fmt.Fprintf(out, "\n* %s invited you to '%s'. Use '/invites' to see your invitations\n", invitation.InviterName, invitation.RoomName)
+		c.printPrompt()
+
+	case frameMention:
+		var msg Message
+		if err := json.Unmarshal(env.Payload, &msg); err != nil {
+			log.Printf("Failed to unmarshal mention: %v", err)
+			return
 		}
+
+		// In the active room the message itself is shown highlighted.
+		if msg.RoomID != c.activeRoom() {
+			fmt.Fprintf(out, "\n* %s mentioned you in %s: %s\n", msg.Username, c.describeRoom(msg.RoomID), msg.Content)
+			c.printPrompt()
+		}
+
+	case frameRoomModeration:
+		var payload ModerationPayload
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			log.Printf("Failed to unmarshal moderation event: %v", err)
+			return
+		}
+
+		c.handleModeration(&payload)
+
+	case frameRoomUpdated:
+		// Recorded by the system message that follows.
+
+	case framePresenceJoined, framePresenceLeft:
+		// The room's history records people entering and leaving, without
+		// the noise of reconnects.
+
+	case framePresenceChanged:
+		var payload PresencePayload
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			log.Printf("Failed to unmarshal presence: %v", err)
+			return
+		}
+
+		if payload.RoomID == c.activeRoom() && payload.UserID != c.userID {
+			fmt.Fprintf(out, "\n* %s\n", describePresence(&payload.Presence))
+			c.printPrompt()
+		}
+
+	case frameTypingStarted, frameTypingStopped:
+		var payload TypingPayload
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			log.Printf("Failed to unmarshal typing event: %v", err)
+			return
+		}
+
+		c.setTyping(&payload, env.Type == frameTypingStarted)
+
+	case framePong:
+
+	default:
+		log.Printf("Ignoring unknown frame type %q", env.Type)
 	}
 }
 
-func (c *ChatClient) sendMessage(content string) error {
-	url := fmt.Sprintf("%s/api/messages/send?room_id=%s&user_id=%s", serverURL, c.roomID, c.userID)
+// handleModeration reports a moderation action in a joined room. Being kicked
+// or banned drops the room, since the server no longer sends it to us.
+func (c *ChatClient) handleModeration(payload *ModerationPayload) {
+	c.mu.Lock()
+	state, ok := c.joined[payload.RoomID]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	roomName := state.name
+	removed := payload.UserID == c.userID && (payload.Action == "kick" || payload.Action == "ban")
+	if removed {
+		delete(c.joined, payload.RoomID)
+		if c.roomID == payload.RoomID {
+			c.roomID = ""
+			c.roomName = ""
+		}
+	}
+	c.mu.Unlock()
 
-	reqBody := map[string]string{"content": content}
-	jsonData, _ := json.Marshal(reqBody)
+	target := payload.Username
+	if payload.UserID == c.userID {
+		target = "you"
+	}
 
-	resp, err := http.Post(url, "application/json", strings.NewReader(string(jsonData)))
-	if err != nil {
-		return err
+	var text string
+	switch payload.Action {
+	case "kick":
+		text = fmt.Sprintf("%s kicked %s from %s", payload.ModeratorName, target, roomName)
+	case "ban":
+		text = fmt.Sprintf("%s banned %s from %s", payload.ModeratorName, target, roomName) + until(payload.ExpiresAt)
+	case "mute":
+		text = fmt.Sprintf("%s muted %s in %s", payload.ModeratorName, target, roomName) + until(payload.ExpiresAt)
+	case "unban":
+		text = fmt.Sprintf("%s lifted the ban on %s in %s", payload.ModeratorName, target, roomName)
+	case "unmute":
+		text = fmt.Sprintf("%s unmuted %s in %s", payload.ModeratorName, target, roomName)
+	case "role":
+		text = fmt.Sprintf("%s made %s a %s of %s", payload.ModeratorName, target, payload.Role, roomName)
+	default:
+		return
+	}
+
+	fmt.Fprintf(out, "\n* %s\n", text)
+	c.printPrompt()
+}
+
+// setTyping records whether another user is typing in a joined room. Only the
+// console can redraw the prompt in place, so without it the change shows the
+// next time the prompt is printed.
+func (c *ChatClient) setTyping(payload *TypingPayload, typing bool) {
+	if payload.UserID == c.userID {
+		return
+	}
+
+	c.mu.Lock()
+	state, ok := c.joined[payload.RoomID]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	if typing {
+		if state.typing == nil {
+			state.typing = make(map[string]bool)
+		}
+		state.typing[payload.Username] = true
+	} else {
+		delete(state.typing, payload.Username)
+	}
+	active := payload.RoomID == c.roomID
+	c.mu.Unlock()
+
+	if active && c.console != nil {
+		c.printPrompt()
+	}
+}
+
+// notifyTyping tells the active room that the user is typing, at most once
+// per typingInterval. Commands are not announced.
+func (c *ChatClient) notifyTyping(line string, key rune) {
+	if strings.HasPrefix(line+string(key), "/") {
+		return
+	}
+
+	c.mu.Lock()
+	roomID := c.roomID
+	if roomID == "" || c.conn == nil || (roomID == c.typingRoom && time.Since(c.typingSentAt) < typingInterval) {
+		c.mu.Unlock()
+		return
+	}
+	c.typingRoom = roomID
+	c.typingSentAt = time.Now()
+	c.mu.Unlock()
+
+	// Typing frames are best-effort; a failed write shows up on the next
+	// message instead of in the middle of the line being typed.
+	go func() {
+		_ = c.writeFrame(frameTyping, "", TypingPayload{RoomID: roomID})
+	}()
+}
+
+func describePresence(presence *Presence) string {
+	if presence.Status == presenceAway {
+		return presence.Username + " is away"
+	}
+	return presence.Username + " is back"
+}
+
+func until(expiresAt *time.Time) string {
+	if expiresAt == nil {
+		return ""
+	}
+	return " until " + expiresAt.Local().Format("Jan 2 15:04")
+}
+
+// handleMessage prints messages of the active room and counts the ones from
+// other joined rooms as unread, announcing only the first of each batch.
+func (c *ChatClient) handleMessage(msg *Message) {
+	if !c.isJoined(msg.RoomID) && !c.adoptDirectRoom(msg.RoomID) {
+		// Left the room while the frame was in flight.
+		return
+	}
+
+	c.mu.Lock()
+	state, ok := c.joined[msg.RoomID]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	if msg.Seq > state.lastSeq {
+		state.lastSeq = msg.Seq
+	}
+
+	active := msg.RoomID == c.roomID
+	firstUnread := false
+	if !active && msg.UserID != c.userID && msg.Kind != messageKindSystem {
+		state.unread++
+		firstUnread = state.unread == 1
+	}
+	roomName := state.name
+	direct := state.direct
+	c.mu.Unlock()
+
+	switch {
+	case active && msg.UserID != c.userID:
+		fmt.Fprintf(out, "\n%s\n", c.showMessage(msg))
+		c.printPrompt()
+	case firstUnread && direct:
+		fmt.Fprintf(out, "\n* New direct message from %s, use '/msg %s' to open it\n", msg.Username, msg.Username)
+		c.printPrompt()
+	case firstUnread:
+		fmt.Fprintf(out, "\n* New messages in '%s'\n", roomName)
+		c.printPrompt()
+	}
+}
+
+// adoptDirectRoom starts tracking a direct room the server delivered a
+// message from without a subscribe, i.e. a conversation someone else opened.
+func (c *ChatClient) adoptDirectRoom(roomID string) bool {
+	room, err := getRoom(roomID)
+	if err != nil || room.Type != roomTypeDirect {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.joined[room.ID]; !ok {
+		c.joined[room.ID] = &roomState{name: c.roomLabel(room), direct: true}
+	}
+	return true
+}
+
+// roomLabel names a room for display: direct rooms are shown as "@" and the
+// other participant's name.
+func (c *ChatClient) roomLabel(room *Room) string {
+	if room.Type != roomTypeDirect {
+		return room.Name
+	}
+
+	for _, name := range strings.Split(room.Name, " & ") {
+		if name != c.username {
+			return "@" + name
+		}
+	}
+	return room.Name
+}
+
+// reconnect re-dials with exponential backoff and jitter. Every joined room
+// is resubscribed from its lastSeq, so nothing is lost as long as one of the
+// attempts succeeds.
+func (c *ChatClient) reconnect() {
+	fmt.Fprintln(out, "\n* Connection lost, reconnecting...")
+
+	for attempt := 1; attempt <= maxReconnectAttempts; attempt++ {
+		delay := reconnectDelay(attempt)
+		fmt.Fprintf(out, "* Reconnecting in %s (attempt %d/%d)...\n", delay.Round(100*time.Millisecond), attempt, maxReconnectAttempts)
+
+		select {
+		case <-time.After(delay):
+		case <-c.done:
+			return
+		}
+
+		// The user may have reconnected by hand while we were waiting.
+		if c.isConnected() {
+			return
+		}
+
+		if err := c.connect(); err != nil {
+			fmt.Fprintf(out, "* Reconnect failed: %v\n", err)
+			continue
+		}
+
+		fmt.Fprintln(out, "* Connected")
+		c.printPrompt()
+		return
+	}
+
+	fmt.Fprintf(out, "* Could not reconnect after %d attempts. Switched to HTTP-only mode: "+
+		"messages are still sent, but new ones are not received in real time. Use '/reconnect' to try again.\n",
+		maxReconnectAttempts)
+	c.printPrompt()
+}
+
+func reconnectDelay(attempt int) time.Duration {
+	const (
+		baseDelay = 500 * time.Millisecond
+		maxDelay  = 30 * time.Second
+	)
+
+	delay := maxDelay
+	if attempt < 16 {
+		delay = baseDelay << (attempt - 1)
+		if delay > maxDelay {
+			delay = maxDelay
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to send message: %s", string(body))
+	// Random jitter in [delay/2, delay) keeps clients that dropped together
+	// from reconnecting in lockstep.
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+func (c *ChatClient) writeFrame(frameType, id string, payload interface{}) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	env := Envelope{
+		Version: protocolVersion,
+		Type:    frameType,
+		ID:      id,
+	}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		env.Payload = data
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return conn.WriteJSON(env)
+}
+
+func (c *ChatClient) nextFrameID() string {
+	return fmt.Sprintf("c%d", atomic.AddUint64(&c.frameSeq, 1))
+}
+
+func (c *ChatClient) activeRoom() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.roomID
+}
+
+func formatMessage(msg *Message) string {
+	content := msg.Content
+	for _, attachment := range msg.Attachments {
+		content += fmt.Sprintf(" 📎 %s (%s)", attachment.Filename, formatSize(attachment.Size))
+	}
+	content = strings.TrimSpace(content)
+
+	var text string
+	switch {
+	case msg.DeletedAt != nil && msg.Kind == messageKindSystem:
+		text = "* (message deleted)"
+	case msg.DeletedAt != nil:
+		text = fmt.Sprintf("[%s]: (message deleted)", msg.Username)
+	case msg.Kind == messageKindSystem:
+		text = "* " + content
+	case msg.EditedAt != nil:
+		text = fmt.Sprintf("[%s]: %s (edited)", msg.Username, content)
+	default:
+		text = fmt.Sprintf("[%s]: %s", msg.Username, content)
+	}
+
+	if msg.ParentID != "" {
+		text = "↳ " + text
+	}
+	switch {
+	case msg.ReplyCount == 1:
+		text += " (1 reply)"
+	case msg.ReplyCount > 1:
+		text += fmt.Sprintf(" (%d replies)", msg.ReplyCount)
+	}
+
+	if len(msg.Reactions) > 0 {
+		reactions := make([]string, len(msg.Reactions))
+		for i, reaction := range msg.Reactions {
+			reactions[i] = fmt.Sprintf("%s %d", reaction.Emoji, reaction.Count)
+		}
+		text += " [" + strings.Join(reactions, "  ") + "]"
+	}
+	return text
+}
+
+// showMessage formats msg for a listing or live output, marking it when it
+// mentions the user: in bold on a terminal and with a leading "»" otherwise.
+// System messages are dimmed on a terminal.
+func (c *ChatClient) showMessage(msg *Message) string {
+	text := formatMessage(msg)
+	if msg.Kind == messageKindSystem && c.console != nil {
+		return "\x1b[2m" + text + "\x1b[0m"
+	}
+	for _, mention := range msg.Mentions {
+		if mention.UserID != c.userID {
+			continue
+		}
+		if c.console != nil {
+			return "\x1b[1m" + text + "\x1b[0m"
+		}
+		return "» " + text
+	}
+	return text
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
+// describeListed names a message by its number in the last listing when it
+// is there.
+func (c *ChatClient) describeListed(messageID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, msg := range c.listed {
+		if msg.ID == messageID {
+			return fmt.Sprintf("message %d", i+1)
+		}
+	}
+	return "a message"
+}
+
+// printPrompt shows the active room followed by who is typing in it and
+// unread counts of the other joined rooms, e.g.
+// "[general] alice is typing… (random: 3) > ". With the console the prompt
+// is redrawn in place instead of printed.
+func (c *ChatClient) printPrompt() {
+	c.mu.Lock()
+
+	unread := make([]string, 0)
+	for roomID, state := range c.joined {
+		if roomID != c.roomID && state.unread > 0 {
+			unread = append(unread, fmt.Sprintf("%s: %d", state.name, state.unread))
+		}
+	}
+	sort.Strings(unread)
+
+	suffix := ""
+	if len(unread) > 0 {
+		suffix = " (" + strings.Join(unread, ", ") + ")"
+	}
+
+	var prompt string
+	if c.roomID == "" {
+		prompt = fmt.Sprintf("(not in room)%s > ", suffix)
+	} else {
+		prompt = fmt.Sprintf("[%s]%s%s > ", c.roomName, describeTyping(c.joined[c.roomID]), suffix)
+	}
+	c.mu.Unlock()
+
+	if c.console != nil {
+		c.console.setPrompt(prompt)
+		return
+	}
+	fmt.Fprint(out, prompt)
+}
+
+func describeTyping(state *roomState) string {
+	if state == nil || len(state.typing) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(state.typing))
+	for name := range state.typing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) == 1 {
+		return " " + names[0] + " is typing…"
+	}
+	return " " + strings.Join(names, ", ") + " are typing…"
+}
+
+// sendMessage posts content to the room, as a reply in the thread of
+// parentID if it is set.
+func (c *ChatClient) sendMessage(roomID, parentID, content string) error {
+	if c.isConnected() {
+		payload := SendMessagePayload{RoomID: roomID, ParentID: parentID, Content: content}
+		err := c.writeFrame(frameMessage, c.nextFrameID(), payload)
+		if err == nil {
+			return nil
+		}
+		log.Printf("WebSocket send failed, falling back to HTTP: %v", err)
+	}
+
+	return c.sendMessageHTTP(roomID, parentID, content)
+}
+
+func (c *ChatClient) sendMessageHTTP(roomID, parentID, content string) error {
+	msg, err := sendMessage(roomID, parentID, content)
+	if err != nil {
+		return err
 	}
 
+	c.setLastSent(msg)
 	return nil
 }
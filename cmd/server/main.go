@@ -1,37 +1,81 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
+	"gochat/internal/auth"
 	"gochat/internal/delivery"
 	"gochat/internal/delivery/handler"
 	"gochat/internal/delivery/websocket"
+	"gochat/internal/domain"
 	"gochat/internal/repository"
 	"gochat/internal/usecase"
 )
 
 func main() {
 	_ = godotenv.Load()
-	userRepo := repository.NewInMemoryUserRepository()
-	roomRepo := repository.NewInMemoryRoomRepository()
-	messageRepo := repository.NewInMemoryMessageRepository()
+
+	repos, err := setupRepositories()
+	if err != nil {
+		log.Fatalf("Failed to set up storage: %v", err)
+	}
+	defer repos.close()
+
+	userRepo := repos.users
+	roomRepo := repos.rooms
+	messageRepo := repos.messages
+	reactionRepo := repos.reactions
+	membershipRepo := repos.memberships
+	sanctionRepo := repos.sanctions
+	readMarkerRepo := repos.readMarkers
+	searchIndex := repos.searchIndex
+	attachmentRepo := repos.attachments
+	mentionRepo := repos.mentions
+	blobs := repos.blobs
+
+	tokens, err := setupTokenManager()
+	if err != nil {
+		log.Fatalf("Failed to set up authentication: %v", err)
+	}
+
+	shutdownTimeout, err := durationFromEnv("SHUTDOWN_TIMEOUT", 10*time.Second)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	attachmentLimits, err := attachmentLimitsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	userUsecase := usecase.NewUserUsecase(userRepo)
-	roomUsecase := usecase.NewRoomUsecase(roomRepo)
-	messageUsecase := usecase.NewMessageUsecase(messageRepo, userRepo, roomRepo)
+	roomUsecase := usecase.NewRoomUsecase(roomRepo, userRepo, membershipRepo, sanctionRepo, messageRepo, readMarkerRepo)
+	messageUsecase := usecase.NewMessageUsecase(messageRepo, userRepo, roomRepo, reactionRepo, membershipRepo, sanctionRepo, attachmentRepo, mentionRepo, blobs, attachmentLimits)
+	searchUsecase := usecase.NewSearchUsecase(searchIndex, messageRepo, userRepo, roomRepo, membershipRepo, sanctionRepo)
+	presenceUsecase := usecase.NewPresenceUsecase()
 
-	wsHub := websocket.NewHub()
+	wsHub := websocket.NewHub(messageUsecase, presenceUsecase)
 	go wsHub.Run()
 
-	userHandler := handler.NewUserHandler(userUsecase)
-	roomHandler := handler.NewRoomHandler(roomUsecase)
-	messageHandler := handler.NewMessageHandler(messageUsecase, wsHub)
+	userHandler := handler.NewUserHandler(userUsecase, tokens)
+	roomHandler := handler.NewRoomHandler(roomUsecase, userUsecase, wsHub)
+	messageHandler := handler.NewMessageHandler(messageUsecase, searchUsecase, wsHub)
 
-	router := delivery.NewRouter(userHandler, roomHandler, messageHandler, wsHub)
+	authMiddleware := delivery.NewAuthMiddleware(tokens, userUsecase)
+
+	router := delivery.NewRouter(userHandler, roomHandler, messageHandler, wsHub, authMiddleware)
 	httpHandler := router.SetupRoutes()
 
 	port := os.Getenv("PORT")
@@ -49,7 +93,195 @@ func main() {
 	log.Printf("HTTP API: http://%s", addr)
 	log.Printf("WebSocket endpoint: ws://%s/ws", addr)
 
-	if err := http.ListenAndServe(addr, httpHandler); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{
+		Addr:    addr,
+		Handler: httpHandler,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	var startErr error
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			startErr = err
+			log.Printf("Failed to start server: %v", err)
+		}
+	case <-ctx.Done():
+		log.Printf("Shutting down (timeout %s)...", shutdownTimeout)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop accepting requests and let in-flight ones finish before closing
+	// sockets, so that their broadcasts still reach connected clients.
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
+
+	if err := wsHub.Stop(shutdownCtx); err != nil {
+		log.Printf("WebSocket hub shutdown: %v", err)
+	}
+
+	log.Printf("Server stopped")
+
+	if startErr != nil {
+		// os.Exit skips deferred calls, so storage is closed here.
+		repos.close()
+		os.Exit(1)
+	}
+}
+
+func durationFromEnv(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, value)
+	}
+
+	return parsed, nil
+}
+
+// attachmentLimitsFromEnv reads ATTACHMENT_MAX_SIZE, in bytes, and
+// ATTACHMENT_TYPES, a comma-separated list of MIME types.
+func attachmentLimitsFromEnv() (usecase.AttachmentLimits, error) {
+	limits := usecase.DefaultAttachmentLimits()
+
+	if value := os.Getenv("ATTACHMENT_MAX_SIZE"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			return limits, fmt.Errorf("invalid ATTACHMENT_MAX_SIZE %q", value)
+		}
+		limits.MaxSize = size
+	}
+
+	if value := os.Getenv("ATTACHMENT_TYPES"); value != "" {
+		limits.AllowedTypes = nil
+		for _, contentType := range strings.Split(value, ",") {
+			if contentType = strings.TrimSpace(contentType); contentType != "" {
+				limits.AllowedTypes = append(limits.AllowedTypes, contentType)
+			}
+		}
+	}
+
+	return limits, nil
+}
+
+func setupTokenManager() (*auth.TokenManager, error) {
+	ttl, err := durationFromEnv("TOKEN_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := []byte(os.Getenv("AUTH_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		log.Printf("AUTH_SECRET is not set, using a random secret: sessions will not survive a restart")
+	}
+
+	return auth.NewTokenManager(secret, ttl), nil
+}
+
+type repositories struct {
+	users       domain.UserRepository
+	rooms       domain.RoomRepository
+	messages    domain.MessageRepository
+	reactions   domain.ReactionRepository
+	memberships domain.MembershipRepository
+	sanctions   domain.SanctionRepository
+	readMarkers domain.ReadMarkerRepository
+	searchIndex domain.SearchIndex
+	attachments domain.AttachmentRepository
+	mentions    domain.MentionRepository
+	blobs       domain.BlobStorage
+	close       func()
+}
+
+func setupRepositories() (*repositories, error) {
+	driver := os.Getenv("STORAGE_DRIVER")
+	if driver == "" {
+		driver = "memory"
+	}
+
+	switch driver {
+	case "memory":
+		log.Printf("Using in-memory storage")
+		searchIndex := repository.NewInMemorySearchIndex()
+		return &repositories{
+			users:       repository.NewInMemoryUserRepository(),
+			rooms:       repository.NewInMemoryRoomRepository(),
+			messages:    repository.NewIndexedMessageRepository(repository.NewInMemoryMessageRepository(), searchIndex),
+			reactions:   repository.NewInMemoryReactionRepository(),
+			memberships: repository.NewInMemoryMembershipRepository(),
+			sanctions:   repository.NewInMemorySanctionRepository(),
+			readMarkers: repository.NewInMemoryReadMarkerRepository(),
+			searchIndex: searchIndex,
+			attachments: repository.NewInMemoryAttachmentRepository(),
+			mentions:    repository.NewInMemoryMentionRepository(),
+			blobs:       repository.NewInMemoryBlobStorage(),
+			close:       func() {},
+		}, nil
+
+	case "sqlite":
+		dbPath := os.Getenv("DB_PATH")
+		if dbPath == "" {
+			dbPath = "gochat.db"
+		}
+
+		attachmentDir := os.Getenv("ATTACHMENT_DIR")
+		if attachmentDir == "" {
+			attachmentDir = "attachments"
+		}
+
+		blobs, err := repository.NewLocalBlobStorage(attachmentDir)
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := repository.OpenSQLite(dbPath)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("Using SQLite storage: %s, attachments in %s", dbPath, attachmentDir)
+		searchIndex := repository.NewSQLiteSearchIndex(db)
+		return &repositories{
+			users:       repository.NewSQLiteUserRepository(db),
+			rooms:       repository.NewSQLiteRoomRepository(db),
+			messages:    repository.NewIndexedMessageRepository(repository.NewSQLiteMessageRepository(db), searchIndex),
+			reactions:   repository.NewSQLiteReactionRepository(db),
+			memberships: repository.NewSQLiteMembershipRepository(db),
+			sanctions:   repository.NewSQLiteSanctionRepository(db),
+			readMarkers: repository.NewSQLiteReadMarkerRepository(db),
+			searchIndex: searchIndex,
+			attachments: repository.NewSQLiteAttachmentRepository(db),
+			mentions:    repository.NewSQLiteMentionRepository(db),
+			blobs:       blobs,
+			close: func() {
+				if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+					log.Printf("Failed to checkpoint database: %v", err)
+				}
+				if err := db.Close(); err != nil {
+					log.Printf("Failed to close database: %v", err)
+				}
+			},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q (expected \"memory\" or \"sqlite\")", driver)
 	}
 }
@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"context"
+
+	"gochat/internal/domain"
+)
+
+type contextKey struct{}
+
+func WithUser(ctx context.Context, user *domain.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+func UserFromContext(ctx context.Context) (*domain.User, bool) {
+	user, ok := ctx.Value(contextKey{}).(*domain.User)
+	return user, ok
+}
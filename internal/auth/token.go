@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+type claims struct {
+	UserID    string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// TokenManager issues and verifies session tokens of the form
+// base64url(claims) + "." + base64url(HMAC-SHA256(secret, claims)).
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewTokenManager(secret []byte, ttl time.Duration) *TokenManager {
+	return &TokenManager{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+func (m *TokenManager) Issue(userID string) (string, error) {
+	payload, err := json.Marshal(claims{
+		UserID:    userID,
+		ExpiresAt: m.now().Add(m.ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(m.sign(encoded)), nil
+}
+
+// Verify checks the signature and expiry of token and returns the user ID it
+// was issued for.
+func (m *TokenManager) Verify(token string) (string, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, m.sign(encoded)) {
+		return "", ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil || c.UserID == "" {
+		return "", ErrInvalidToken
+	}
+
+	if m.now().Unix() >= c.ExpiresAt {
+		return "", ErrExpiredToken
+	}
+
+	return c.UserID, nil
+}
+
+func (m *TokenManager) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenManager_IssueAndVerify(t *testing.T) {
+	manager := NewTokenManager([]byte("secret"), time.Hour)
+
+	token, err := manager.Issue("user1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	userID, err := manager.Verify(token)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if userID != "user1" {
+		t.Errorf("Expected user ID 'user1', got %s", userID)
+	}
+}
+
+func TestTokenManager_VerifyRejectsTampering(t *testing.T) {
+	manager := NewTokenManager([]byte("secret"), time.Hour)
+
+	token, err := manager.Issue("user1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	other, err := NewTokenManager([]byte("other"), time.Hour).Issue("user2")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	payload, signature, _ := strings.Cut(token, ".")
+	otherPayload, _, _ := strings.Cut(other, ".")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"no signature", payload},
+		{"swapped payload", otherPayload + "." + signature},
+		{"signed with other secret", other},
+		{"garbage signature", payload + ".!!!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := manager.Verify(tt.token); err != ErrInvalidToken {
+				t.Errorf("Expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTokenManager_VerifyRejectsExpired(t *testing.T) {
+	manager := NewTokenManager([]byte("secret"), time.Minute)
+
+	issuedAt := time.Now()
+	manager.now = func() time.Time { return issuedAt }
+
+	token, err := manager.Issue("user1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	manager.now = func() time.Time { return issuedAt.Add(2 * time.Minute) }
+
+	if _, err := manager.Verify(token); err != ErrExpiredToken {
+		t.Errorf("Expected ErrExpiredToken, got %v", err)
+	}
+}
@@ -2,16 +2,42 @@ package dto
 
 type RegisterUserRequest struct {
 	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 type CreateRoomRequest struct {
-	Name string `json:"name"`
+	Name    string `json:"name"`
+	Private bool   `json:"private,omitempty"`
+}
+
+type SetTopicRequest struct {
+	Topic string `json:"topic"`
 }
 
 type SendMessageRequest struct {
+	Content  string `json:"content"`
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+type EditMessageRequest struct {
 	Content string `json:"content"`
 }
 
+type ReactionRequest struct {
+	Emoji string `json:"emoji"`
+}
+
+// MarkSeenRequest lists the messages whose mentions were seen; an empty
+// list marks all of them.
+type MarkSeenRequest struct {
+	MessageIDs []string `json:"message_ids"`
+}
+
 type GetMessagesRequest struct {
 	Limit  int `json:"limit"`
 	Offset int `json:"offset"`
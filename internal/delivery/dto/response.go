@@ -1,5 +1,7 @@
 package dto
 
+import "gochat/internal/domain"
+
 type Response struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
@@ -19,3 +21,21 @@ func ErrorResponse(err string) Response {
 		Error:   err,
 	}
 }
+
+// HistoryResponse is a page of room history, oldest first. The cursors are
+// left out at either end of the history.
+type HistoryResponse struct {
+	Messages   []*domain.Message `json:"messages"`
+	PrevCursor string            `json:"prev_cursor,omitempty"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+type ThreadResponse struct {
+	Parent  *domain.Message   `json:"parent"`
+	Replies []*domain.Message `json:"replies"`
+}
+
+type AuthResponse struct {
+	User  *domain.User `json:"user"`
+	Token string       `json:"token"`
+}
@@ -2,7 +2,10 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"gochat/internal/usecase"
 )
 
 func respondJSON(w http.ResponseWriter, statusCode int, data interface{}) {
@@ -10,3 +13,30 @@ func respondJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.WriteHeader(statusCode)
 	_ = json.NewEncoder(w).Encode(data)
 }
+
+// errorStatus maps usecase errors to HTTP status codes; anything unknown is
+// treated as a bad request.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, usecase.ErrMessageNotFound),
+		errors.Is(err, usecase.ErrRoomNotFound),
+		errors.Is(err, usecase.ErrInvitationNotFound),
+		errors.Is(err, usecase.ErrAttachmentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, usecase.ErrNotMessageAuthor),
+		errors.Is(err, usecase.ErrSystemMessage),
+		errors.Is(err, usecase.ErrRoomAccessDenied),
+		errors.Is(err, usecase.ErrNotRoomModerator),
+		errors.Is(err, usecase.ErrNotRoomEditor),
+		errors.Is(err, usecase.ErrOwnerCannotLeave),
+		errors.Is(err, usecase.ErrBannedFromRoom),
+		errors.Is(err, usecase.ErrMutedInRoom):
+		return http.StatusForbidden
+	case errors.Is(err, usecase.ErrAttachmentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, usecase.ErrAttachmentType):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -2,25 +2,34 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"time"
 
+	"gochat/internal/auth"
 	"gochat/internal/delivery/dto"
 	"gochat/internal/delivery/websocket"
+	"gochat/internal/domain"
 	"gochat/internal/usecase"
 )
 
 type MessageHandler struct {
 	messageUsecase *usecase.MessageUsecase
+	searchUsecase  *usecase.SearchUsecase
 	wsHub          *websocket.Hub
 }
 
 func NewMessageHandler(
 	messageUsecase *usecase.MessageUsecase,
+	searchUsecase *usecase.SearchUsecase,
 	wsHub *websocket.Hub,
 ) *MessageHandler {
 	return &MessageHandler{
 		messageUsecase: messageUsecase,
+		searchUsecase:  searchUsecase,
 		wsHub:          wsHub,
 	}
 }
@@ -31,11 +40,15 @@ func (h *MessageHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	roomID := r.URL.Query().Get("room_id")
-	userID := r.URL.Query().Get("user_id")
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
 
-	if roomID == "" || userID == "" {
-		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room_id and user_id are required"))
+	roomID := r.URL.Query().Get("room_id")
+	if roomID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room_id is required"))
 		return
 	}
 
@@ -45,9 +58,17 @@ func (h *MessageHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	message, err := h.messageUsecase.SendMessage(roomID, userID, req.Content)
+	var (
+		message *domain.Message
+		err     error
+	)
+	if req.ParentID != "" {
+		message, err = h.messageUsecase.SendReply(roomID, req.ParentID, user.ID, req.Content)
+	} else {
+		message, err = h.messageUsecase.SendMessage(roomID, user.ID, req.Content)
+	}
 	if err != nil {
-		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse(err.Error()))
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
 		return
 	}
 
@@ -56,12 +77,303 @@ func (h *MessageHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusCreated, dto.SuccessResponse(message))
 }
 
+// UploadAttachment posts a message carrying a file. The request is a
+// multipart form with the file in "file" and an optional caption in
+// "content".
+func (h *MessageHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	roomID := r.URL.Query().Get("room_id")
+	if roomID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room_id is required"))
+		return
+	}
+
+	// Leave room for the rest of the form; the usecase enforces the exact
+	// limit on the file itself.
+	const (
+		formOverhead = 64 << 10
+		maxMemory    = 1 << 20
+	)
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.messageUsecase.MaxAttachmentSize()+formOverhead)
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondJSON(w, errorStatus(usecase.ErrAttachmentTooLarge), dto.ErrorResponse(usecase.ErrAttachmentTooLarge.Error()))
+			return
+		}
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("Invalid multipart form"))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("file is required"))
+		return
+	}
+	defer file.Close()
+
+	message, err := h.messageUsecase.SendAttachment(roomID, user.ID, r.FormValue("content"), header.Filename, file)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	h.wsHub.BroadcastMessage(roomID, message)
+
+	respondJSON(w, http.StatusCreated, dto.SuccessResponse(message))
+}
+
+// DownloadAttachment serves the content of an attachment as a file download.
+func (h *MessageHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	attachmentID := r.URL.Query().Get("id")
+	if attachmentID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("id is required"))
+		return
+	}
+
+	attachment, content, err := h.messageUsecase.OpenAttachment(attachmentID, user.ID)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+	defer content.Close()
+
+	// Serve uploads as downloads of the detected type only, so that a
+	// browser never renders them in the page.
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, content)
+}
+
+func (h *MessageHandler) EditMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	messageID := r.URL.Query().Get("id")
+	if messageID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("id is required"))
+		return
+	}
+
+	var req dto.EditMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("Invalid request body"))
+		return
+	}
+
+	message, err := h.messageUsecase.EditMessage(messageID, user.ID, req.Content)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	h.wsHub.BroadcastEvent(message.RoomID, websocket.TypeMessageEdited, message.ID, message)
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(message))
+}
+
+func (h *MessageHandler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	messageID := r.URL.Query().Get("id")
+	if messageID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("id is required"))
+		return
+	}
+
+	message, err := h.messageUsecase.DeleteMessage(messageID, user.ID)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	h.wsHub.BroadcastEvent(message.RoomID, websocket.TypeMessageDeleted, message.ID, message)
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(message))
+}
+
+func (h *MessageHandler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	h.changeReaction(w, r, h.messageUsecase.AddReaction, websocket.TypeReactionAdded)
+}
+
+func (h *MessageHandler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	h.changeReaction(w, r, h.messageUsecase.RemoveReaction, websocket.TypeReactionRemoved)
+}
+
+func (h *MessageHandler) changeReaction(
+	w http.ResponseWriter,
+	r *http.Request,
+	change func(messageID, userID, emoji string) (*domain.Message, error),
+	eventType string,
+) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	messageID := r.URL.Query().Get("id")
+	if messageID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("id is required"))
+		return
+	}
+
+	var req dto.ReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("Invalid request body"))
+		return
+	}
+
+	message, err := change(messageID, user.ID, req.Emoji)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	reactions := message.Reactions
+	if reactions == nil {
+		reactions = []domain.ReactionCount{}
+	}
+	h.wsHub.BroadcastEvent(message.RoomID, eventType, message.ID, websocket.ReactionPayload{
+		MessageID: message.ID,
+		RoomID:    message.RoomID,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Emoji:     req.Emoji,
+		Reactions: reactions,
+	})
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(message))
+}
+
+// SearchMessages finds messages by the words in q across the rooms the caller
+// can read, optionally only in room_id, by the user with the given username
+// or written between since and until (RFC 3339).
+func (h *MessageHandler) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	query := r.URL.Query()
+	text := query.Get("q")
+	if text == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("q is required"))
+		return
+	}
+
+	filter := usecase.SearchFilter{
+		RoomID: query.Get("room_id"),
+		Author: query.Get("user"),
+	}
+	for _, bound := range []struct {
+		name string
+		dest *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, dto.ErrorResponse(bound.name+" must be an RFC 3339 time"))
+			return
+		}
+		*bound.dest = parsed
+	}
+
+	const defaultLimit = 20
+
+	limit := defaultLimit
+	offset := 0
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
+			offset = parsedOffset
+		}
+	}
+
+	hits, err := h.searchUsecase.Search(user.ID, text, filter, limit, offset)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(hits))
+}
+
 func (h *MessageHandler) GetMessagesHistory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
 	roomID := r.URL.Query().Get("room_id")
 	if roomID == "" {
 		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room_id is required"))
@@ -70,6 +382,111 @@ func (h *MessageHandler) GetMessagesHistory(w http.ResponseWriter, r *http.Reque
 
 	const defaultLimit = 50
 
+	limit := defaultLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	cursor := usecase.HistoryCursor{
+		Before: r.URL.Query().Get("before"),
+		After:  r.URL.Query().Get("after"),
+	}
+
+	page, err := h.messageUsecase.GetMessagesHistory(roomID, user.ID, cursor, limit)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(dto.HistoryResponse{
+		Messages:   page.Messages,
+		PrevCursor: page.PrevCursor,
+		NextCursor: page.NextCursor,
+	}))
+}
+
+// GetNotifications lists the messages mentioning the caller that they have
+// not marked seen, oldest first.
+func (h *MessageHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	const defaultLimit = 50
+
+	limit := defaultLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	messages, err := h.messageUsecase.GetNotifications(user.ID, limit)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(messages))
+}
+
+// MarkNotificationsSeen clears mentions from the caller's notifications. An
+// empty body clears all of them.
+func (h *MessageHandler) MarkNotificationsSeen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	var req dto.MarkSeenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("Invalid request body"))
+		return
+	}
+
+	if err := h.messageUsecase.MarkNotificationsSeen(user.ID, req.MessageIDs); err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(nil))
+}
+
+func (h *MessageHandler) GetThread(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	messageID := r.URL.Query().Get("id")
+	if messageID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("id is required"))
+		return
+	}
+
+	const defaultLimit = 50
+
 	limit := defaultLimit
 	offset := 0
 
@@ -85,11 +502,11 @@ func (h *MessageHandler) GetMessagesHistory(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
-	messages, err := h.messageUsecase.GetMessagesHistory(roomID, limit, offset)
+	parent, replies, err := h.messageUsecase.GetThread(messageID, user.ID, limit, offset)
 	if err != nil {
-		respondJSON(w, http.StatusInternalServerError, dto.ErrorResponse(err.Error()))
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
 		return
 	}
 
-	respondJSON(w, http.StatusOK, dto.SuccessResponse(messages))
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(dto.ThreadResponse{Parent: parent, Replies: replies}))
 }
@@ -3,18 +3,31 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
 
+	"gochat/internal/auth"
 	"gochat/internal/delivery/dto"
+	"gochat/internal/delivery/websocket"
+	"gochat/internal/domain"
 	"gochat/internal/usecase"
 )
 
 type RoomHandler struct {
 	roomUsecase *usecase.RoomUsecase
+	userUsecase *usecase.UserUsecase
+	wsHub       *websocket.Hub
 }
 
-func NewRoomHandler(roomUsecase *usecase.RoomUsecase) *RoomHandler {
+func NewRoomHandler(
+	roomUsecase *usecase.RoomUsecase,
+	userUsecase *usecase.UserUsecase,
+	wsHub *websocket.Hub,
+) *RoomHandler {
 	return &RoomHandler{
 		roomUsecase: roomUsecase,
+		userUsecase: userUsecase,
+		wsHub:       wsHub,
 	}
 }
 
@@ -24,13 +37,19 @@ func (h *RoomHandler) CreateRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
 	var req dto.CreateRoomRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("Invalid request body"))
 		return
 	}
 
-	room, err := h.roomUsecase.CreateRoom(req.Name)
+	room, err := h.roomUsecase.CreateRoom(user.ID, req.Name, req.Private)
 	if err != nil {
 		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse(err.Error()))
 		return
@@ -39,34 +58,508 @@ func (h *RoomHandler) CreateRoom(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusCreated, dto.SuccessResponse(room))
 }
 
+// OpenDirectRoom returns the direct room between the caller and the user
+// named in the query, creating it on first use.
+func (h *RoomHandler) OpenDirectRoom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	username := r.URL.Query().Get("username")
+	if username == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("username is required"))
+		return
+	}
+
+	other, err := h.userUsecase.GetUserByUsername(username)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	room, err := h.roomUsecase.OpenDirectRoom(user.ID, other.ID)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(room))
+}
+
+func (h *RoomHandler) InviteUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	roomID := r.URL.Query().Get("id")
+	username := r.URL.Query().Get("username")
+	if roomID == "" || username == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room id and username are required"))
+		return
+	}
+
+	invitee, err := h.userUsecase.GetUserByUsername(username)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	invitation, err := h.roomUsecase.InviteUser(roomID, user.ID, invitee.ID)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	h.wsHub.SendToUser(invitee.ID, websocket.TypeRoomInvited, "", invitation)
+
+	respondJSON(w, http.StatusCreated, dto.SuccessResponse(invitation))
+}
+
+func (h *RoomHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	roomID := r.URL.Query().Get("id")
+	if roomID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room id is required"))
+		return
+	}
+
+	room, err := h.roomUsecase.AcceptInvitation(roomID, user.ID)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	h.wsHub.BroadcastSystem(room.ID, user.Username+" became a member")
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(room))
+}
+
+func (h *RoomHandler) LeaveRoom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	roomID := r.URL.Query().Get("id")
+	if roomID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room id is required"))
+		return
+	}
+
+	if err := h.roomUsecase.LeaveRoom(roomID, user.ID); err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	// Leaving a private room also takes the user's connections out of it.
+	if _, err := h.roomUsecase.GetRoom(roomID, user.ID); err != nil {
+		h.wsHub.RemoveUserFromRoom(roomID, user.ID)
+	}
+	h.wsHub.BroadcastSystem(roomID, user.Username+" is no longer a member")
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(nil))
+}
+
+// SetRole lets the room owner make a user a moderator (role=moderator) or
+// take the role away again (role=member).
+func (h *RoomHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, websocket.ModerationRole)
+}
+
+func (h *RoomHandler) Kick(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, websocket.ModerationKick)
+}
+
+// Ban takes an optional duration such as "30m"; without one the ban lasts
+// until it is lifted.
+func (h *RoomHandler) Ban(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, websocket.ModerationBan)
+}
+
+func (h *RoomHandler) Unban(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, websocket.ModerationUnban)
+}
+
+// Mute takes an optional duration like Ban.
+func (h *RoomHandler) Mute(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, websocket.ModerationMute)
+}
+
+func (h *RoomHandler) Unmute(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, websocket.ModerationUnmute)
+}
+
+// moderate applies a moderation action of the caller to the user named in
+// the query and announces it to the room.
+func (h *RoomHandler) moderate(w http.ResponseWriter, r *http.Request, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	query := r.URL.Query()
+	roomID := query.Get("id")
+	username := query.Get("username")
+	if roomID == "" || username == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room id and username are required"))
+		return
+	}
+
+	var duration time.Duration
+	if value := query.Get("duration"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("invalid duration"))
+			return
+		}
+		duration = parsed
+	}
+
+	target, err := h.userUsecase.GetUserByUsername(username)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	event := websocket.ModerationPayload{
+		RoomID:        roomID,
+		Action:        action,
+		UserID:        target.ID,
+		Username:      target.Username,
+		ModeratorID:   user.ID,
+		ModeratorName: user.Username,
+	}
+
+	var sanction *domain.Sanction
+	switch action {
+	case websocket.ModerationRole:
+		var membership *domain.Membership
+		if membership, err = h.roomUsecase.SetRole(roomID, user.ID, target.ID, query.Get("role")); err == nil {
+			event.Role = membership.Role
+		}
+	case websocket.ModerationKick:
+		err = h.roomUsecase.Kick(roomID, user.ID, target.ID)
+	case websocket.ModerationBan:
+		sanction, err = h.roomUsecase.Ban(roomID, user.ID, target.ID, duration)
+	case websocket.ModerationUnban:
+		err = h.roomUsecase.Unban(roomID, user.ID, target.ID)
+	case websocket.ModerationMute:
+		sanction, err = h.roomUsecase.Mute(roomID, user.ID, target.ID, duration)
+	case websocket.ModerationUnmute:
+		err = h.roomUsecase.Unmute(roomID, user.ID, target.ID)
+	}
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+	if sanction != nil {
+		event.ExpiresAt = sanction.ExpiresAt
+	}
+
+	h.wsHub.BroadcastModeration(event)
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(event))
+}
+
+// SetTopic replaces the topic of a room and announces it to the room.
+func (h *RoomHandler) SetTopic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	roomID := r.URL.Query().Get("id")
+	if roomID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room id is required"))
+		return
+	}
+
+	var req dto.SetTopicRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("Invalid request body"))
+		return
+	}
+
+	room, err := h.roomUsecase.SetTopic(roomID, user.ID, req.Topic)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	h.wsHub.BroadcastEvent(room.ID, websocket.TypeRoomUpdated, "", websocket.RoomUpdatePayload{
+		RoomID:   room.ID,
+		Action:   websocket.RoomUpdateTopic,
+		UserID:   user.ID,
+		Username: user.Username,
+		Topic:    room.Topic,
+	})
+	if room.Topic == "" {
+		h.wsHub.BroadcastSystem(room.ID, user.Username+" cleared the topic")
+	} else {
+		h.wsHub.BroadcastSystem(room.ID, user.Username+" set the topic: "+room.Topic)
+	}
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(room))
+}
+
+func (h *RoomHandler) PinMessage(w http.ResponseWriter, r *http.Request) {
+	h.changePin(w, r, h.roomUsecase.PinMessage, websocket.RoomUpdatePin)
+}
+
+func (h *RoomHandler) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	h.changePin(w, r, h.roomUsecase.UnpinMessage, websocket.RoomUpdateUnpin)
+}
+
+// changePin pins or unpins the message named in the query and announces the
+// change to the room, recording it in the room's history as well.
+func (h *RoomHandler) changePin(
+	w http.ResponseWriter,
+	r *http.Request,
+	change func(roomID, userID, messageID string) (*domain.Room, *domain.Message, error),
+	action string,
+) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	query := r.URL.Query()
+	roomID := query.Get("id")
+	messageID := query.Get("message_id")
+	if roomID == "" || messageID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room id and message_id are required"))
+		return
+	}
+
+	room, message, err := change(roomID, user.ID, messageID)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	h.wsHub.BroadcastEvent(room.ID, websocket.TypeRoomUpdated, "", websocket.RoomUpdatePayload{
+		RoomID:   room.ID,
+		Action:   action,
+		UserID:   user.ID,
+		Username: user.Username,
+		Message:  message,
+	})
+
+	text := user.Username + " pinned a message"
+	if action == websocket.RoomUpdateUnpin {
+		text = user.Username + " unpinned a message"
+	}
+	if message.Username != "" {
+		text += " from " + message.Username
+	}
+	h.wsHub.BroadcastSystem(room.ID, text)
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(room))
+}
+
+// GetPins lists the pinned messages of a room in the order they were pinned.
+func (h *RoomHandler) GetPins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	roomID := r.URL.Query().Get("id")
+	if roomID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room id is required"))
+		return
+	}
+
+	messages, err := h.roomUsecase.GetPinnedMessages(roomID, user.ID)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(messages))
+}
+
+func (h *RoomHandler) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	invitations, err := h.roomUsecase.GetInvitations(user.ID)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(invitations))
+}
+
 func (h *RoomHandler) GetRoom(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
 	roomID := r.URL.Query().Get("id")
 	if roomID == "" {
 		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room id is required"))
 		return
 	}
 
-	room, err := h.roomUsecase.GetRoom(roomID)
+	room, err := h.roomUsecase.GetRoom(roomID, user.ID)
 	if err != nil {
-		respondJSON(w, http.StatusNotFound, dto.ErrorResponse(err.Error()))
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
 		return
 	}
 
 	respondJSON(w, http.StatusOK, dto.SuccessResponse(room))
 }
 
+// GetOnlineUsers lists the users connected to a room with their presence.
+func (h *RoomHandler) GetOnlineUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	roomID := r.URL.Query().Get("id")
+	if roomID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room id is required"))
+		return
+	}
+
+	if _, err := h.roomUsecase.GetRoom(roomID, user.ID); err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(h.wsHub.OnlineUsers(roomID)))
+}
+
+// MarkRead advances the caller's read marker in a room to the message with
+// the given seq, or to the newest message without one.
+func (h *RoomHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	roomID := r.URL.Query().Get("id")
+	if roomID == "" {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("room id is required"))
+		return
+	}
+
+	var seq int64
+	if seqStr := r.URL.Query().Get("seq"); seqStr != "" {
+		parsed, err := strconv.ParseInt(seqStr, 10, 64)
+		if err != nil || parsed < 0 {
+			respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("seq must be a non-negative integer"))
+			return
+		}
+		seq = parsed
+	}
+
+	marker, err := h.roomUsecase.MarkRead(roomID, user.ID, seq)
+	if err != nil {
+		respondJSON(w, errorStatus(err), dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, dto.SuccessResponse(marker))
+}
+
 func (h *RoomHandler) GetAllRooms(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	rooms, err := h.roomUsecase.GetAllRooms()
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse("authentication required"))
+		return
+	}
+
+	rooms, err := h.roomUsecase.GetAllRooms(user.ID)
 	if err != nil {
 		respondJSON(w, http.StatusInternalServerError, dto.ErrorResponse(err.Error()))
 		return
@@ -4,17 +4,21 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"gochat/internal/auth"
 	"gochat/internal/delivery/dto"
+	"gochat/internal/domain"
 	"gochat/internal/usecase"
 )
 
 type UserHandler struct {
 	userUsecase *usecase.UserUsecase
+	tokens      *auth.TokenManager
 }
 
-func NewUserHandler(userUsecase *usecase.UserUsecase) *UserHandler {
+func NewUserHandler(userUsecase *usecase.UserUsecase, tokens *auth.TokenManager) *UserHandler {
 	return &UserHandler{
 		userUsecase: userUsecase,
+		tokens:      tokens,
 	}
 }
 
@@ -30,13 +34,47 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userUsecase.RegisterUser(req.Username)
+	user, err := h.userUsecase.RegisterUser(req.Username, req.Password)
 	if err != nil {
 		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse(err.Error()))
 		return
 	}
 
-	respondJSON(w, http.StatusCreated, dto.SuccessResponse(user))
+	h.respondWithToken(w, http.StatusCreated, user)
+}
+
+func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req dto.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, dto.ErrorResponse("Invalid request body"))
+		return
+	}
+
+	user, err := h.userUsecase.Login(req.Username, req.Password)
+	if err != nil {
+		respondJSON(w, http.StatusUnauthorized, dto.ErrorResponse(err.Error()))
+		return
+	}
+
+	h.respondWithToken(w, http.StatusOK, user)
+}
+
+func (h *UserHandler) respondWithToken(w http.ResponseWriter, statusCode int, user *domain.User) {
+	token, err := h.tokens.Issue(user.ID)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, dto.ErrorResponse("failed to issue token"))
+		return
+	}
+
+	respondJSON(w, statusCode, dto.SuccessResponse(dto.AuthResponse{
+		User:  user,
+		Token: token,
+	}))
 }
 
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,68 @@
+package delivery
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"gochat/internal/auth"
+	"gochat/internal/delivery/dto"
+	"gochat/internal/usecase"
+)
+
+type AuthMiddleware struct {
+	tokens      *auth.TokenManager
+	userUsecase *usecase.UserUsecase
+}
+
+func NewAuthMiddleware(tokens *auth.TokenManager, userUsecase *usecase.UserUsecase) *AuthMiddleware {
+	return &AuthMiddleware{
+		tokens:      tokens,
+		userUsecase: userUsecase,
+	}
+}
+
+// Require resolves the session token to a user and stores it in the request
+// context. The token is read from the Authorization header, or from the
+// "token" query parameter for WebSocket clients that cannot set headers.
+func (m *AuthMiddleware) Require(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			respondUnauthorized(w, "authentication required")
+			return
+		}
+
+		userID, err := m.tokens.Verify(token)
+		if err != nil {
+			respondUnauthorized(w, err.Error())
+			return
+		}
+
+		user, err := m.userUsecase.GetUser(userID)
+		if err != nil {
+			respondUnauthorized(w, auth.ErrInvalidToken.Error())
+			return
+		}
+
+		next(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+
+	return r.URL.Query().Get("token")
+}
+
+func respondUnauthorized(w http.ResponseWriter, errMsg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = json.NewEncoder(w).Encode(dto.ErrorResponse(errMsg))
+}
@@ -12,6 +12,7 @@ type Router struct {
 	roomHandler    *handler.RoomHandler
 	messageHandler *handler.MessageHandler
 	wsHub          *websocket.Hub
+	authMiddleware *AuthMiddleware
 }
 
 func NewRouter(
@@ -19,32 +20,64 @@ func NewRouter(
 	roomHandler *handler.RoomHandler,
 	messageHandler *handler.MessageHandler,
 	wsHub *websocket.Hub,
+	authMiddleware *AuthMiddleware,
 ) *Router {
 	return &Router{
 		userHandler:    userHandler,
 		roomHandler:    roomHandler,
 		messageHandler: messageHandler,
 		wsHub:          wsHub,
+		authMiddleware: authMiddleware,
 	}
 }
 
 func (r *Router) SetupRoutes() http.Handler {
 	mux := http.NewServeMux()
+	requireAuth := r.authMiddleware.Require
 
 	mux.HandleFunc("/api/users/register", r.userHandler.RegisterUser)
+	mux.HandleFunc("/api/users/login", r.userHandler.Login)
 	mux.HandleFunc("/api/users/get", r.userHandler.GetUser)
 
-	mux.HandleFunc("/api/rooms/create", r.roomHandler.CreateRoom)
-	mux.HandleFunc("/api/rooms/get", r.roomHandler.GetRoom)
-	mux.HandleFunc("/api/rooms/all", r.roomHandler.GetAllRooms)
+	mux.HandleFunc("/api/rooms/create", requireAuth(r.roomHandler.CreateRoom))
+	mux.HandleFunc("/api/rooms/get", requireAuth(r.roomHandler.GetRoom))
+	mux.HandleFunc("/api/rooms/all", requireAuth(r.roomHandler.GetAllRooms))
+	mux.HandleFunc("/api/rooms/online", requireAuth(r.roomHandler.GetOnlineUsers))
+	mux.HandleFunc("/api/rooms/read", requireAuth(r.roomHandler.MarkRead))
+	mux.HandleFunc("/api/rooms/direct", requireAuth(r.roomHandler.OpenDirectRoom))
+	mux.HandleFunc("/api/rooms/invite", requireAuth(r.roomHandler.InviteUser))
+	mux.HandleFunc("/api/rooms/accept", requireAuth(r.roomHandler.AcceptInvitation))
+	mux.HandleFunc("/api/rooms/leave", requireAuth(r.roomHandler.LeaveRoom))
+	mux.HandleFunc("/api/rooms/invitations", requireAuth(r.roomHandler.GetInvitations))
+	mux.HandleFunc("/api/rooms/role", requireAuth(r.roomHandler.SetRole))
+	mux.HandleFunc("/api/rooms/kick", requireAuth(r.roomHandler.Kick))
+	mux.HandleFunc("/api/rooms/ban", requireAuth(r.roomHandler.Ban))
+	mux.HandleFunc("/api/rooms/unban", requireAuth(r.roomHandler.Unban))
+	mux.HandleFunc("/api/rooms/mute", requireAuth(r.roomHandler.Mute))
+	mux.HandleFunc("/api/rooms/unmute", requireAuth(r.roomHandler.Unmute))
+	mux.HandleFunc("/api/rooms/topic", requireAuth(r.roomHandler.SetTopic))
+	mux.HandleFunc("/api/rooms/pin", requireAuth(r.roomHandler.PinMessage))
+	mux.HandleFunc("/api/rooms/unpin", requireAuth(r.roomHandler.UnpinMessage))
+	mux.HandleFunc("/api/rooms/pins", requireAuth(r.roomHandler.GetPins))
 
-	mux.HandleFunc("/api/messages/send", r.messageHandler.SendMessage)
-	mux.HandleFunc("/api/messages/history", r.messageHandler.GetMessagesHistory)
+	mux.HandleFunc("/api/messages/send", requireAuth(r.messageHandler.SendMessage))
+	mux.HandleFunc("/api/messages/edit", requireAuth(r.messageHandler.EditMessage))
+	mux.HandleFunc("/api/messages/delete", requireAuth(r.messageHandler.DeleteMessage))
+	mux.HandleFunc("/api/messages/reactions/add", requireAuth(r.messageHandler.AddReaction))
+	mux.HandleFunc("/api/messages/reactions/remove", requireAuth(r.messageHandler.RemoveReaction))
+	mux.HandleFunc("/api/messages/history", requireAuth(r.messageHandler.GetMessagesHistory))
+	mux.HandleFunc("/api/messages/thread", requireAuth(r.messageHandler.GetThread))
+	mux.HandleFunc("/api/messages/search", requireAuth(r.messageHandler.SearchMessages))
+	mux.HandleFunc("/api/messages/upload", requireAuth(r.messageHandler.UploadAttachment))
+	mux.HandleFunc("/api/messages/attachment", requireAuth(r.messageHandler.DownloadAttachment))
+
+	mux.HandleFunc("/api/notifications", requireAuth(r.messageHandler.GetNotifications))
+	mux.HandleFunc("/api/notifications/seen", requireAuth(r.messageHandler.MarkNotificationsSeen))
 
 	wsHub := r.wsHub
-	mux.HandleFunc("/ws", func(w http.ResponseWriter, req *http.Request) {
+	mux.HandleFunc("/ws", requireAuth(func(w http.ResponseWriter, req *http.Request) {
 		websocket.ServeWS(wsHub, w, req)
-	})
+	}))
 
 	return mux
 }
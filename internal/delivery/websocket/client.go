@@ -1,31 +1,61 @@
 package websocket
 
 import (
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"gochat/internal/domain"
 )
 
 const (
 	writeWait      = 10 * time.Second
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
+	maxMessageSize = 4096
+
+	replayBatchSize = 100
 )
 
+type outbound struct {
+	data   []byte
+	roomID string
+	// seq is the Seq of the chat message carried by data, or 0 for frames
+	// that are not part of the room's message stream.
+	seq int64
+
+	// replay asks the write pump to send the messages of roomID after seq
+	// before anything queued behind it; data is empty in that case.
+	replay bool
+}
+
 type Client struct {
-	hub    *Hub
-	conn   *websocket.Conn
-	send   chan []byte
+	hub  *Hub
+	conn *websocket.Conn
+	send chan outbound
+	// roomID is the room given when connecting. It is the target of message
+	// frames that do not name a room.
 	roomID string
 	userID string
+	// id tells the user's connections apart for presence tracking.
+	id       string
+	username string
+
+	// rooms is the set of rooms the client is subscribed to. It is owned by
+	// the hub and guarded by hub.mu.
+	rooms map[string]bool
+
+	// closeMessage is written as the close frame once send is closed. The hub
+	// sets it before closing send; an empty value means a plain close.
+	closeMessage []byte
 }
 
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.unregisterClient(c)
 		c.conn.Close()
+		c.hub.pumps.Done()
 	}()
 
 	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -36,14 +66,166 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
+
+		c.handleInbound(data)
+	}
+}
+
+func (c *Client) handleInbound(data []byte) {
+	env, err := DecodeEnvelope(data)
+	if err != nil {
+		c.sendError("", err.Error())
+		return
+	}
+
+	switch env.Type {
+	case TypeMessage:
+		c.handleSendMessage(env)
+	case TypeSubscribe:
+		c.handleSubscribe(env)
+	case TypeUnsubscribe:
+		c.handleUnsubscribe(env)
+	case TypePresence:
+		c.handlePresence(env)
+	case TypeTyping:
+		c.handleTyping(env)
+	case TypePing:
+		c.sendEnvelope(TypePong, env.ID, nil)
+	default:
+		c.sendError(env.ID, fmt.Sprintf("unsupported frame type %q", env.Type))
+	}
+}
+
+func (c *Client) handleSendMessage(env *Envelope) {
+	var payload SendMessagePayload
+	if err := env.DecodePayload(&payload); err != nil {
+		c.sendError(env.ID, err.Error())
+		return
+	}
+
+	roomID := payload.RoomID
+	if roomID == "" {
+		roomID = c.roomID
+	}
+	if roomID == "" {
+		c.sendError(env.ID, "room_id is required")
+		return
+	}
+
+	var (
+		message *domain.Message
+		err     error
+	)
+	if payload.ParentID != "" {
+		message, err = c.hub.messageUsecase.SendReply(roomID, payload.ParentID, c.userID, payload.Content)
+	} else {
+		message, err = c.hub.messageUsecase.SendMessage(roomID, c.userID, payload.Content)
+	}
+	if err != nil {
+		c.sendError(env.ID, err.Error())
+		return
+	}
+
+	c.sendEnvelope(TypeAck, env.ID, message)
+	c.hub.BroadcastMessage(roomID, message)
+}
+
+func (c *Client) handleSubscribe(env *Envelope) {
+	var payload SubscriptionPayload
+	if err := env.DecodePayload(&payload); err != nil {
+		c.sendError(env.ID, err.Error())
+		return
+	}
+
+	if payload.RoomID == "" {
+		c.sendError(env.ID, "room_id is required")
+		return
+	}
+	if err := c.hub.messageUsecase.CheckRoomAccess(payload.RoomID, c.userID); err != nil {
+		c.sendError(env.ID, err.Error())
+		return
+	}
+
+	sinceSeq := int64(-1)
+	if payload.SinceSeq != nil {
+		if *payload.SinceSeq < 0 {
+			c.sendError(env.ID, "since_seq must be a non-negative integer")
+			return
+		}
+		sinceSeq = *payload.SinceSeq
+	}
+
+	c.hub.subscribeClient(&Subscription{Client: c, RoomID: payload.RoomID, FrameID: env.ID, SinceSeq: sinceSeq})
+}
+
+func (c *Client) handleUnsubscribe(env *Envelope) {
+	var payload SubscriptionPayload
+	if err := env.DecodePayload(&payload); err != nil {
+		c.sendError(env.ID, err.Error())
+		return
+	}
+
+	if payload.RoomID == "" {
+		c.sendError(env.ID, "room_id is required")
+		return
+	}
+
+	c.hub.unsubscribeClient(&Subscription{Client: c, RoomID: payload.RoomID, FrameID: env.ID})
+}
+
+func (c *Client) handlePresence(env *Envelope) {
+	var payload StatusPayload
+	if err := env.DecodePayload(&payload); err != nil {
+		c.sendError(env.ID, err.Error())
+		return
+	}
+
+	if payload.Status != domain.PresenceAway && payload.Status != domain.PresenceOnline {
+		c.sendError(env.ID, `status must be "away" or "online"`)
+		return
+	}
+
+	c.hub.setStatus(&StatusChange{Client: c, FrameID: env.ID, Away: payload.Status == domain.PresenceAway})
+}
+
+func (c *Client) handleTyping(env *Envelope) {
+	var payload TypingPayload
+	if err := env.DecodePayload(&payload); err != nil {
+		c.sendError(env.ID, err.Error())
+		return
+	}
+
+	roomID := payload.RoomID
+	if roomID == "" {
+		roomID = c.roomID
+	}
+	if roomID == "" {
+		c.sendError(env.ID, "room_id is required")
+		return
+	}
+
+	c.hub.notifyTyping(&TypingNotice{Client: c, RoomID: roomID, FrameID: env.ID})
+}
+
+func (c *Client) sendError(id, errMsg string) {
+	c.sendEnvelope(TypeError, id, ErrorPayload{Message: errMsg})
+}
+
+func (c *Client) sendEnvelope(eventType, id string, payload interface{}) {
+	data, err := EncodeFrame(eventType, id, payload)
+	if err != nil {
+		log.Printf("Error building %s frame: %v", eventType, err)
+		return
 	}
+
+	c.hub.sendToClient(c, data)
 }
 
 func (c *Client) writePump() {
@@ -51,18 +233,46 @@ func (c *Client) writePump() {
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		c.hub.pumps.Done()
 	}()
 
+	// lastSeq holds, per room, the newest message written by a replay.
+	lastSeq := make(map[string]int64)
+
 	for {
 		select {
 		case message, ok := <-c.send:
 			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeMessage := c.closeMessage
+				if closeMessage == nil {
+					closeMessage = []byte{}
+				}
+				_ = c.conn.WriteMessage(websocket.CloseMessage, closeMessage)
 				return
 			}
 
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			if message.replay {
+				seq, err := c.replay(message.roomID, message.seq)
+				if err != nil {
+					log.Printf("Replay for %s in room %s failed: %v", c.userID, message.roomID, err)
+					if data, encErr := EncodeFrame(TypeError, "", ErrorPayload{Message: err.Error()}); encErr == nil {
+						_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+						_ = c.conn.WriteMessage(websocket.TextMessage, data)
+					}
+					return
+				}
+				lastSeq[message.roomID] = seq
+				continue
+			}
+
+			// Live broadcasts queued while the replay was running may repeat
+			// messages the replay already delivered.
+			if message.seq != 0 && message.seq <= lastSeq[message.roomID] {
+				continue
+			}
+
+			if err := c.conn.WriteMessage(websocket.TextMessage, message.data); err != nil {
 				return
 			}
 
@@ -74,3 +284,36 @@ func (c *Client) writePump() {
 		}
 	}
 }
+
+// replay writes every message of the room after sinceSeq straight to the
+// connection and returns the Seq of the last one written. The hub queues the
+// replay request only after subscribing the client to the room, so anything
+// stored after the replay's final read is already queued on c.send; together
+// they leave no gap.
+func (c *Client) replay(roomID string, sinceSeq int64) (int64, error) {
+	lastSeq := sinceSeq
+
+	for {
+		messages, err := c.hub.messageUsecase.GetMessagesSince(roomID, lastSeq, replayBatchSize)
+		if err != nil {
+			return lastSeq, err
+		}
+
+		for _, message := range messages {
+			data, err := EncodeFrame(TypeMessage, message.ID, message)
+			if err != nil {
+				return lastSeq, err
+			}
+
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return lastSeq, err
+			}
+			lastSeq = message.Seq
+		}
+
+		if len(messages) < replayBatchSize {
+			return lastSeq, nil
+		}
+	}
+}
@@ -1,10 +1,16 @@
 package websocket
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"gochat/internal/auth"
+	"gochat/internal/usecase"
 )
 
 var upgrader = websocket.Upgrader{
@@ -16,13 +22,39 @@ var upgrader = websocket.Upgrader{
 }
 
 func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	// room_id is optional: a client may connect without one and subscribe
+	// to rooms later over the socket.
 	roomID := r.URL.Query().Get("room_id")
-	userID := r.URL.Query().Get("user_id")
 
-	if roomID == "" || userID == "" {
-		http.Error(w, "room_id and user_id are required", http.StatusBadRequest)
+	sinceSeq := int64(-1)
+	if sinceStr := r.URL.Query().Get("since_seq"); sinceStr != "" {
+		parsed, err := strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "since_seq must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		sinceSeq = parsed
+	}
+	if sinceSeq >= 0 && roomID == "" {
+		http.Error(w, "since_seq requires room_id", http.StatusBadRequest)
 		return
 	}
+	if roomID != "" {
+		if err := hub.messageUsecase.CheckRoomAccess(roomID, user.ID); err != nil {
+			status := http.StatusForbidden
+			if errors.Is(err, usecase.ErrRoomNotFound) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -31,15 +63,42 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	}
 
 	client := &Client{
-		hub:    hub,
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		roomID: roomID,
-		userID: userID,
+		hub:      hub,
+		conn:     conn,
+		send:     make(chan outbound, 256),
+		roomID:   roomID,
+		userID:   user.ID,
+		id:       uuid.New().String(),
+		username: user.Username,
+		rooms:    make(map[string]bool),
+	}
+	if roomID != "" {
+		client.rooms[roomID] = true
+		if sinceSeq >= 0 {
+			// Nothing else can be queued yet, so the replay runs before any
+			// live frame the hub delivers once the client is registered.
+			client.send <- outbound{roomID: roomID, seq: sinceSeq, replay: true}
+		}
 	}
 
-	client.hub.register <- client
+	// Count the pumps before registering so that Stop cannot finish waiting
+	// between the hub accepting the client and the pumps starting.
+	if !hub.trackPumps() {
+		rejectGoingAway(conn)
+		return
+	}
+	if !hub.registerClient(client) {
+		hub.pumps.Add(-2)
+		rejectGoingAway(conn)
+		return
+	}
 
 	go client.writePump()
 	go client.readPump()
 }
+
+func rejectGoingAway(conn *websocket.Conn) {
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	_ = conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(writeWait))
+	conn.Close()
+}
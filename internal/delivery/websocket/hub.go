@@ -1,111 +1,868 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"sync"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"gochat/internal/domain"
+	"gochat/internal/usecase"
+)
+
+const (
+	// maxRoomsPerClient caps how many rooms a single connection may follow.
+	maxRoomsPerClient = 50
+
+	// defaultTypingTimeout is how long a typing indicator lasts without a
+	// new typing frame; typingSweepPeriod is how often expired ones are
+	// cleared.
+	defaultTypingTimeout = 5 * time.Second
+	typingSweepPeriod    = time.Second
+
+	// defaultLeaveGrace is how long a user has to stay out of a room before
+	// the system message saying they left is posted, so that reconnecting
+	// does not fill the history with comings and goings.
+	defaultLeaveGrace = 15 * time.Second
 )
 
 type Hub struct {
-	rooms      map[string]map[*Client]bool
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan *RoomMessage
-	mu         sync.RWMutex
+	clients        map[*Client]bool
+	rooms          map[string]map[*Client]bool
+	users          map[string]map[*Client]bool
+	typists        map[string]map[string]*typist
+	departures     map[string]map[string]*time.Timer
+	register       chan *Client
+	unregister     chan *Client
+	subscribe      chan *Subscription
+	unsubscribe    chan *Subscription
+	broadcast      chan *RoomMessage
+	direct         chan *ClientMessage
+	toUser         chan *UserMessage
+	statuses       chan *StatusChange
+	typing         chan *TypingNotice
+	quit           chan struct{}
+	done           chan struct{}
+	stopOnce       sync.Once
+	stopped        bool
+	pumps          sync.WaitGroup
+	messageUsecase *usecase.MessageUsecase
+	presence       *usecase.PresenceUsecase
+	typingTimeout  time.Duration
+	// systemMessages turns on the system messages recording users entering
+	// and leaving rooms; leaveGrace debounces the leaving ones.
+	systemMessages bool
+	leaveGrace     time.Duration
+	mu             sync.RWMutex
 }
 
 type RoomMessage struct {
+	RoomID   string
+	Envelope *Envelope
+	// Seq is the sequence number of the chat message being broadcast, or 0
+	// for events that are not part of the room's message stream.
+	Seq int64
+	// Sender is the author of the chat message being broadcast; their typing
+	// indicator in the room ends with it.
+	Sender string
+	// Recipients are users whose connections are subscribed to the room
+	// before delivery, so that a direct message reaches its recipient
+	// without a prior subscribe.
+	Recipients []string
+	// Evict are users whose connections leave the room once the envelope,
+	// if any, has been delivered, so that they still see why they left.
+	Evict []string
+}
+
+type ClientMessage struct {
+	Client *Client
+	Data   []byte
+}
+
+// UserMessage is delivered to every connection of a user.
+type UserMessage struct {
+	UserID string
+	Data   []byte
+}
+
+// StatusChange marks a client away or active again.
+type StatusChange struct {
+	Client  *Client
+	FrameID string
+	Away    bool
+}
+
+// TypingNotice reports that a client's user is typing in a room.
+type TypingNotice struct {
+	Client  *Client
 	RoomID  string
-	Message *domain.Message
+	FrameID string
+}
+
+// typist is a user shown as typing in a room until expires.
+type typist struct {
+	username string
+	expires  time.Time
+}
+
+// Subscription adds a client to a room or removes it from one.
+type Subscription struct {
+	Client *Client
+	RoomID string
+	// FrameID is the ID of the client frame that asked for the change; the
+	// ack or error sent back echoes it.
+	FrameID string
+	// SinceSeq replays the room's messages after it once subscribed. A
+	// negative value skips the replay.
+	SinceSeq int64
 }
 
-func NewHub() *Hub {
+var slowClientClose = websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client too slow, reconnect with since_seq")
+
+func NewHub(messageUsecase *usecase.MessageUsecase, presence *usecase.PresenceUsecase) *Hub {
 	return &Hub{
-		rooms:      make(map[string]map[*Client]bool),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan *RoomMessage, 256),
+		clients:        make(map[*Client]bool),
+		rooms:          make(map[string]map[*Client]bool),
+		users:          make(map[string]map[*Client]bool),
+		typists:        make(map[string]map[string]*typist),
+		departures:     make(map[string]map[string]*time.Timer),
+		register:       make(chan *Client),
+		unregister:     make(chan *Client),
+		subscribe:      make(chan *Subscription),
+		unsubscribe:    make(chan *Subscription),
+		broadcast:      make(chan *RoomMessage, 256),
+		direct:         make(chan *ClientMessage, 256),
+		toUser:         make(chan *UserMessage, 256),
+		statuses:       make(chan *StatusChange),
+		typing:         make(chan *TypingNotice, 256),
+		quit:           make(chan struct{}),
+		done:           make(chan struct{}),
+		messageUsecase: messageUsecase,
+		presence:       presence,
+		typingTimeout:  defaultTypingTimeout,
+		systemMessages: true,
+		leaveGrace:     defaultLeaveGrace,
 	}
 }
 
 func (h *Hub) Run() {
+	defer close(h.done)
+
+	typingSweep := time.NewTicker(typingSweepPeriod)
+	defer typingSweep.Stop()
+
 	for {
 		select {
+		case <-h.quit:
+			h.closeAll()
+			return
+
 		case client := <-h.register:
 			h.mu.Lock()
-			if h.rooms[client.roomID] == nil {
-				h.rooms[client.roomID] = make(map[*Client]bool)
+			h.clients[client] = true
+			if h.users[client.userID] == nil {
+				h.users[client.userID] = make(map[*Client]bool)
+			}
+			h.users[client.userID][client] = true
+			if presence, changed := h.presence.Connect(client.userID, client.username, client.id); changed {
+				h.announceStatus(presence, client)
 			}
-			h.rooms[client.roomID][client] = true
+			for roomID := range client.rooms {
+				h.joinRoom(client, roomID)
+			}
+			total := len(h.clients)
 			h.mu.Unlock()
-			log.Printf("Client registered to room: %s (total: %d)", client.roomID, len(h.rooms[client.roomID]))
+			log.Printf("Client %s registered to %d room(s) (total clients: %d)", client.userID, len(client.rooms), total)
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if room, ok := h.rooms[client.roomID]; ok {
-				if _, ok := room[client]; ok {
-					delete(room, client)
-					close(client.send)
-					if len(room) == 0 {
-						delete(h.rooms, client.roomID)
-					}
-				}
-			}
+			h.removeClient(client, nil)
+			h.mu.Unlock()
+			log.Printf("Client %s unregistered", client.userID)
+
+		case sub := <-h.subscribe:
+			h.mu.Lock()
+			h.addSubscription(sub)
+			h.mu.Unlock()
+
+		case sub := <-h.unsubscribe:
+			h.mu.Lock()
+			h.removeSubscription(sub)
 			h.mu.Unlock()
-			log.Printf("Client unregistered from room: %s", client.roomID)
 
 		case message := <-h.broadcast:
-			h.mu.RLock()
-			room, exists := h.rooms[message.RoomID]
-			if !exists {
-				h.mu.RUnlock()
-				log.Printf("Room %s does not exist for broadcast", message.RoomID)
-				continue
+			if len(message.Recipients) > 0 {
+				h.mu.Lock()
+				h.addRecipients(message)
+				h.mu.Unlock()
 			}
 
-			data, err := json.Marshal(message.Message)
-			if err != nil {
-				log.Printf("Error marshaling message: %v", err)
-				h.mu.RUnlock()
-				continue
+			if message.Sender != "" {
+				h.mu.Lock()
+				h.stopTyping(message.RoomID, message.Sender)
+				h.mu.Unlock()
 			}
 
-			clientsToRemove := make([]*Client, 0)
-			for client := range room {
-				select {
-				case client.send <- data:
-				default:
-					clientsToRemove = append(clientsToRemove, client)
-				}
+			if message.Envelope != nil {
+				h.deliver(message)
 			}
-			h.mu.RUnlock()
 
-			if len(clientsToRemove) > 0 {
+			if len(message.Evict) > 0 {
 				h.mu.Lock()
-				for _, client := range clientsToRemove {
-					if room, ok := h.rooms[message.RoomID]; ok {
-						if _, ok := room[client]; ok {
-							close(client.send)
-							delete(room, client)
-							if len(room) == 0 {
-								delete(h.rooms, message.RoomID)
-							}
-						}
+				h.evict(message)
+				h.mu.Unlock()
+			}
+
+		case message := <-h.direct:
+			h.mu.Lock()
+			h.queue(message.Client, outbound{data: message.Data})
+			h.mu.Unlock()
+
+		case change := <-h.statuses:
+			h.mu.Lock()
+			if h.clients[change.Client] {
+				presence, changed := h.presence.SetAway(change.Client.userID, change.Client.id, change.Away)
+				if changed {
+					h.announceStatus(presence, nil)
+				}
+				h.queueFrame(change.Client, TypeAck, change.FrameID, StatusPayload{Status: presence.Status})
+			}
+			h.mu.Unlock()
+
+		case notice := <-h.typing:
+			h.mu.Lock()
+			h.startTyping(notice)
+			h.mu.Unlock()
+
+		case now := <-typingSweep.C:
+			h.mu.Lock()
+			for roomID, typists := range h.typists {
+				for userID, typist := range typists {
+					if now.After(typist.expires) {
+						h.stopTyping(roomID, userID)
 					}
 				}
-				h.mu.Unlock()
 			}
+			h.mu.Unlock()
+
+		case message := <-h.toUser:
+			h.mu.Lock()
+			for client := range h.users[message.UserID] {
+				h.queue(client, outbound{data: message.Data})
+			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// Stop tells every connected client that the server is going away and waits
+// until all of their pumps and pending system messages are done or ctx is.
+func (h *Hub) Stop(ctx context.Context) error {
+	h.stopOnce.Do(func() {
+		close(h.quit)
+	})
+
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	pumpsDone := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(pumpsDone)
+	}()
+
+	select {
+	case <-pumpsDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.stopped = true
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+
+	total := len(h.clients)
+	for client := range h.clients {
+		client.closeMessage = closeMessage
+		close(client.send)
+		delete(h.clients, client)
+	}
+	for roomID := range h.rooms {
+		delete(h.rooms, roomID)
+	}
+	for roomID, timers := range h.departures {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+		delete(h.departures, roomID)
+	}
+
+	log.Printf("Hub stopped, closed %d client(s)", total)
+}
+
+// removeClient detaches client from all of its rooms and closes its send
+// channel so that the write pump sends closeMessage and exits. h.mu must be
+// held.
+func (h *Hub) removeClient(client *Client, closeMessage []byte) {
+	if !h.clients[client] {
+		return
+	}
+
+	// Drop the client first so that nothing is queued to it from here on.
+	delete(h.clients, client)
+	if connections, ok := h.users[client.userID]; ok {
+		delete(connections, client)
+		if len(connections) == 0 {
+			delete(h.users, client.userID)
+		}
+	}
+
+	presence, changed := h.presence.Disconnect(client.userID, client.id)
+	for roomID := range client.rooms {
+		h.leaveRoom(client, roomID)
+	}
+	if changed && presence.Status != domain.PresenceOffline {
+		h.announceStatus(presence, nil)
+	}
+
+	client.closeMessage = closeMessage
+	close(client.send)
+}
+
+// deliver fans the message's envelope out to the room's clients, dropping
+// those that cannot keep up.
+func (h *Hub) deliver(message *RoomMessage) {
+	h.mu.RLock()
+	room, exists := h.rooms[message.RoomID]
+	if !exists {
+		h.mu.RUnlock()
+		log.Printf("Room %s does not exist for broadcast", message.RoomID)
+		return
+	}
+
+	data, err := json.Marshal(message.Envelope)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		h.mu.RUnlock()
+		return
+	}
+
+	frame := outbound{data: data, roomID: message.RoomID, seq: message.Seq}
+	clientsToRemove := make([]*Client, 0)
+	for client := range room {
+		select {
+		case client.send <- frame:
+		default:
+			clientsToRemove = append(clientsToRemove, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	if len(clientsToRemove) > 0 {
+		h.mu.Lock()
+		for _, client := range clientsToRemove {
+			log.Printf("Dropping slow client %s from room %s", client.userID, message.RoomID)
+			h.removeClient(client, slowClientClose)
+		}
+		h.mu.Unlock()
+	}
+
+	log.Printf("Broadcasted message to room %s (%d clients)", message.RoomID, len(room)-len(clientsToRemove))
+}
+
+// evict unsubscribes every connection of the message's evicted users from
+// its room. h.mu must be held.
+func (h *Hub) evict(message *RoomMessage) {
+	for _, userID := range message.Evict {
+		for client := range h.users[userID] {
+			if client.rooms[message.RoomID] {
+				h.leaveRoom(client, message.RoomID)
+				log.Printf("Client %s removed from room %s", client.userID, message.RoomID)
+			}
+		}
+	}
+}
 
-			log.Printf("Broadcasted message to room %s (%d clients)", message.RoomID, len(room)-len(clientsToRemove))
+// addRecipients subscribes every connection of the message's recipients to
+// its room. h.mu must be held.
+func (h *Hub) addRecipients(message *RoomMessage) {
+	for _, userID := range message.Recipients {
+		for client := range h.users[userID] {
+			if client.rooms[message.RoomID] || len(client.rooms) >= maxRoomsPerClient {
+				continue
+			}
+			h.joinRoom(client, message.RoomID)
+			log.Printf("Client %s joined room %s as a recipient", client.userID, message.RoomID)
 		}
 	}
 }
 
+// queue puts frame on the client's send buffer, dropping the client if the
+// buffer is full. h.mu must be held.
+func (h *Hub) queue(client *Client, frame outbound) bool {
+	if !h.clients[client] {
+		return false
+	}
+
+	select {
+	case client.send <- frame:
+		return true
+	default:
+		log.Printf("Dropping slow client %s", client.userID)
+		h.removeClient(client, slowClientClose)
+		return false
+	}
+}
+
+// joinRoom adds client to the room, announcing the user to the room unless
+// another of their connections is already in it. h.mu must be held.
+func (h *Hub) joinRoom(client *Client, roomID string) {
+	if h.rooms[roomID][client] {
+		return
+	}
+
+	present := h.userInRoom(client.userID, roomID, client)
+	client.rooms[roomID] = true
+	if h.rooms[roomID] == nil {
+		h.rooms[roomID] = make(map[*Client]bool)
+	}
+	h.rooms[roomID][client] = true
+
+	if !present {
+		h.announcePresence(TypePresenceJoined, roomID, h.presence.Get(client.userID))
+		h.recordArrival(roomID, client.userID, client.username)
+	}
+}
+
+// leaveRoom takes client out of the room, announcing that the user left if
+// it was their last connection in it. h.mu must be held.
+func (h *Hub) leaveRoom(client *Client, roomID string) {
+	if !client.rooms[roomID] {
+		return
+	}
+
+	delete(client.rooms, roomID)
+	if room, ok := h.rooms[roomID]; ok {
+		delete(room, client)
+		if len(room) == 0 {
+			delete(h.rooms, roomID)
+		}
+	}
+
+	if !h.userInRoom(client.userID, roomID, client) {
+		h.stopTyping(roomID, client.userID)
+		h.announcePresence(TypePresenceLeft, roomID, h.presence.Get(client.userID))
+		h.recordDeparture(roomID, client.userID, client.username)
+	}
+}
+
+// recordArrival posts a system message saying that the user entered the
+// room, unless they are back before their leaving was recorded. h.mu must be
+// held.
+func (h *Hub) recordArrival(roomID, userID, username string) {
+	if !h.systemMessages {
+		return
+	}
+
+	if timer, pending := h.departures[roomID][userID]; pending {
+		timer.Stop()
+		h.forgetDeparture(roomID, userID)
+		return
+	}
+	h.postSystem(roomID, username+" entered the room")
+}
+
+// recordDeparture posts a system message saying that the user left the room
+// once they have stayed out of it for h.leaveGrace. h.mu must be held.
+func (h *Hub) recordDeparture(roomID, userID, username string) {
+	if !h.systemMessages {
+		return
+	}
+
+	if h.departures[roomID] == nil {
+		h.departures[roomID] = make(map[string]*time.Timer)
+	} else if timer, pending := h.departures[roomID][userID]; pending {
+		timer.Stop()
+	}
+
+	// The timer is stored before its function can take h.mu, so the check
+	// below tells a stopped or replaced timer that fired anyway to do nothing.
+	var timer *time.Timer
+	timer = time.AfterFunc(h.leaveGrace, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if h.departures[roomID][userID] == timer {
+			h.forgetDeparture(roomID, userID)
+			h.postSystem(roomID, username+" left the room")
+		}
+	})
+	h.departures[roomID][userID] = timer
+}
+
+// forgetDeparture drops the pending departure of the user from the room.
+// h.mu must be held.
+func (h *Hub) forgetDeparture(roomID, userID string) {
+	delete(h.departures[roomID], userID)
+	if len(h.departures[roomID]) == 0 {
+		delete(h.departures, roomID)
+	}
+}
+
+// postSystem records a user entering or leaving a room in the background,
+// since the broadcast waits on Run. Stop waits for it like for the pumps, so
+// that nothing is stored once the hub is down. Direct rooms are left out.
+// h.mu must be held.
+func (h *Hub) postSystem(roomID, text string) {
+	if h.stopped {
+		return
+	}
+
+	h.pumps.Add(1)
+	go func() {
+		defer h.pumps.Done()
+
+		if h.messageUsecase.DirectParticipants(roomID) == nil {
+			h.BroadcastSystem(roomID, text)
+		}
+	}()
+}
+
+// startTyping shows the notice's user as typing in its room, telling the
+// room if they were not already. h.mu must be held.
+func (h *Hub) startTyping(notice *TypingNotice) {
+	client := notice.Client
+	if !h.clients[client] {
+		return
+	}
+	if !client.rooms[notice.RoomID] {
+		h.queueFrame(client, TypeError, notice.FrameID, ErrorPayload{Message: "not subscribed to this room"})
+		return
+	}
+
+	typists := h.typists[notice.RoomID]
+	if typists == nil {
+		typists = make(map[string]*typist)
+		h.typists[notice.RoomID] = typists
+	}
+
+	expires := time.Now().Add(h.typingTimeout)
+	if current, ok := typists[client.userID]; ok {
+		current.expires = expires
+		return
+	}
+
+	typists[client.userID] = &typist{username: client.username, expires: expires}
+	h.announceTyping(TypeTypingStarted, notice.RoomID, client.userID, client.username)
+}
+
+// stopTyping ends the typing indicator of userID in the room, if any. h.mu
+// must be held.
+func (h *Hub) stopTyping(roomID, userID string) {
+	current, ok := h.typists[roomID][userID]
+	if !ok {
+		return
+	}
+
+	delete(h.typists[roomID], userID)
+	if len(h.typists[roomID]) == 0 {
+		delete(h.typists, roomID)
+	}
+	h.announceTyping(TypeTypingStopped, roomID, userID, current.username)
+}
+
+// announceTyping sends a typing event to the room's connections other than
+// the typist's own. h.mu must be held.
+func (h *Hub) announceTyping(eventType, roomID, userID, username string) {
+	data, err := EncodeFrame(eventType, "", TypingPayload{RoomID: roomID, UserID: userID, Username: username})
+	if err != nil {
+		log.Printf("Error building %s frame: %v", eventType, err)
+		return
+	}
+
+	for client := range h.rooms[roomID] {
+		if client.userID != userID {
+			h.queue(client, outbound{data: data})
+		}
+	}
+}
+
+// userInRoom reports whether a connection of userID other than except is in
+// the room. h.mu must be held.
+func (h *Hub) userInRoom(userID, roomID string, except *Client) bool {
+	for client := range h.users[userID] {
+		if client != except && h.rooms[roomID][client] {
+			return true
+		}
+	}
+	return false
+}
+
+// announceStatus tells every room the user is in, through connections other
+// than except, about their new status. h.mu must be held.
+func (h *Hub) announceStatus(presence *domain.Presence, except *Client) {
+	rooms := make(map[string]bool)
+	for client := range h.users[presence.UserID] {
+		if client == except {
+			continue
+		}
+		for roomID := range client.rooms {
+			rooms[roomID] = true
+		}
+	}
+
+	for roomID := range rooms {
+		h.announcePresence(TypePresenceChanged, roomID, presence)
+	}
+}
+
+// announcePresence sends a presence event to the room's connections, except
+// those of the user it is about. h.mu must be held.
+func (h *Hub) announcePresence(eventType, roomID string, presence *domain.Presence) {
+	data, err := EncodeFrame(eventType, "", PresencePayload{RoomID: roomID, Presence: *presence})
+	if err != nil {
+		log.Printf("Error building %s frame: %v", eventType, err)
+		return
+	}
+
+	for client := range h.rooms[roomID] {
+		if client.userID != presence.UserID {
+			h.queue(client, outbound{data: data})
+		}
+	}
+}
+
+func (h *Hub) addSubscription(sub *Subscription) {
+	client := sub.Client
+	if !h.clients[client] {
+		return
+	}
+
+	if !client.rooms[sub.RoomID] && len(client.rooms) >= maxRoomsPerClient {
+		h.queueFrame(client, TypeError, sub.FrameID, ErrorPayload{
+			Message: fmt.Sprintf("cannot subscribe to more than %d rooms", maxRoomsPerClient),
+		})
+		return
+	}
+
+	h.joinRoom(client, sub.RoomID)
+	log.Printf("Client %s subscribed to room %s", client.userID, sub.RoomID)
+
+	// The ack goes out before any replayed messages so the client knows the
+	// subscription is live by the time history starts arriving.
+	if !h.queueFrame(client, TypeAck, sub.FrameID, SubscriptionPayload{RoomID: sub.RoomID}) {
+		return
+	}
+	if sub.SinceSeq >= 0 {
+		h.queue(client, outbound{roomID: sub.RoomID, seq: sub.SinceSeq, replay: true})
+	}
+}
+
+func (h *Hub) removeSubscription(sub *Subscription) {
+	client := sub.Client
+	if !h.clients[client] {
+		return
+	}
+
+	h.leaveRoom(client, sub.RoomID)
+	log.Printf("Client %s unsubscribed from room %s", client.userID, sub.RoomID)
+
+	h.queueFrame(client, TypeAck, sub.FrameID, SubscriptionPayload{RoomID: sub.RoomID})
+}
+
+func (h *Hub) queueFrame(client *Client, eventType, id string, payload interface{}) bool {
+	data, err := EncodeFrame(eventType, id, payload)
+	if err != nil {
+		log.Printf("Error building %s frame: %v", eventType, err)
+		return false
+	}
+
+	return h.queue(client, outbound{data: data})
+}
+
+// trackPumps reserves the read and write pump of a new client in the wait
+// group used by Stop. It fails once the hub has started shutting down.
+func (h *Hub) trackPumps() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.stopped {
+		return false
+	}
+
+	h.pumps.Add(2)
+	return true
+}
+
+func (h *Hub) registerClient(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+func (h *Hub) unregisterClient(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.done:
+	}
+}
+
+func (h *Hub) subscribeClient(sub *Subscription) {
+	select {
+	case h.subscribe <- sub:
+	case <-h.done:
+	}
+}
+
+func (h *Hub) unsubscribeClient(sub *Subscription) {
+	select {
+	case h.unsubscribe <- sub:
+	case <-h.done:
+	}
+}
+
+// notifyTyping never blocks the read pump for long: typing frames are
+// best-effort and dropped when the hub is backed up.
+func (h *Hub) notifyTyping(notice *TypingNotice) {
+	select {
+	case h.typing <- notice:
+	case <-h.done:
+	default:
+	}
+}
+
+func (h *Hub) setStatus(change *StatusChange) {
+	select {
+	case h.statuses <- change:
+	case <-h.done:
+	}
+}
+
+// OnlineUsers returns the presence of the users connected to the room,
+// ordered by username.
+func (h *Hub) OnlineUsers(roomID string) []*domain.Presence {
+	h.mu.RLock()
+	userIDs := make([]string, 0, len(h.rooms[roomID]))
+	seen := make(map[string]bool)
+	for client := range h.rooms[roomID] {
+		if !seen[client.userID] {
+			seen[client.userID] = true
+			userIDs = append(userIDs, client.userID)
+		}
+	}
+	h.mu.RUnlock()
+
+	return h.presence.GetMany(userIDs)
+}
+
 func (h *Hub) BroadcastMessage(roomID string, message *domain.Message) {
-	h.broadcast <- &RoomMessage{
-		RoomID:  roomID,
-		Message: message,
+	env, err := NewEnvelope(TypeMessage, message.ID, message)
+	if err != nil {
+		log.Printf("Error building message event: %v", err)
+		return
+	}
+
+	h.publish(&RoomMessage{
+		RoomID:     roomID,
+		Envelope:   env,
+		Seq:        message.Seq,
+		Sender:     message.UserID,
+		Recipients: h.messageUsecase.DirectParticipants(roomID),
+	})
+
+	for _, mention := range message.Mentions {
+		if mention.UserID != message.UserID {
+			h.SendToUser(mention.UserID, TypeMention, message.ID, message)
+		}
+	}
+}
+
+// BroadcastSystem stores text as a system message of the room, so that it
+// shows up in the room's history, and broadcasts it like any other message.
+func (h *Hub) BroadcastSystem(roomID, text string) {
+	message, err := h.messageUsecase.PostSystemMessage(roomID, text)
+	if err != nil {
+		log.Printf("Error posting system message to room %s: %v", roomID, err)
+		return
+	}
+
+	h.BroadcastMessage(roomID, message)
+}
+
+func (h *Hub) BroadcastEvent(roomID, eventType, id string, payload interface{}) {
+	env, err := NewEnvelope(eventType, id, payload)
+	if err != nil {
+		log.Printf("Error building %s event: %v", eventType, err)
+		return
+	}
+
+	h.publish(&RoomMessage{RoomID: roomID, Envelope: env})
+}
+
+// BroadcastModeration announces a moderation action to its room. Kicked and
+// banned users get the announcement before their connections leave the room.
+func (h *Hub) BroadcastModeration(payload ModerationPayload) {
+	env, err := NewEnvelope(TypeRoomModeration, "", payload)
+	if err != nil {
+		log.Printf("Error building %s event: %v", TypeRoomModeration, err)
+		return
+	}
+
+	message := &RoomMessage{RoomID: payload.RoomID, Envelope: env}
+	if payload.Action == ModerationKick || payload.Action == ModerationBan {
+		message.Evict = []string{payload.UserID}
+	}
+	h.publish(message)
+}
+
+func (h *Hub) publish(message *RoomMessage) {
+	select {
+	case h.broadcast <- message:
+	case <-h.done:
+	}
+}
+
+// SendToUser delivers an event to every connection of userID, whichever
+// rooms they follow.
+func (h *Hub) SendToUser(userID, eventType, id string, payload interface{}) {
+	data, err := EncodeFrame(eventType, id, payload)
+	if err != nil {
+		log.Printf("Error building %s event: %v", eventType, err)
+		return
+	}
+
+	select {
+	case h.toUser <- &UserMessage{UserID: userID, Data: data}:
+	case <-h.done:
+	}
+}
+
+// RemoveUserFromRoom unsubscribes every connection of userID from the room,
+// e.g. once the user is no longer allowed in it. It is ordered with the
+// room's broadcasts: events published before it still reach the user.
+func (h *Hub) RemoveUserFromRoom(roomID, userID string) {
+	h.publish(&RoomMessage{RoomID: roomID, Evict: []string{userID}})
+}
+
+// sendToClient delivers data to a single client. It goes through Run so that
+// the write never races with the hub closing client.send.
+func (h *Hub) sendToClient(client *Client, data []byte) {
+	select {
+	case h.direct <- &ClientMessage{Client: client, Data: data}:
+	case <-h.done:
 	}
 }
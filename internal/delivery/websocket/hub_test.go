@@ -0,0 +1,772 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gochat/internal/auth"
+	"gochat/internal/domain"
+	"gochat/internal/repository"
+	"gochat/internal/usecase"
+)
+
+func newTestServer(t *testing.T, hub *Hub) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := &domain.User{ID: r.URL.Query().Get("user"), Username: r.URL.Query().Get("user")}
+		ServeWS(hub, w, r.WithContext(auth.WithUser(r.Context(), user)))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newTestHub returns a hub that posts no system messages about users
+// entering and leaving rooms, so that tests only see the frames they cause.
+func newTestHub(messageUsecase *usecase.MessageUsecase) *Hub {
+	hub := NewHub(messageUsecase, usecase.NewPresenceUsecase())
+	hub.systemMessages = false
+	return hub
+}
+
+func dial(t *testing.T, server *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestHub_StopSendsGoingAway(t *testing.T) {
+	hub := newTestHub(newTestMessageUsecase(t, "alice", "bob"))
+	go hub.Run()
+
+	server := newTestServer(t, hub)
+	conns := []*websocket.Conn{
+		dial(t, server, "room_id=room1&user=alice"),
+		dial(t, server, "room_id=room2&user=bob"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := hub.Stop(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, conn := range conns {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("Expected going-away close, got %v", err)
+		}
+	}
+
+	if err := hub.Stop(ctx); err != nil {
+		t.Errorf("Expected repeated Stop to succeed, got %v", err)
+	}
+}
+
+func TestHub_RejectsClientsAfterStop(t *testing.T) {
+	hub := newTestHub(newTestMessageUsecase(t, "alice"))
+	go hub.Run()
+
+	if err := hub.Stop(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	server := newTestServer(t, hub)
+	conn := dial(t, server, "room_id=room1&user=alice")
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected going-away close, got %v", err)
+	}
+}
+
+func newTestMessageUsecase(t *testing.T, userIDs ...string) *usecase.MessageUsecase {
+	t.Helper()
+
+	userRepo := repository.NewInMemoryUserRepository()
+	roomRepo := repository.NewInMemoryRoomRepository()
+
+	for _, id := range userIDs {
+		if err := userRepo.Create(&domain.User{ID: id, Username: id}); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	for _, id := range []string{"room1", "room2"} {
+		if err := roomRepo.Create(&domain.Room{ID: id, Name: "Room " + id}); err != nil {
+			t.Fatalf("Failed to create room: %v", err)
+		}
+	}
+	direct := &domain.Room{
+		ID:        "dm",
+		Name:      "alice & bob",
+		Type:      domain.RoomTypeDirect,
+		DirectKey: domain.DirectRoomKey("alice", "bob"),
+	}
+	if err := roomRepo.Create(direct); err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+
+	return usecase.NewMessageUsecase(
+		repository.NewInMemoryMessageRepository(),
+		userRepo,
+		roomRepo,
+		repository.NewInMemoryReactionRepository(),
+		repository.NewInMemoryMembershipRepository(),
+		repository.NewInMemorySanctionRepository(),
+		repository.NewInMemoryAttachmentRepository(),
+		repository.NewInMemoryMentionRepository(),
+		repository.NewInMemoryBlobStorage(),
+		usecase.DefaultAttachmentLimits(),
+	)
+}
+
+func readMessageSeqs(t *testing.T, conn *websocket.Conn, n int) []int64 {
+	t.Helper()
+
+	seqs := make([]int64, 0, n)
+	for len(seqs) < n {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read frame: %v", err)
+		}
+
+		env, err := DecodeEnvelope(data)
+		if err != nil {
+			t.Fatalf("Failed to decode frame: %v", err)
+		}
+		if env.Type != TypeMessage {
+			continue
+		}
+
+		var message domain.Message
+		if err := env.DecodePayload(&message); err != nil {
+			t.Fatalf("Failed to decode message: %v", err)
+		}
+		seqs = append(seqs, message.Seq)
+	}
+
+	return seqs
+}
+
+func TestServeWS_ResumeReplaysMissedMessages(t *testing.T) {
+	messageUsecase := newTestMessageUsecase(t, "alice")
+	hub := newTestHub(messageUsecase)
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	for i := 0; i < 5; i++ {
+		if _, err := messageUsecase.SendMessage("room1", "alice", "missed"); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+
+	server := newTestServer(t, hub)
+	conn := dial(t, server, "room_id=room1&user=alice&since_seq=2")
+
+	got := readMessageSeqs(t, conn, 3)
+	for i, want := range []int64{3, 4, 5} {
+		if got[i] != want {
+			t.Fatalf("Expected replayed seqs [3 4 5], got %v", got)
+		}
+	}
+
+	live, err := messageUsecase.SendMessage("room1", "alice", "live")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	hub.BroadcastMessage("room1", live)
+
+	if got := readMessageSeqs(t, conn, 1); got[0] != 6 {
+		t.Errorf("Expected live seq 6 after replay, got %d", got[0])
+	}
+}
+
+func TestServeWS_ResumeSkipsLiveDuplicates(t *testing.T) {
+	messageUsecase := newTestMessageUsecase(t, "alice")
+	hub := newTestHub(messageUsecase)
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+	watcher := dial(t, server, "room_id=room1&user=alice")
+
+	// Store and broadcast concurrently with the resuming connection so that
+	// some messages are seen by both the replay and the live stream.
+	const total = 50
+	go func() {
+		for i := 0; i < total; i++ {
+			message, err := messageUsecase.SendMessage("room1", "alice", "msg")
+			if err != nil {
+				t.Errorf("Failed to send message: %v", err)
+				return
+			}
+			hub.BroadcastMessage("room1", message)
+		}
+	}()
+
+	readMessageSeqs(t, watcher, 10)
+	conn := dial(t, server, "room_id=room1&user=alice&since_seq=0")
+
+	got := readMessageSeqs(t, conn, total)
+	for i, seq := range got {
+		if seq != int64(i+1) {
+			t.Fatalf("Expected seqs 1..%d without gaps or duplicates, got %v", total, got)
+		}
+	}
+}
+
+func TestServeWS_RejectsInvalidSinceSeq(t *testing.T) {
+	hub := newTestHub(nil)
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?room_id=room1&user=alice&since_seq=-5"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("Expected handshake to fail, got nil")
+	}
+	if resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %v", resp)
+	}
+}
+
+func writeFrame(t *testing.T, conn *websocket.Conn, eventType, id string, payload interface{}) {
+	t.Helper()
+
+	data, err := EncodeFrame(eventType, id, payload)
+	if err != nil {
+		t.Fatalf("Failed to encode frame: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+}
+
+// readReply reads frames until the ack or error answering id arrives.
+func readReply(t *testing.T, conn *websocket.Conn, id string) *Envelope {
+	t.Helper()
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read frame: %v", err)
+		}
+
+		env, err := DecodeEnvelope(data)
+		if err != nil {
+			t.Fatalf("Failed to decode frame: %v", err)
+		}
+		if (env.Type == TypeAck || env.Type == TypeError) && env.ID == id {
+			return env
+		}
+	}
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) *domain.Message {
+	t.Helper()
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read frame: %v", err)
+		}
+
+		env, err := DecodeEnvelope(data)
+		if err != nil {
+			t.Fatalf("Failed to decode frame: %v", err)
+		}
+		if env.Type != TypeMessage {
+			continue
+		}
+
+		var message domain.Message
+		if err := env.DecodePayload(&message); err != nil {
+			t.Fatalf("Failed to decode message: %v", err)
+		}
+		return &message
+	}
+}
+
+func subscribe(t *testing.T, conn *websocket.Conn, id, roomID string, sinceSeq *int64) {
+	t.Helper()
+
+	writeFrame(t, conn, TypeSubscribe, id, SubscriptionPayload{RoomID: roomID, SinceSeq: sinceSeq})
+	if reply := readReply(t, conn, id); reply.Type != TypeAck {
+		t.Fatalf("Expected subscribe to %s to be acked, got %s: %s", roomID, reply.Type, reply.Payload)
+	}
+}
+
+func TestServeWS_SubscribeToMultipleRooms(t *testing.T) {
+	messageUsecase := newTestMessageUsecase(t, "alice")
+	hub := newTestHub(messageUsecase)
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+	conn := dial(t, server, "user=alice")
+
+	subscribe(t, conn, "s1", "room1", nil)
+	subscribe(t, conn, "s2", "room2", nil)
+
+	for _, roomID := range []string{"room1", "room2"} {
+		message, err := messageUsecase.SendMessage(roomID, "alice", "hello "+roomID)
+		if err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+		hub.BroadcastMessage(roomID, message)
+
+		if got := readMessage(t, conn); got.RoomID != roomID {
+			t.Errorf("Expected message from %s, got %s", roomID, got.RoomID)
+		}
+	}
+
+	writeFrame(t, conn, TypeUnsubscribe, "u1", SubscriptionPayload{RoomID: "room1"})
+	if reply := readReply(t, conn, "u1"); reply.Type != TypeAck {
+		t.Fatalf("Expected unsubscribe to be acked, got %s", reply.Type)
+	}
+
+	for _, roomID := range []string{"room1", "room2"} {
+		message, err := messageUsecase.SendMessage(roomID, "alice", "after "+roomID)
+		if err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+		hub.BroadcastMessage(roomID, message)
+	}
+
+	if got := readMessage(t, conn); got.RoomID != "room2" {
+		t.Errorf("Expected only room2 messages after unsubscribing room1, got %s", got.RoomID)
+	}
+}
+
+func TestServeWS_SubscribeReplaysSinceSeq(t *testing.T) {
+	messageUsecase := newTestMessageUsecase(t, "alice")
+	hub := newTestHub(messageUsecase)
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	for i := 0; i < 4; i++ {
+		if _, err := messageUsecase.SendMessage("room2", "alice", "missed"); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+
+	server := newTestServer(t, hub)
+	conn := dial(t, server, "room_id=room1&user=alice")
+
+	since := int64(1)
+	subscribe(t, conn, "s1", "room2", &since)
+
+	got := readMessageSeqs(t, conn, 3)
+	for i, want := range []int64{2, 3, 4} {
+		if got[i] != want {
+			t.Fatalf("Expected replayed seqs [2 3 4], got %v", got)
+		}
+	}
+}
+
+func TestServeWS_SendMessageToSubscribedRoom(t *testing.T) {
+	messageUsecase := newTestMessageUsecase(t, "alice")
+	hub := newTestHub(messageUsecase)
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+	conn := dial(t, server, "user=alice")
+
+	writeFrame(t, conn, TypeMessage, "m1", SendMessagePayload{Content: "no room"})
+	if reply := readReply(t, conn, "m1"); reply.Type != TypeError {
+		t.Errorf("Expected error for message without room, got %s", reply.Type)
+	}
+
+	subscribe(t, conn, "s1", "room2", nil)
+	writeFrame(t, conn, TypeMessage, "m2", SendMessagePayload{RoomID: "room2", Content: "hi"})
+	if reply := readReply(t, conn, "m2"); reply.Type != TypeAck {
+		t.Fatalf("Expected message to be acked, got %s", reply.Type)
+	}
+
+	if got := readMessage(t, conn); got.RoomID != "room2" || got.Content != "hi" {
+		t.Errorf("Expected broadcast of own message in room2, got %+v", got)
+	}
+}
+
+func TestServeWS_SubscribeRejectsInvalidRequests(t *testing.T) {
+	hub := newTestHub(newTestMessageUsecase(t, "alice"))
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+	conn := dial(t, server, "user=alice")
+
+	negative := int64(-1)
+	tests := []struct {
+		name    string
+		payload SubscriptionPayload
+	}{
+		{"missing room", SubscriptionPayload{}},
+		{"unknown room", SubscriptionPayload{RoomID: "missing"}},
+		{"negative since_seq", SubscriptionPayload{RoomID: "room1", SinceSeq: &negative}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeFrame(t, conn, TypeSubscribe, tt.name, tt.payload)
+			if reply := readReply(t, conn, tt.name); reply.Type != TypeError {
+				t.Errorf("Expected error, got %s", reply.Type)
+			}
+		})
+	}
+}
+
+func TestServeWS_DirectMessages(t *testing.T) {
+	messageUsecase := newTestMessageUsecase(t, "alice", "bob", "carol")
+	hub := newTestHub(messageUsecase)
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+	alice := dial(t, server, "user=alice")
+	bob := dial(t, server, "user=bob")
+	carol := dial(t, server, "user=carol")
+
+	writeFrame(t, carol, TypeSubscribe, "s1", SubscriptionPayload{RoomID: "dm"})
+	if reply := readReply(t, carol, "s1"); reply.Type != TypeError {
+		t.Errorf("Expected outsider subscribe to fail, got %s", reply.Type)
+	}
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?room_id=dm&user=carol"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatal("Expected outsider connection to be rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %v", resp)
+	}
+
+	// Neither participant subscribed: the first message opens the room on
+	// both of their connections.
+	writeFrame(t, alice, TypeMessage, "m1", SendMessagePayload{RoomID: "dm", Content: "psst"})
+	if reply := readReply(t, alice, "m1"); reply.Type != TypeAck {
+		t.Fatalf("Expected direct message to be acked, got %s: %s", reply.Type, reply.Payload)
+	}
+
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		if got := readMessage(t, conn); got.RoomID != "dm" || got.Content != "psst" {
+			t.Errorf("Expected the direct message, got %+v", got)
+		}
+	}
+
+	writeFrame(t, bob, TypeMessage, "m2", SendMessagePayload{RoomID: "dm", Content: "hey"})
+	if reply := readReply(t, bob, "m2"); reply.Type != TypeAck {
+		t.Fatalf("Expected reply to be acked, got %s", reply.Type)
+	}
+	if got := readMessage(t, alice); got.Content != "hey" {
+		t.Errorf("Expected bob's reply, got %+v", got)
+	}
+}
+
+func TestHub_UserEventsAndRemoval(t *testing.T) {
+	messageUsecase := newTestMessageUsecase(t, "alice", "bob")
+	hub := newTestHub(messageUsecase)
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+	first := dial(t, server, "room_id=room1&user=alice")
+	second := dial(t, server, "user=alice")
+	subscribe(t, second, "s1", "room2", nil)
+	subscribe(t, first, "s2", "room2", nil)
+
+	hub.SendToUser("alice", TypeSystem, "", SystemPayload{Text: "hello alice"})
+	for _, conn := range []*websocket.Conn{first, second} {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read frame: %v", err)
+		}
+		if env, err := DecodeEnvelope(data); err != nil || env.Type != TypeSystem {
+			t.Errorf("Expected system frame on every connection, got %s (%v)", data, err)
+		}
+	}
+
+	hub.RemoveUserFromRoom("room1", "alice")
+	for _, roomID := range []string{"room1", "room2"} {
+		message, err := messageUsecase.SendMessage(roomID, "bob", "hi "+roomID)
+		if err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+		hub.BroadcastMessage(roomID, message)
+	}
+
+	if got := readMessage(t, first); got.RoomID != "room2" {
+		t.Errorf("Expected only room2 messages after removal from room1, got %s", got.RoomID)
+	}
+}
+
+func TestHub_MentionReachesUserInAnotherRoom(t *testing.T) {
+	messageUsecase := newTestMessageUsecase(t, "alice", "bob")
+	hub := newTestHub(messageUsecase)
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+	alice := dial(t, server, "room_id=room2&user=alice")
+	bob := dial(t, server, "room_id=room1&user=bob")
+
+	writeFrame(t, bob, TypeMessage, "m1", SendMessagePayload{Content: "ping @alice"})
+	if reply := readReply(t, bob, "m1"); reply.Type != TypeAck {
+		t.Fatalf("Expected message to be acked, got %s: %s", reply.Type, reply.Payload)
+	}
+
+	env := readEvent(t, alice, TypeMention)
+	var message domain.Message
+	if err := json.Unmarshal(env.Payload, &message); err != nil {
+		t.Fatalf("Failed to decode mention: %v", err)
+	}
+	if message.RoomID != "room1" || message.Content != "ping @alice" || len(message.Mentions) != 1 {
+		t.Errorf("Expected the room1 message mentioning alice, got %+v", message)
+	}
+}
+
+func TestHub_BroadcastModerationEvictsAfterAnnouncing(t *testing.T) {
+	messageUsecase := newTestMessageUsecase(t, "alice", "bob")
+	hub := newTestHub(messageUsecase)
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+	conn := dial(t, server, "user=bob")
+	subscribe(t, conn, "s1", "room1", nil)
+	subscribe(t, conn, "s2", "room2", nil)
+
+	hub.BroadcastModeration(ModerationPayload{RoomID: "room1", Action: ModerationKick, UserID: "bob", Username: "bob"})
+	for _, roomID := range []string{"room1", "room2"} {
+		message, err := messageUsecase.SendMessage(roomID, "alice", "hi "+roomID)
+		if err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+		hub.BroadcastMessage(roomID, message)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	env, err := DecodeEnvelope(data)
+	if err != nil || env.Type != TypeRoomModeration {
+		t.Fatalf("Expected the kick to be announced to the kicked user, got %s (%v)", data, err)
+	}
+
+	if got := readMessage(t, conn); got.RoomID != "room2" {
+		t.Errorf("Expected only room2 messages after the kick, got %s", got.RoomID)
+	}
+}
+
+// readEvent reads frames until one of eventType arrives.
+func readEvent(t *testing.T, conn *websocket.Conn, eventType string) *Envelope {
+	t.Helper()
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read frame waiting for %s: %v", eventType, err)
+		}
+
+		env, err := DecodeEnvelope(data)
+		if err != nil {
+			t.Fatalf("Failed to decode frame: %v", err)
+		}
+		if env.Type == eventType {
+			return env
+		}
+	}
+}
+
+func readPresence(t *testing.T, conn *websocket.Conn, eventType string) PresencePayload {
+	t.Helper()
+
+	var payload PresencePayload
+	if err := readEvent(t, conn, eventType).DecodePayload(&payload); err != nil {
+		t.Fatalf("Failed to decode presence: %v", err)
+	}
+	return payload
+}
+
+func TestHub_Presence(t *testing.T) {
+	hub := newTestHub(newTestMessageUsecase(t, "alice", "bob"))
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+	alice := dial(t, server, "room_id=room1&user=alice")
+	bob := dial(t, server, "user=bob")
+	subscribe(t, bob, "s1", "room1", nil)
+
+	if joined := readPresence(t, alice, TypePresenceJoined); joined.UserID != "bob" || joined.Status != domain.PresenceOnline {
+		t.Errorf("Expected bob to join room1 online, got %+v", joined)
+	}
+
+	// A second connection in the same room is not announced again.
+	second := dial(t, server, "room_id=room1&user=bob")
+	writeFrame(t, bob, TypePresence, "p1", StatusPayload{Status: domain.PresenceAway})
+	if reply := readReply(t, bob, "p1"); reply.Type != TypeAck {
+		t.Fatalf("Expected presence frame to be acked, got %s: %s", reply.Type, reply.Payload)
+	}
+	writeFrame(t, second, TypePresence, "p2", StatusPayload{Status: domain.PresenceAway})
+	readReply(t, second, "p2")
+
+	env := readEvent(t, alice, TypePresenceChanged)
+	var changed PresencePayload
+	if err := env.DecodePayload(&changed); err != nil || changed.Status != domain.PresenceAway {
+		t.Errorf("Expected bob to be away once both connections are, got %+v (%v)", changed, err)
+	}
+
+	online := hub.OnlineUsers("room1")
+	if len(online) != 2 || online[0].Username != "alice" || online[1].Status != domain.PresenceAway {
+		t.Errorf("Expected alice and away bob in room1, got %+v", online)
+	}
+
+	bob.Close()
+	second.Close()
+	if left := readPresence(t, alice, TypePresenceLeft); left.UserID != "bob" || left.Status != domain.PresenceOffline {
+		t.Errorf("Expected bob to leave room1 offline, got %+v", left)
+	}
+}
+
+func TestHub_TypingIndicators(t *testing.T) {
+	hub := newTestHub(newTestMessageUsecase(t, "alice", "bob"))
+	hub.typingTimeout = 100 * time.Millisecond
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+	alice := dial(t, server, "room_id=room1&user=alice")
+	bob := dial(t, server, "user=bob")
+
+	writeFrame(t, bob, TypeTyping, "t1", TypingPayload{RoomID: "room1"})
+	if reply := readReply(t, bob, "t1"); reply.Type != TypeError {
+		t.Errorf("Expected error for typing in a room bob does not follow, got %s", reply.Type)
+	}
+
+	subscribe(t, bob, "s1", "room1", nil)
+	writeFrame(t, bob, TypeTyping, "", TypingPayload{RoomID: "room1"})
+
+	var started TypingPayload
+	if err := readEvent(t, alice, TypeTypingStarted).DecodePayload(&started); err != nil || started.UserID != "bob" || started.RoomID != "room1" {
+		t.Errorf("Expected bob to start typing in room1, got %+v (%v)", started, err)
+	}
+
+	// Sending the message ends the indicator before the message arrives.
+	writeFrame(t, bob, TypeMessage, "m1", SendMessagePayload{RoomID: "room1", Content: "hi"})
+	readEvent(t, alice, TypeTypingStopped)
+	if got := readMessage(t, alice); got.Content != "hi" {
+		t.Errorf("Expected bob's message after typing stopped, got %+v", got)
+	}
+
+	// Without further typing frames the indicator expires on its own.
+	writeFrame(t, bob, TypeTyping, "", TypingPayload{RoomID: "room1"})
+	readEvent(t, alice, TypeTypingStarted)
+	var stopped TypingPayload
+	if err := readEvent(t, alice, TypeTypingStopped).DecodePayload(&stopped); err != nil || stopped.UserID != "bob" {
+		t.Errorf("Expected bob's typing to expire, got %+v (%v)", stopped, err)
+	}
+}
+
+func TestHub_SystemMessagesForComingAndGoing(t *testing.T) {
+	messageUsecase := newTestMessageUsecase(t, "alice", "bob")
+	hub := NewHub(messageUsecase, usecase.NewPresenceUsecase())
+	hub.leaveGrace = 100 * time.Millisecond
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Stop(context.Background()) })
+
+	server := newTestServer(t, hub)
+	bob := dial(t, server, "room_id=room1&user=bob")
+	if got := readMessage(t, bob); got.Kind != domain.MessageKindSystem || got.Content != "bob entered the room" {
+		t.Fatalf("Expected bob's arrival, got %+v", got)
+	}
+
+	alice := dial(t, server, "room_id=room1&user=alice")
+	if got := readMessage(t, bob); got.Content != "alice entered the room" {
+		t.Fatalf("Expected alice's arrival, got %+v", got)
+	}
+
+	// Reconnecting within the grace period is not recorded.
+	alice.Close()
+	alice = dial(t, server, "room_id=room1&user=alice")
+	alice.Close()
+
+	left := readMessage(t, bob)
+	if left.Kind != domain.MessageKindSystem || left.UserID != "" || left.Content != "alice left the room" {
+		t.Fatalf("Expected alice's departure, got %+v", left)
+	}
+
+	history, err := messageUsecase.GetMessagesSince("room1", 0, 10)
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	want := []string{"bob entered the room", "alice entered the room", "alice left the room"}
+	if len(history) != len(want) {
+		t.Fatalf("Expected %d system messages in history, got %+v", len(want), history)
+	}
+	for i, message := range history {
+		if message.Content != want[i] {
+			t.Errorf("Expected %q at %d, got %q", want[i], i, message.Content)
+		}
+	}
+}
+
+func TestHub_StopWaitsForSystemMessages(t *testing.T) {
+	messageUsecase := newTestMessageUsecase(t, "alice")
+	hub := NewHub(messageUsecase, usecase.NewPresenceUsecase())
+	hub.leaveGrace = 20 * time.Millisecond
+	go hub.Run()
+
+	server := newTestServer(t, hub)
+	dial(t, server, "room_id=room1&user=alice").Close()
+	dial(t, server, "room_id=room2&user=alice")
+
+	if err := hub.Stop(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	stored := func() int {
+		messages, err := messageUsecase.GetMessagesSince("room1", 0, 10)
+		if err != nil {
+			t.Fatalf("Failed to read history: %v", err)
+		}
+		more, err := messageUsecase.GetMessagesSince("room2", 0, 10)
+		if err != nil {
+			t.Fatalf("Failed to read history: %v", err)
+		}
+		return len(messages) + len(more)
+	}
+
+	// Nothing pending at Stop, including departures, is stored afterwards.
+	before := stored()
+	time.Sleep(100 * time.Millisecond)
+	if after := stored(); after != before {
+		t.Errorf("Expected no system messages after Stop, got %d more", after-before)
+	}
+}
@@ -0,0 +1,223 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+// ProtocolVersion is bumped on incompatible changes to the frame format.
+// Frames that omit "v" are treated as the current version.
+const ProtocolVersion = 1
+
+const (
+	TypeMessage = "message"
+	TypeError   = "error"
+	TypeAck     = "ack"
+	TypeSystem  = "system"
+	TypePing    = "ping"
+	TypePong    = "pong"
+
+	TypeSubscribe   = "subscribe"
+	TypeUnsubscribe = "unsubscribe"
+
+	// Sent by the server with the updated message as payload.
+	TypeMessageEdited  = "message.edited"
+	TypeMessageDeleted = "message.deleted"
+
+	TypeReactionAdded   = "reaction.added"
+	TypeReactionRemoved = "reaction.removed"
+
+	// Sent to the invited user with the invitation as payload.
+	TypeRoomInvited = "room.invited"
+
+	// Sent to each user mentioned in a message, on all of their connections
+	// whichever room they are in, with the message as payload.
+	TypeMention = "mention"
+
+	// Sent to a room when a moderator acts on one of its users.
+	TypeRoomModeration = "room.moderation"
+
+	// Sent to a room when its topic or pinned messages change.
+	TypeRoomUpdated = "room.updated"
+
+	// Sent by the client to mark its connection away or active again.
+	TypePresence = "presence"
+	// Sent to a room when a user's first connection joins it, when their last
+	// one leaves and when their status changes in between.
+	TypePresenceJoined  = "presence.joined"
+	TypePresenceLeft    = "presence.left"
+	TypePresenceChanged = "presence.changed"
+
+	// Sent by the client while its user types in a room. The rest of the
+	// room gets typing.started once and typing.stopped when the user sends
+	// a message, leaves or has been quiet for a few seconds.
+	TypeTyping        = "typing"
+	TypeTypingStarted = "typing.started"
+	TypeTypingStopped = "typing.stopped"
+)
+
+// Moderation actions reported in a ModerationPayload.
+const (
+	ModerationKick   = "kick"
+	ModerationBan    = "ban"
+	ModerationUnban  = "unban"
+	ModerationMute   = "mute"
+	ModerationUnmute = "unmute"
+	ModerationRole   = "role"
+)
+
+// Room changes reported in a RoomUpdatePayload.
+const (
+	RoomUpdateTopic = "topic"
+	RoomUpdatePin   = "pin"
+	RoomUpdateUnpin = "unpin"
+)
+
+// Envelope wraps every frame exchanged over the socket in either direction.
+// ID is chosen by the sender; replies (ack, error, pong) echo the ID of the
+// frame they answer.
+type Envelope struct {
+	Version int             `json:"v"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// SendMessagePayload posts a chat message. RoomID may be omitted when the
+// connection was opened with a room_id, which is then used instead. ParentID
+// makes the message a reply in that message's thread.
+type SendMessagePayload struct {
+	RoomID   string `json:"room_id,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+	Content  string `json:"content"`
+}
+
+// SubscriptionPayload is sent with subscribe and unsubscribe frames and
+// echoed back in their acks. SinceSeq is only meaningful for subscribe: when
+// set, the room's messages after it are replayed before live ones.
+type SubscriptionPayload struct {
+	RoomID   string `json:"room_id"`
+	SinceSeq *int64 `json:"since_seq,omitempty"`
+}
+
+type ErrorPayload struct {
+	Message string `json:"message"`
+}
+
+type SystemPayload struct {
+	Text string `json:"text"`
+}
+
+// StatusPayload is sent with presence frames, Status being "away" or
+// "online". The ack echoes the user's resulting status.
+type StatusPayload struct {
+	Status string `json:"status"`
+}
+
+// PresencePayload reports a user's presence to a room they are in.
+type PresencePayload struct {
+	RoomID string `json:"room_id"`
+	domain.Presence
+}
+
+// TypingPayload is sent by the client with just RoomID, which may be omitted
+// like in SendMessagePayload, and by the server with the user filled in.
+type TypingPayload struct {
+	RoomID   string `json:"room_id,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// ModerationPayload reports a moderator's action on a user of a room. Role
+// is set for role changes, ExpiresAt for bans and mutes that expire.
+type ModerationPayload struct {
+	RoomID        string     `json:"room_id"`
+	Action        string     `json:"action"`
+	UserID        string     `json:"user_id"`
+	Username      string     `json:"username"`
+	ModeratorID   string     `json:"moderator_id"`
+	ModeratorName string     `json:"moderator_name"`
+	Role          string     `json:"role,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+}
+
+// RoomUpdatePayload reports who changed a room and how. Topic is the new
+// topic for RoomUpdateTopic; Message is the message pinned or unpinned.
+type RoomUpdatePayload struct {
+	RoomID   string          `json:"room_id"`
+	Action   string          `json:"action"`
+	UserID   string          `json:"user_id"`
+	Username string          `json:"username"`
+	Topic    string          `json:"topic,omitempty"`
+	Message  *domain.Message `json:"message,omitempty"`
+}
+
+// ReactionPayload reports one user's reaction change together with the
+// message's reaction counts after it.
+type ReactionPayload struct {
+	MessageID string                 `json:"message_id"`
+	RoomID    string                 `json:"room_id"`
+	UserID    string                 `json:"user_id"`
+	Username  string                 `json:"username"`
+	Emoji     string                 `json:"emoji"`
+	Reactions []domain.ReactionCount `json:"reactions"`
+}
+
+func NewEnvelope(eventType, id string, payload interface{}) (*Envelope, error) {
+	env := &Envelope{
+		Version: ProtocolVersion,
+		Type:    eventType,
+		ID:      id,
+	}
+
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s payload: %w", eventType, err)
+		}
+		env.Payload = data
+	}
+
+	return env, nil
+}
+
+func EncodeFrame(eventType, id string, payload interface{}) ([]byte, error) {
+	env, err := NewEnvelope(eventType, id, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(env)
+}
+
+func DecodeEnvelope(data []byte) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("invalid frame: %w", err)
+	}
+
+	if env.Version != 0 && env.Version != ProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version %d", env.Version)
+	}
+
+	if env.Type == "" {
+		return nil, fmt.Errorf("frame type is required")
+	}
+
+	return &env, nil
+}
+
+func (e *Envelope) DecodePayload(v interface{}) error {
+	if len(e.Payload) == 0 {
+		return fmt.Errorf("%s frame has no payload", e.Type)
+	}
+
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return fmt.Errorf("invalid %s payload: %w", e.Type, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	env, err := NewEnvelope(TypeMessage, "c1", SendMessagePayload{Content: "hello"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		t.Fatalf("Failed to marshal envelope: %v", err)
+	}
+
+	decoded, err := DecodeEnvelope(data)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if decoded.Version != ProtocolVersion {
+		t.Errorf("Expected version %d, got %d", ProtocolVersion, decoded.Version)
+	}
+	if decoded.Type != TypeMessage || decoded.ID != "c1" {
+		t.Errorf("Expected message frame c1, got %s frame %s", decoded.Type, decoded.ID)
+	}
+
+	var payload SendMessagePayload
+	if err := decoded.DecodePayload(&payload); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if payload.Content != "hello" {
+		t.Errorf("Expected content 'hello', got %s", payload.Content)
+	}
+}
+
+func TestDecodeEnvelope_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not json", `garbage`},
+		{"missing type", `{"v":1,"id":"c1"}`},
+		{"future version", `{"v":2,"type":"message"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeEnvelope([]byte(tt.data)); err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+		})
+	}
+
+	env, err := DecodeEnvelope([]byte(`{"type":"ping"}`))
+	if err != nil {
+		t.Fatalf("Expected frame without version to be accepted, got %v", err)
+	}
+	if err := env.DecodePayload(&SendMessagePayload{}); err == nil {
+		t.Fatal("Expected error decoding missing payload, got nil")
+	}
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"io"
+	"time"
+)
+
+// Attachment is a file sent with a message. Its content is kept in a
+// BlobStorage under the attachment's ID; the attachment itself only holds
+// what is needed to list and serve it.
+type Attachment struct {
+	ID        string `json:"id"`
+	MessageID string `json:"message_id"`
+	RoomID    string `json:"room_id"`
+	UserID    string `json:"user_id"`
+	Filename  string `json:"filename"`
+	// ContentType is detected from the content, not taken from the upload.
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type AttachmentRepository interface {
+	Create(attachment *Attachment) error
+	GetByID(id string) (*Attachment, error)
+	// GetByMessageIDs returns the attachments of each message in the order
+	// they were created; messages without attachments are left out.
+	GetByMessageIDs(messageIDs []string) (map[string][]*Attachment, error)
+}
+
+// BlobStorage keeps file contents under keys chosen by the caller. Put
+// replaces an existing blob with the same key.
+type BlobStorage interface {
+	Put(key string, content io.Reader) error
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
@@ -0,0 +1,52 @@
+package domain
+
+import "time"
+
+// Roles a member can have in a room. The creator is its owner; the owner
+// appoints moderators.
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+// Membership records that a user belongs to a room. Private rooms are open
+// only to their members.
+type Membership struct {
+	RoomID   string    `json:"room_id"`
+	UserID   string    `json:"user_id"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// Invitation lets a user become a member of a private room once they accept
+// it.
+type Invitation struct {
+	RoomID    string    `json:"room_id"`
+	UserID    string    `json:"user_id"`
+	InvitedBy string    `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// RoomName and InviterName are filled in by the usecase for display and
+	// are not stored.
+	RoomName    string `json:"room_name,omitempty"`
+	InviterName string `json:"inviter_name,omitempty"`
+}
+
+type MembershipRepository interface {
+	Add(membership *Membership) error
+	Get(roomID, userID string) (*Membership, error)
+	SetRole(roomID, userID, role string) error
+	Remove(roomID, userID string) error
+	IsMember(roomID, userID string) bool
+	// GetRoomIDsByUserID returns the rooms the user is a member of, in the
+	// order they were joined.
+	GetRoomIDsByUserID(userID string) ([]string, error)
+
+	AddInvitation(invitation *Invitation) error
+	GetInvitation(roomID, userID string) (*Invitation, error)
+	RemoveInvitation(roomID, userID string) error
+	// GetInvitationsByUserID returns the user's pending invitations, oldest
+	// first.
+	GetInvitationsByUserID(userID string) ([]*Invitation, error)
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// Mention is a user named with @username in a message.
+type Mention struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// MentionRepository keeps the mentions of each message and whether the
+// mentioned users have seen them, which makes up their notification feed.
+type MentionRepository interface {
+	// Add records the mentions of a message, none of them seen yet.
+	Add(messageID string, createdAt time.Time, mentions []Mention) error
+	// GetByMessageIDs returns the mentions of each message in the order
+	// they were added; messages without mentions are left out.
+	GetByMessageIDs(messageIDs []string) (map[string][]Mention, error)
+	// GetUnseen returns the IDs of up to limit messages mentioning userID
+	// that they have not seen, oldest first.
+	GetUnseen(userID string, limit int) ([]string, error)
+	MarkSeen(userID string, messageIDs []string) error
+}
@@ -2,17 +2,64 @@ package domain
 
 import "time"
 
+const (
+	MessageKindUser = "user"
+	// MessageKindSystem messages are written by the server to record events
+	// such as someone entering the room; they have no author.
+	MessageKindSystem = "system"
+)
+
 type Message struct {
-	ID        string    `json:"id"`
-	RoomID    string    `json:"room_id"`
+	ID     string `json:"id"`
+	RoomID string `json:"room_id"`
+	Seq    int64  `json:"seq"`
+	Kind   string `json:"kind"`
+	// ParentID is the message that starts the thread this one replies to.
+	// Threads are flat: it always names the top-level message.
+	ParentID  string    `json:"parent_id,omitempty"`
 	UserID    string    `json:"user_id"`
 	Username  string    `json:"username"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
+	// EditedAt is set when the content was changed after sending. A deleted
+	// message keeps its place in the room with DeletedAt set and no content.
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// ReplyCount, Reactions, Attachments and Mentions are filled in by the
+	// usecase when reading history; they are not stored with the message.
+	ReplyCount  int             `json:"reply_count,omitempty"`
+	Reactions   []ReactionCount `json:"reactions,omitempty"`
+	Attachments []*Attachment   `json:"attachments,omitempty"`
+	Mentions    []Mention       `json:"mentions,omitempty"`
 }
 
+// MessageRepository stores chat messages. Create assigns message.Seq, which
+// starts at 1 and increases by one with every message in the same room.
+// Update stores the Content, EditedAt and DeletedAt of an existing message;
+// the other fields never change.
 type MessageRepository interface {
 	Create(message *Message) error
-	GetByRoomID(roomID string, limit, offset int) ([]*Message, error)
+	Update(message *Message) error
+	// GetByRoomIDBefore returns the newest limit messages of the room whose
+	// Seq is below beforeSeq, and GetByRoomIDSince the oldest limit messages
+	// whose Seq is above sinceSeq. Both return them oldest first.
+	GetByRoomIDBefore(roomID string, beforeSeq int64, limit int) ([]*Message, error)
+	GetByRoomIDSince(roomID string, sinceSeq int64, limit int) ([]*Message, error)
 	GetByID(id string) (*Message, error)
+	// GetByIDs returns the messages with the given IDs by ID; unknown IDs are
+	// left out.
+	GetByIDs(ids []string) (map[string]*Message, error)
+	// GetReplies returns the replies to parentID, oldest first.
+	GetReplies(parentID string, limit, offset int) ([]*Message, error)
+	// CountReplies returns the number of replies per parent; parents without
+	// replies are left out.
+	CountReplies(parentIDs []string) (map[string]int, error)
+	// CountSinceMany returns, for each room in sinceSeqs, how many of its
+	// messages have a Seq above the room's value there, leaving out deleted
+	// ones, system messages and those written by excludeUserID. Rooms
+	// without such messages are left out.
+	CountSinceMany(sinceSeqs map[string]int64, excludeUserID string) (map[string]int, error)
+	// LastSeq returns the Seq of the newest message in the room, or 0 if the
+	// room has none.
+	LastSeq(roomID string) (int64, error)
 }
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// Presence states of a user. A user is online while any of their connections
+// is active, away while all of them are idle and offline without any.
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+type Presence struct {
+	UserID   string    `json:"user_id"`
+	Username string    `json:"username"`
+	Status   string    `json:"status"`
+	LastSeen time.Time `json:"last_seen"`
+}
@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// Reaction is one user's emoji on a message. A user may put several
+// different emoji on the same message, but each one only once.
+type Reaction struct {
+	MessageID string    `json:"message_id"`
+	UserID    string    `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+type ReactionRepository interface {
+	Add(reaction *Reaction) error
+	Remove(messageID, userID, emoji string) error
+	// CountByMessageIDs returns the reaction counts of each message, ordered
+	// by when the emoji was first used on it. Messages without reactions are
+	// left out.
+	CountByMessageIDs(messageIDs []string) (map[string][]ReactionCount, error)
+}
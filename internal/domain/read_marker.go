@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// ReadMarker records how far a user has read a room: the messages up to and
+// including LastReadSeq count as read, the ones after it as unread.
+type ReadMarker struct {
+	UserID      string    `json:"user_id"`
+	RoomID      string    `json:"room_id"`
+	LastReadSeq int64     `json:"last_read_seq"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ReadMarkerRepository interface {
+	// Put stores the marker, replacing the user's previous one for the room.
+	Put(marker *ReadMarker) error
+	Get(userID, roomID string) (*ReadMarker, error)
+	// GetByUserID returns the user's markers for all rooms they have read.
+	GetByUserID(userID string) ([]*ReadMarker, error)
+}
@@ -1,16 +1,81 @@
 package domain
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+const (
+	RoomTypePublic = "public"
+	// RoomTypePrivate rooms are visible and open only to their members;
+	// others join by invitation.
+	RoomTypePrivate = "private"
+	// RoomTypeDirect rooms hold a one-to-one conversation. They are hidden
+	// from room listings and open only to their two participants.
+	RoomTypeDirect = "direct"
+)
 
 type Room struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Topic string `json:"topic,omitempty"`
+	// PinnedMessageIDs lists the room's pinned messages in the order they
+	// were pinned.
+	PinnedMessageIDs []string `json:"pinned_message_ids,omitempty"`
+	// DirectKey identifies the pair of users of a direct room, see
+	// DirectRoomKey. It is empty for other rooms.
+	DirectKey string    `json:"-"`
 	CreatedAt time.Time `json:"created_at"`
+	// UnreadCount is filled in by the usecase for the user listing the
+	// rooms; it is not stored with the room.
+	UnreadCount int `json:"unread_count,omitempty"`
+}
+
+func (r *Room) IsPrivate() bool {
+	return r.Type == RoomTypePrivate
+}
+
+func (r *Room) IsDirect() bool {
+	return r.Type == RoomTypeDirect
+}
+
+// Participants returns the IDs of the two users of a direct room, or nil for
+// other rooms.
+func (r *Room) Participants() []string {
+	if !r.IsDirect() || r.DirectKey == "" {
+		return nil
+	}
+	return strings.Split(r.DirectKey, ":")
+}
+
+func (r *Room) HasParticipant(userID string) bool {
+	for _, id := range r.Participants() {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// DirectRoomKey returns the key of the direct room between two users. It does
+// not depend on the order of the arguments.
+func DirectRoomKey(userA, userB string) string {
+	if userB < userA {
+		userA, userB = userB, userA
+	}
+	return userA + ":" + userB
 }
 
 type RoomRepository interface {
 	Create(room *Room) error
 	GetByID(id string) (*Room, error)
+	GetByDirectKey(key string) (*Room, error)
 	GetAll() ([]*Room, error)
 	Exists(id string) bool
+	SetTopic(id, topic string) error
+	// Pin appends messageID to the pinned messages of the room; it fails if
+	// the message is already pinned. Unpin fails if it is not.
+	Pin(id, messageID string) error
+	Unpin(id, messageID string) error
 }
@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// Kinds of sanction a moderator can put on a user in a room.
+const (
+	// SanctionBan keeps the user out of the room entirely.
+	SanctionBan = "ban"
+	// SanctionMute lets the user read the room but not post to it.
+	SanctionMute = "mute"
+)
+
+// Sanction restricts a user in a room until ExpiresAt, or until it is lifted
+// if ExpiresAt is nil. A user has at most one sanction of each kind per room.
+type Sanction struct {
+	RoomID    string     `json:"room_id"`
+	UserID    string     `json:"user_id"`
+	Kind      string     `json:"kind"`
+	IssuedBy  string     `json:"issued_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ActiveAt reports whether the sanction is still in force at t.
+func (s *Sanction) ActiveAt(t time.Time) bool {
+	return s.ExpiresAt == nil || t.Before(*s.ExpiresAt)
+}
+
+type SanctionRepository interface {
+	// Put stores the sanction, replacing one of the same kind already on
+	// the user in that room.
+	Put(sanction *Sanction) error
+	Get(roomID, userID, kind string) (*Sanction, error)
+	Remove(roomID, userID, kind string) error
+}
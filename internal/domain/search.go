@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SearchQuery selects indexed messages that contain every one of Terms.
+type SearchQuery struct {
+	Terms []string
+	// RoomIDs are the rooms to search; a query without rooms matches
+	// nothing.
+	RoomIDs []string
+	// UserID, Since and Until are optional filters on the author and on
+	// CreatedAt, with Since inclusive and Until exclusive.
+	UserID string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+// SearchResult is a message matching a SearchQuery. A higher Score means a
+// better match; scores are only comparable within one result list.
+type SearchResult struct {
+	MessageID string
+	Score     float64
+}
+
+// SearchIndex is an inverted index over message content. It holds the
+// current content of messages that were not deleted.
+type SearchIndex interface {
+	// Index adds the message, replacing an earlier version of it.
+	Index(message *Message) error
+	Remove(messageID string) error
+	// Search returns the matches best first, newer first among equals.
+	Search(query SearchQuery) ([]SearchResult, error)
+}
+
+// SearchHit is a search result as shown to users: the message with a
+// snippet of its content in which the matched words are wrapped in "**".
+type SearchHit struct {
+	Message *Message `json:"message"`
+	Score   float64  `json:"score"`
+	Snippet string   `json:"snippet"`
+}
+
+// SearchTerms splits text into the lowercase words it is indexed and
+// searched by, in order and with repeats. Anything other than letters and
+// digits separates words.
+func SearchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+
+	"gochat/internal/domain"
+)
+
+type InMemoryAttachmentRepository struct {
+	attachments map[string]*domain.Attachment
+	// byMessage holds each message's attachments in the order they were
+	// created.
+	byMessage map[string][]*domain.Attachment
+	mu        sync.RWMutex
+}
+
+func NewInMemoryAttachmentRepository() *InMemoryAttachmentRepository {
+	return &InMemoryAttachmentRepository{
+		attachments: make(map[string]*domain.Attachment),
+		byMessage:   make(map[string][]*domain.Attachment),
+	}
+}
+
+func (r *InMemoryAttachmentRepository) Create(attachment *domain.Attachment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.attachments[attachment.ID]; exists {
+		return errors.New("attachment already exists")
+	}
+
+	r.attachments[attachment.ID] = attachment
+	r.byMessage[attachment.MessageID] = append(r.byMessage[attachment.MessageID], attachment)
+	return nil
+}
+
+func (r *InMemoryAttachmentRepository) GetByID(id string) (*domain.Attachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	attachment, exists := r.attachments[id]
+	if !exists {
+		return nil, errors.New("attachment not found")
+	}
+
+	return attachment, nil
+}
+
+func (r *InMemoryAttachmentRepository) GetByMessageIDs(messageIDs []string) (map[string][]*domain.Attachment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string][]*domain.Attachment)
+	for _, id := range messageIDs {
+		if attachments := r.byMessage[id]; len(attachments) > 0 {
+			result[id] = append([]*domain.Attachment(nil), attachments...)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+type InMemoryBlobStorage struct {
+	blobs map[string][]byte
+	mu    sync.RWMutex
+}
+
+func NewInMemoryBlobStorage() *InMemoryBlobStorage {
+	return &InMemoryBlobStorage{
+		blobs: make(map[string][]byte),
+	}
+}
+
+func (r *InMemoryBlobStorage) Put(key string, content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.blobs[key] = data
+	return nil
+}
+
+func (r *InMemoryBlobStorage) Open(key string) (io.ReadCloser, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	data, exists := r.blobs[key]
+	if !exists {
+		return nil, errors.New("blob not found")
+	}
+
+	// Put replaces the slice rather than writing into it, so readers can
+	// share it.
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (r *InMemoryBlobStorage) Delete(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.blobs[key]; !exists {
+		return errors.New("blob not found")
+	}
+
+	delete(r.blobs, key)
+	return nil
+}
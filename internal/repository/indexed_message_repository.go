@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"log"
+
+	"gochat/internal/domain"
+)
+
+// IndexedMessageRepository keeps a search index in step with the messages
+// stored in the repository it wraps, whatever the backend of either. Once a
+// message is stored, failing to index it is only logged: the message itself
+// is saved, and reporting an error would have the caller retry a write that
+// already happened.
+type IndexedMessageRepository struct {
+	domain.MessageRepository
+	index domain.SearchIndex
+}
+
+func NewIndexedMessageRepository(messages domain.MessageRepository, index domain.SearchIndex) *IndexedMessageRepository {
+	return &IndexedMessageRepository{
+		MessageRepository: messages,
+		index:             index,
+	}
+}
+
+// Create indexes the new message unless it is a system message; those record
+// events rather than anything somebody said.
+func (r *IndexedMessageRepository) Create(message *domain.Message) error {
+	if err := r.MessageRepository.Create(message); err != nil {
+		return err
+	}
+	if message.Kind == domain.MessageKindSystem {
+		return nil
+	}
+	if err := r.index.Index(message); err != nil {
+		log.Printf("Failed to index message %s: %v", message.ID, err)
+	}
+	return nil
+}
+
+// Update reindexes the stored message, since the update carries only the
+// fields that changed, and drops deleted messages from the index.
+func (r *IndexedMessageRepository) Update(message *domain.Message) error {
+	if err := r.MessageRepository.Update(message); err != nil {
+		return err
+	}
+
+	stored, err := r.MessageRepository.GetByID(message.ID)
+	if err != nil {
+		log.Printf("Failed to reindex message %s: %v", message.ID, err)
+		return nil
+	}
+	if stored.DeletedAt != nil {
+		err = r.index.Remove(stored.ID)
+	} else {
+		err = r.index.Index(stored)
+	}
+	if err != nil {
+		log.Printf("Failed to reindex message %s: %v", message.ID, err)
+	}
+	return nil
+}
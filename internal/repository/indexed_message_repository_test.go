@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func TestIndexedMessageRepository_KeepsIndexInStep(t *testing.T) {
+	index := NewInMemorySearchIndex()
+	repo := NewIndexedMessageRepository(NewInMemoryMessageRepository(), index)
+
+	found := func(word string) []domain.SearchResult {
+		t.Helper()
+		results, err := index.Search(domain.SearchQuery{Terms: []string{word}, RoomIDs: []string{"room1"}, Limit: 10})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return results
+	}
+
+	message := &domain.Message{ID: "1", RoomID: "room1", UserID: "user1", Content: "hello world", CreatedAt: time.Now()}
+	if err := repo.Create(message); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if results := found("hello"); len(results) != 1 || results[0].MessageID != "1" {
+		t.Errorf("Expected the new message to be indexed, got %+v", results)
+	}
+
+	editedAt := time.Now()
+	if err := repo.Update(&domain.Message{ID: "1", Content: "goodbye world", EditedAt: &editedAt}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if results := found("hello"); len(results) != 0 {
+		t.Errorf("Expected the old content to be gone from the index, got %+v", results)
+	}
+	if results := found("goodbye"); len(results) != 1 {
+		t.Errorf("Expected the edit to be indexed, got %+v", results)
+	}
+
+	deletedAt := time.Now()
+	if err := repo.Update(&domain.Message{ID: "1", DeletedAt: &deletedAt}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if results := found("world"); len(results) != 0 {
+		t.Errorf("Expected the deleted message to leave the index, got %+v", results)
+	}
+}
+
+func TestIndexedMessageRepository_SkipsSystemMessages(t *testing.T) {
+	index := NewInMemorySearchIndex()
+	repo := NewIndexedMessageRepository(NewInMemoryMessageRepository(), index)
+
+	message := &domain.Message{ID: "1", RoomID: "room1", Kind: domain.MessageKindSystem, Content: "alice entered the room", CreatedAt: time.Now()}
+	if err := repo.Create(message); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	results, err := index.Search(domain.SearchQuery{Terms: []string{"alice"}, RoomIDs: []string{"room1"}, Limit: 10})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Expected system messages to stay out of the index, got %+v", results)
+	}
+}
+
+type failingSearchIndex struct {
+	domain.SearchIndex
+}
+
+func (failingSearchIndex) Index(*domain.Message) error { return errors.New("index unavailable") }
+func (failingSearchIndex) Remove(string) error         { return errors.New("index unavailable") }
+
+func TestIndexedMessageRepository_IndexFailureKeepsMessage(t *testing.T) {
+	messages := NewInMemoryMessageRepository()
+	repo := NewIndexedMessageRepository(messages, failingSearchIndex{})
+
+	message := &domain.Message{ID: "1", RoomID: "room1", UserID: "user1", Content: "hello world", CreatedAt: time.Now()}
+	if err := repo.Create(message); err != nil {
+		t.Fatalf("Expected the stored message to be reported as created, got %v", err)
+	}
+
+	editedAt := time.Now()
+	if err := repo.Update(&domain.Message{ID: "1", Content: "goodbye world", EditedAt: &editedAt}); err != nil {
+		t.Fatalf("Expected the stored edit to be reported as saved, got %v", err)
+	}
+	stored, err := messages.GetByID("1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if stored.Content != "goodbye world" {
+		t.Errorf("Expected the edit to be stored, got %q", stored.Content)
+	}
+
+	deletedAt := time.Now()
+	if err := repo.Update(&domain.Message{ID: "1", DeletedAt: &deletedAt}); err != nil {
+		t.Errorf("Expected the stored deletion to be reported as saved, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalBlobStorage keeps each blob in a file named after its key in one
+// directory.
+type LocalBlobStorage struct {
+	dir string
+}
+
+// NewLocalBlobStorage uses dir for blobs, creating it if needed.
+func NewLocalBlobStorage(dir string) (*LocalBlobStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalBlobStorage{
+		dir: dir,
+	}, nil
+}
+
+func (r *LocalBlobStorage) Put(key string, content io.Reader) error {
+	path, err := r.path(key)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a failed upload never leaves
+	// a truncated blob behind, and readers never see one half-written.
+	tmp, err := os.CreateTemp(r.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (r *LocalBlobStorage) Open(key string) (io.ReadCloser, error) {
+	path, err := r.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.New("blob not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (r *LocalBlobStorage) Delete(key string) error {
+	path, err := r.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return errors.New("blob not found")
+	}
+	return err
+}
+
+// path maps a key to its file, refusing keys that would leave the directory
+// or collide with temporary files.
+func (r *LocalBlobStorage) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || key[0] == '.' {
+		return "", errors.New("invalid blob key")
+	}
+	return filepath.Join(r.dir, key), nil
+}
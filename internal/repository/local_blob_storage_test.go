@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalBlobStorage_RejectsKeysOutsideDir(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewLocalBlobStorage(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatalf("Failed to create blob storage: %v", err)
+	}
+
+	for _, key := range []string{"", "../escape", "sub/blob", ".upload-1", ".."} {
+		if err := storage.Put(key, strings.NewReader("x")); err == nil {
+			t.Errorf("Expected error for key %q, got nil", key)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "escape")); err == nil {
+		t.Error("Expected no file to be written outside the blob directory")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatalf("Failed to read blob directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no leftover files, got %d", len(entries))
+	}
+}
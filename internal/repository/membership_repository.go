@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"gochat/internal/domain"
+)
+
+type InMemoryMembershipRepository struct {
+	// members and invitations are keyed by room ID, then by user ID.
+	members     map[string]map[string]*domain.Membership
+	invitations map[string]map[string]*domain.Invitation
+	mu          sync.RWMutex
+}
+
+func NewInMemoryMembershipRepository() *InMemoryMembershipRepository {
+	return &InMemoryMembershipRepository{
+		members:     make(map[string]map[string]*domain.Membership),
+		invitations: make(map[string]map[string]*domain.Invitation),
+	}
+}
+
+func (r *InMemoryMembershipRepository) Add(membership *domain.Membership) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members := r.members[membership.RoomID]
+	if members == nil {
+		members = make(map[string]*domain.Membership)
+		r.members[membership.RoomID] = members
+	}
+	if _, exists := members[membership.UserID]; exists {
+		return errors.New("user is already a member")
+	}
+
+	members[membership.UserID] = membership
+	return nil
+}
+
+func (r *InMemoryMembershipRepository) Get(roomID, userID string) (*domain.Membership, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	membership, exists := r.members[roomID][userID]
+	if !exists {
+		return nil, errors.New("membership not found")
+	}
+
+	found := *membership
+	return &found, nil
+}
+
+func (r *InMemoryMembershipRepository) SetRole(roomID, userID, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	membership, exists := r.members[roomID][userID]
+	if !exists {
+		return errors.New("membership not found")
+	}
+
+	updated := *membership
+	updated.Role = role
+	r.members[roomID][userID] = &updated
+	return nil
+}
+
+func (r *InMemoryMembershipRepository) Remove(roomID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.members[roomID][userID]; !exists {
+		return errors.New("membership not found")
+	}
+
+	delete(r.members[roomID], userID)
+	if len(r.members[roomID]) == 0 {
+		delete(r.members, roomID)
+	}
+	return nil
+}
+
+func (r *InMemoryMembershipRepository) IsMember(roomID, userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, exists := r.members[roomID][userID]
+	return exists
+}
+
+func (r *InMemoryMembershipRepository) GetRoomIDsByUserID(userID string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	memberships := make([]*domain.Membership, 0)
+	for _, members := range r.members {
+		if membership, exists := members[userID]; exists {
+			memberships = append(memberships, membership)
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool {
+		if !memberships[i].JoinedAt.Equal(memberships[j].JoinedAt) {
+			return memberships[i].JoinedAt.Before(memberships[j].JoinedAt)
+		}
+		return memberships[i].RoomID < memberships[j].RoomID
+	})
+
+	roomIDs := make([]string, len(memberships))
+	for i, membership := range memberships {
+		roomIDs[i] = membership.RoomID
+	}
+	return roomIDs, nil
+}
+
+func (r *InMemoryMembershipRepository) AddInvitation(invitation *domain.Invitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invitations := r.invitations[invitation.RoomID]
+	if invitations == nil {
+		invitations = make(map[string]*domain.Invitation)
+		r.invitations[invitation.RoomID] = invitations
+	}
+	if _, exists := invitations[invitation.UserID]; exists {
+		return errors.New("user is already invited")
+	}
+
+	invitations[invitation.UserID] = invitation
+	return nil
+}
+
+func (r *InMemoryMembershipRepository) GetInvitation(roomID, userID string) (*domain.Invitation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	invitation, exists := r.invitations[roomID][userID]
+	if !exists {
+		return nil, errors.New("invitation not found")
+	}
+	return invitation, nil
+}
+
+func (r *InMemoryMembershipRepository) RemoveInvitation(roomID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.invitations[roomID][userID]; !exists {
+		return errors.New("invitation not found")
+	}
+
+	delete(r.invitations[roomID], userID)
+	if len(r.invitations[roomID]) == 0 {
+		delete(r.invitations, roomID)
+	}
+	return nil
+}
+
+func (r *InMemoryMembershipRepository) GetInvitationsByUserID(userID string) ([]*domain.Invitation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]*domain.Invitation, 0)
+	for _, invitations := range r.invitations {
+		if invitation, exists := invitations[userID]; exists {
+			result = append(result, invitation)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].RoomID < result[j].RoomID
+	})
+
+	return result, nil
+}
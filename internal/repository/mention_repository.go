@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+type mentionEntry struct {
+	messageID string
+	createdAt time.Time
+	mention   domain.Mention
+	seen      bool
+}
+
+type InMemoryMentionRepository struct {
+	// entries holds every mention in the order it was added.
+	entries   []*mentionEntry
+	byMessage map[string][]*mentionEntry
+	mu        sync.RWMutex
+}
+
+func NewInMemoryMentionRepository() *InMemoryMentionRepository {
+	return &InMemoryMentionRepository{
+		byMessage: make(map[string][]*mentionEntry),
+	}
+}
+
+func (r *InMemoryMentionRepository) Add(messageID string, createdAt time.Time, mentions []domain.Mention) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, mention := range mentions {
+		for _, entry := range r.byMessage[messageID] {
+			if entry.mention.UserID == mention.UserID {
+				return errors.New("mention already exists")
+			}
+		}
+
+		entry := &mentionEntry{messageID: messageID, createdAt: createdAt, mention: mention}
+		r.entries = append(r.entries, entry)
+		r.byMessage[messageID] = append(r.byMessage[messageID], entry)
+	}
+	return nil
+}
+
+func (r *InMemoryMentionRepository) GetByMessageIDs(messageIDs []string) (map[string][]domain.Mention, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string][]domain.Mention)
+	for _, id := range messageIDs {
+		for _, entry := range r.byMessage[id] {
+			result[id] = append(result[id], entry.mention)
+		}
+	}
+	return result, nil
+}
+
+func (r *InMemoryMentionRepository) GetUnseen(userID string, limit int) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var unseen []*mentionEntry
+	for _, entry := range r.entries {
+		if entry.mention.UserID == userID && !entry.seen {
+			unseen = append(unseen, entry)
+		}
+	}
+
+	sort.SliceStable(unseen, func(i, j int) bool {
+		return unseen[i].createdAt.Before(unseen[j].createdAt)
+	})
+
+	if limit > 0 && len(unseen) > limit {
+		unseen = unseen[:limit]
+	}
+
+	ids := make([]string, len(unseen))
+	for i, entry := range unseen {
+		ids[i] = entry.messageID
+	}
+	return ids, nil
+}
+
+func (r *InMemoryMentionRepository) MarkSeen(userID string, messageIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range messageIDs {
+		for _, entry := range r.byMessage[id] {
+			if entry.mention.UserID == userID {
+				entry.seen = true
+			}
+		}
+	}
+	return nil
+}
@@ -11,13 +11,17 @@ import (
 type InMemoryMessageRepository struct {
 	messages     map[string]*domain.Message
 	roomMessages map[string][]*domain.Message
-	mu           sync.RWMutex
+	// replies holds message IDs rather than pointers so that Update does
+	// not have to find and swap them here as well.
+	replies map[string][]string
+	mu      sync.RWMutex
 }
 
 func NewInMemoryMessageRepository() *InMemoryMessageRepository {
 	return &InMemoryMessageRepository{
 		messages:     make(map[string]*domain.Message),
 		roomMessages: make(map[string][]*domain.Message),
+		replies:      make(map[string][]string),
 	}
 }
 
@@ -25,37 +29,75 @@ func (r *InMemoryMessageRepository) Create(message *domain.Message) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if _, exists := r.messages[message.ID]; exists {
+		return errors.New("message already exists")
+	}
+
+	message.Seq = int64(len(r.roomMessages[message.RoomID]) + 1)
 	r.messages[message.ID] = message
 	r.roomMessages[message.RoomID] = append(r.roomMessages[message.RoomID], message)
+	if message.ParentID != "" {
+		r.replies[message.ParentID] = append(r.replies[message.ParentID], message.ID)
+	}
 	return nil
 }
 
-func (r *InMemoryMessageRepository) GetByRoomID(roomID string, limit, offset int) ([]*domain.Message, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+func (r *InMemoryMessageRepository) Update(message *domain.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	messages, exists := r.roomMessages[roomID]
+	stored, exists := r.messages[message.ID]
 	if !exists {
-		return []*domain.Message{}, nil
+		return errors.New("message not found")
 	}
 
-	sortedMessages := make([]*domain.Message, len(messages))
-	copy(sortedMessages, messages)
-	sort.Slice(sortedMessages, func(i, j int) bool {
-		return sortedMessages[i].CreatedAt.Before(sortedMessages[j].CreatedAt)
+	// Readers may still hold the old pointer, so replace it instead of
+	// modifying it in place.
+	updated := *stored
+	updated.Content = message.Content
+	updated.EditedAt = message.EditedAt
+	updated.DeletedAt = message.DeletedAt
+
+	r.messages[message.ID] = &updated
+	r.roomMessages[stored.RoomID][stored.Seq-1] = &updated
+	return nil
+}
+
+func (r *InMemoryMessageRepository) GetByRoomIDBefore(roomID string, beforeSeq int64, limit int) ([]*domain.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := r.roomMessages[roomID]
+
+	end := sort.Search(len(messages), func(i int) bool {
+		return messages[i].Seq >= beforeSeq
 	})
 
-	start := offset
-	if start > len(sortedMessages) {
-		return []*domain.Message{}, nil
+	start := end - limit
+	if start < 0 {
+		start = 0
 	}
 
+	return copyMessages(messages[start:end]), nil
+}
+
+func (r *InMemoryMessageRepository) GetByRoomIDSince(roomID string, sinceSeq int64, limit int) ([]*domain.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := r.roomMessages[roomID]
+
+	// roomMessages is appended in Seq order, so it can be searched directly.
+	start := sort.Search(len(messages), func(i int) bool {
+		return messages[i].Seq > sinceSeq
+	})
+
 	end := start + limit
-	if end > len(sortedMessages) {
-		end = len(sortedMessages)
+	if end > len(messages) {
+		end = len(messages)
 	}
 
-	return sortedMessages[start:end], nil
+	return copyMessages(messages[start:end]), nil
 }
 
 func (r *InMemoryMessageRepository) GetByID(id string) (*domain.Message, error) {
@@ -69,3 +111,86 @@ func (r *InMemoryMessageRepository) GetByID(id string) (*domain.Message, error)
 
 	return message, nil
 }
+
+func (r *InMemoryMessageRepository) GetByIDs(ids []string) (map[string]*domain.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	messages := make(map[string]*domain.Message, len(ids))
+	for _, id := range ids {
+		if message, exists := r.messages[id]; exists {
+			messages[id] = message
+		}
+	}
+
+	return messages, nil
+}
+
+func (r *InMemoryMessageRepository) GetReplies(parentID string, limit, offset int) ([]*domain.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := r.replies[parentID]
+
+	start := offset
+	if start > len(ids) {
+		return []*domain.Message{}, nil
+	}
+
+	end := start + limit
+	if end > len(ids) {
+		end = len(ids)
+	}
+
+	result := make([]*domain.Message, 0, end-start)
+	for _, id := range ids[start:end] {
+		result = append(result, r.messages[id])
+	}
+	return result, nil
+}
+
+func (r *InMemoryMessageRepository) CountReplies(parentIDs []string) (map[string]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, id := range parentIDs {
+		if n := len(r.replies[id]); n > 0 {
+			counts[id] = n
+		}
+	}
+	return counts, nil
+}
+
+func (r *InMemoryMessageRepository) CountSinceMany(sinceSeqs map[string]int64, excludeUserID string) (map[string]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for roomID, sinceSeq := range sinceSeqs {
+		messages := r.roomMessages[roomID]
+		start := sort.Search(len(messages), func(i int) bool {
+			return messages[i].Seq > sinceSeq
+		})
+
+		for _, message := range messages[start:] {
+			if message.DeletedAt == nil && message.Kind != domain.MessageKindSystem && message.UserID != excludeUserID {
+				counts[roomID]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+func (r *InMemoryMessageRepository) LastSeq(roomID string) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.roomMessages[roomID])), nil
+}
+
+func copyMessages(messages []*domain.Message) []*domain.Message {
+	result := make([]*domain.Message, len(messages))
+	copy(result, messages)
+	return result
+}
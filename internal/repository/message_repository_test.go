@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -25,7 +26,7 @@ func TestInMemoryMessageRepository_Create(t *testing.T) {
 	}
 }
 
-func TestInMemoryMessageRepository_GetByRoomID(t *testing.T) {
+func TestInMemoryMessageRepository_GetByRoomIDBefore(t *testing.T) {
 	repo := NewInMemoryMessageRepository()
 
 	roomID := "room1"
@@ -62,7 +63,7 @@ func TestInMemoryMessageRepository_GetByRoomID(t *testing.T) {
 		}
 	}
 
-	retrieved, err := repo.GetByRoomID(roomID, 10, 0)
+	retrieved, err := repo.GetByRoomIDBefore(roomID, math.MaxInt64, 10)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -75,22 +76,22 @@ func TestInMemoryMessageRepository_GetByRoomID(t *testing.T) {
 		t.Errorf("Expected first message ID to be '1', got %s", retrieved[0].ID)
 	}
 
-	limited, err := repo.GetByRoomID(roomID, 2, 0)
+	limited, err := repo.GetByRoomIDBefore(roomID, math.MaxInt64, 2)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 
-	if len(limited) != 2 {
-		t.Errorf("Expected 2 messages with limit, got %d", len(limited))
+	if len(limited) != 2 || limited[0].ID != "2" {
+		t.Errorf("Expected the 2 newest messages with limit, got %d", len(limited))
 	}
 
-	offset, err := repo.GetByRoomID(roomID, 10, 1)
+	older, err := repo.GetByRoomIDBefore(roomID, limited[0].Seq, 10)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 
-	if len(offset) != 2 {
-		t.Errorf("Expected 2 messages with offset, got %d", len(offset))
+	if len(older) != 1 || older[0].ID != "1" {
+		t.Errorf("Expected 1 message before the newest page, got %d", len(older))
 	}
 }
 
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+
+	"gochat/internal/domain"
+)
+
+type InMemoryReactionRepository struct {
+	// reactions holds each message's reactions in the order they were added.
+	reactions map[string][]*domain.Reaction
+	mu        sync.RWMutex
+}
+
+func NewInMemoryReactionRepository() *InMemoryReactionRepository {
+	return &InMemoryReactionRepository{
+		reactions: make(map[string][]*domain.Reaction),
+	}
+}
+
+func (r *InMemoryReactionRepository) Add(reaction *domain.Reaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.reactions[reaction.MessageID] {
+		if existing.UserID == reaction.UserID && existing.Emoji == reaction.Emoji {
+			return errors.New("reaction already exists")
+		}
+	}
+
+	r.reactions[reaction.MessageID] = append(r.reactions[reaction.MessageID], reaction)
+	return nil
+}
+
+func (r *InMemoryReactionRepository) Remove(messageID, userID, emoji string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reactions := r.reactions[messageID]
+	for i, existing := range reactions {
+		if existing.UserID == userID && existing.Emoji == emoji {
+			remaining := make([]*domain.Reaction, 0, len(reactions)-1)
+			remaining = append(remaining, reactions[:i]...)
+			remaining = append(remaining, reactions[i+1:]...)
+
+			if len(remaining) == 0 {
+				delete(r.reactions, messageID)
+			} else {
+				r.reactions[messageID] = remaining
+			}
+			return nil
+		}
+	}
+
+	return errors.New("reaction not found")
+}
+
+func (r *InMemoryReactionRepository) CountByMessageIDs(messageIDs []string) (map[string][]domain.ReactionCount, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make(map[string][]domain.ReactionCount)
+	for _, id := range messageIDs {
+		reactions := r.reactions[id]
+		if len(reactions) == 0 {
+			continue
+		}
+
+		counts := make([]domain.ReactionCount, 0)
+		index := make(map[string]int)
+		for _, reaction := range reactions {
+			i, seen := index[reaction.Emoji]
+			if !seen {
+				i = len(counts)
+				index[reaction.Emoji] = i
+				counts = append(counts, domain.ReactionCount{Emoji: reaction.Emoji})
+			}
+			counts[i].Count++
+		}
+		result[id] = counts
+	}
+
+	return result, nil
+}
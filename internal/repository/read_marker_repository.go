@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+
+	"gochat/internal/domain"
+)
+
+type InMemoryReadMarkerRepository struct {
+	// markers maps user IDs to their markers by room ID.
+	markers map[string]map[string]*domain.ReadMarker
+	mu      sync.RWMutex
+}
+
+func NewInMemoryReadMarkerRepository() *InMemoryReadMarkerRepository {
+	return &InMemoryReadMarkerRepository{
+		markers: make(map[string]map[string]*domain.ReadMarker),
+	}
+}
+
+func (r *InMemoryReadMarkerRepository) Put(marker *domain.ReadMarker) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rooms, exists := r.markers[marker.UserID]
+	if !exists {
+		rooms = make(map[string]*domain.ReadMarker)
+		r.markers[marker.UserID] = rooms
+	}
+
+	stored := *marker
+	rooms[marker.RoomID] = &stored
+	return nil
+}
+
+func (r *InMemoryReadMarkerRepository) Get(userID, roomID string) (*domain.ReadMarker, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	marker, exists := r.markers[userID][roomID]
+	if !exists {
+		return nil, errors.New("read marker not found")
+	}
+	return marker, nil
+}
+
+func (r *InMemoryReadMarkerRepository) GetByUserID(userID string) ([]*domain.ReadMarker, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	markers := make([]*domain.ReadMarker, 0, len(r.markers[userID]))
+	for _, marker := range r.markers[userID] {
+		markers = append(markers, marker)
+	}
+	return markers, nil
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"testing"
+
+	"gochat/internal/domain"
+	"gochat/internal/repository/repotest"
+)
+
+func TestInMemoryRepositories(t *testing.T) {
+	repotest.Run(t, repotest.Factory{
+		NewUserRepository: func(t *testing.T) domain.UserRepository {
+			return NewInMemoryUserRepository()
+		},
+		NewRoomRepository: func(t *testing.T) domain.RoomRepository {
+			return NewInMemoryRoomRepository()
+		},
+		NewMessageRepository: func(t *testing.T) domain.MessageRepository {
+			return NewInMemoryMessageRepository()
+		},
+		NewReactionRepository: func(t *testing.T) domain.ReactionRepository {
+			return NewInMemoryReactionRepository()
+		},
+		NewMembershipRepository: func(t *testing.T) domain.MembershipRepository {
+			return NewInMemoryMembershipRepository()
+		},
+		NewSanctionRepository: func(t *testing.T) domain.SanctionRepository {
+			return NewInMemorySanctionRepository()
+		},
+		NewReadMarkerRepository: func(t *testing.T) domain.ReadMarkerRepository {
+			return NewInMemoryReadMarkerRepository()
+		},
+		NewSearchIndex: func(t *testing.T) domain.SearchIndex {
+			return NewInMemorySearchIndex()
+		},
+		NewAttachmentRepository: func(t *testing.T) domain.AttachmentRepository {
+			return NewInMemoryAttachmentRepository()
+		},
+		NewBlobStorage: func(t *testing.T) domain.BlobStorage {
+			return NewInMemoryBlobStorage()
+		},
+		NewMentionRepository: func(t *testing.T) domain.MentionRepository {
+			return NewInMemoryMentionRepository()
+		},
+	})
+}
+
+func TestSQLiteRepositories(t *testing.T) {
+	repotest.Run(t, repotest.Factory{
+		NewUserRepository: func(t *testing.T) domain.UserRepository {
+			return NewSQLiteUserRepository(newTestSQLiteDB(t))
+		},
+		NewRoomRepository: func(t *testing.T) domain.RoomRepository {
+			return NewSQLiteRoomRepository(newTestSQLiteDB(t))
+		},
+		NewMessageRepository: func(t *testing.T) domain.MessageRepository {
+			return NewSQLiteMessageRepository(newTestSQLiteDB(t))
+		},
+		NewReactionRepository: func(t *testing.T) domain.ReactionRepository {
+			return NewSQLiteReactionRepository(newTestSQLiteDB(t))
+		},
+		NewMembershipRepository: func(t *testing.T) domain.MembershipRepository {
+			return NewSQLiteMembershipRepository(newTestSQLiteDB(t))
+		},
+		NewSanctionRepository: func(t *testing.T) domain.SanctionRepository {
+			return NewSQLiteSanctionRepository(newTestSQLiteDB(t))
+		},
+		NewReadMarkerRepository: func(t *testing.T) domain.ReadMarkerRepository {
+			return NewSQLiteReadMarkerRepository(newTestSQLiteDB(t))
+		},
+		NewSearchIndex: func(t *testing.T) domain.SearchIndex {
+			return NewSQLiteSearchIndex(newTestSQLiteDB(t))
+		},
+		NewAttachmentRepository: func(t *testing.T) domain.AttachmentRepository {
+			return NewSQLiteAttachmentRepository(newTestSQLiteDB(t))
+		},
+		NewBlobStorage: func(t *testing.T) domain.BlobStorage {
+			storage, err := NewLocalBlobStorage(t.TempDir())
+			if err != nil {
+				t.Fatalf("Failed to create blob storage: %v", err)
+			}
+			return storage
+		},
+		NewMentionRepository: func(t *testing.T) domain.MentionRepository {
+			return NewSQLiteMentionRepository(newTestSQLiteDB(t))
+		},
+	})
+}
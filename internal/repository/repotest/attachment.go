@@ -0,0 +1,105 @@
+package repotest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func RunAttachmentRepositoryTests(t *testing.T, newRepo func(t *testing.T) domain.AttachmentRepository) {
+	t.Run("CreateAndGetByID", func(t *testing.T) {
+		repo := newRepo(t)
+
+		attachment := newAttachment("a1", "msg1")
+		if err := repo.Create(attachment); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		found, err := repo.GetByID("a1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if found.MessageID != "msg1" || found.RoomID != "room1" || found.UserID != "user1" ||
+			found.Filename != "a1.txt" || found.ContentType != "text/plain" || found.Size != 42 ||
+			!found.CreatedAt.Equal(attachmentEpoch) {
+			t.Errorf("Expected stored fields back, got %+v", found)
+		}
+
+		if _, err := repo.GetByID("missing"); err == nil {
+			t.Error("Expected error for missing attachment, got nil")
+		}
+	})
+
+	t.Run("CreateDuplicate", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Create(newAttachment("a1", "msg1")); err != nil {
+			t.Fatalf("Failed to create attachment: %v", err)
+		}
+		if err := repo.Create(newAttachment("a1", "msg2")); err == nil {
+			t.Error("Expected error for duplicate attachment, got nil")
+		}
+	})
+
+	t.Run("GetByMessageIDs", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, attachment := range []*domain.Attachment{
+			newAttachment("a2", "msg1"),
+			newAttachment("a1", "msg1"),
+			newAttachment("a3", "msg2"),
+			newAttachment("a4", "msg3"),
+		} {
+			if err := repo.Create(attachment); err != nil {
+				t.Fatalf("Failed to create attachment: %v", err)
+			}
+		}
+
+		found, err := repo.GetByMessageIDs([]string{"msg1", "msg2", "msg4"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(found) != 2 {
+			t.Fatalf("Expected attachments of 2 messages, got %v", found)
+		}
+		if ids := attachmentIDs(found["msg1"]); ids != "[a2 a1]" {
+			t.Errorf("Expected msg1 attachments in creation order, got %s", ids)
+		}
+		if ids := attachmentIDs(found["msg2"]); ids != "[a3]" {
+			t.Errorf("Expected msg2 attachments [a3], got %s", ids)
+		}
+
+		empty, err := repo.GetByMessageIDs(nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if empty == nil || len(empty) != 0 {
+			t.Errorf("Expected empty non-nil map, got %v", empty)
+		}
+	})
+}
+
+var attachmentEpoch = time.Now().Truncate(time.Microsecond)
+
+func newAttachment(id, messageID string) *domain.Attachment {
+	return &domain.Attachment{
+		ID:          id,
+		MessageID:   messageID,
+		RoomID:      "room1",
+		UserID:      "user1",
+		Filename:    id + ".txt",
+		ContentType: "text/plain",
+		Size:        42,
+		CreatedAt:   attachmentEpoch,
+	}
+}
+
+func attachmentIDs(attachments []*domain.Attachment) string {
+	ids := make([]string, len(attachments))
+	for i, attachment := range attachments {
+		ids[i] = attachment.ID
+	}
+	return fmt.Sprint(ids)
+}
@@ -0,0 +1,76 @@
+package repotest
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"gochat/internal/domain"
+)
+
+func RunBlobStorageTests(t *testing.T, newStorage func(t *testing.T) domain.BlobStorage) {
+	t.Run("PutAndOpen", func(t *testing.T) {
+		storage := newStorage(t)
+
+		if err := storage.Put("blob1", strings.NewReader("hello")); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if got := readBlob(t, storage, "blob1"); got != "hello" {
+			t.Errorf("Expected content hello, got %q", got)
+		}
+
+		if _, err := storage.Open("missing"); err == nil {
+			t.Error("Expected error for missing blob, got nil")
+		}
+	})
+
+	t.Run("PutReplaces", func(t *testing.T) {
+		storage := newStorage(t)
+
+		if err := storage.Put("blob1", strings.NewReader("first")); err != nil {
+			t.Fatalf("Failed to put blob: %v", err)
+		}
+		if err := storage.Put("blob1", strings.NewReader("second")); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if got := readBlob(t, storage, "blob1"); got != "second" {
+			t.Errorf("Expected content second, got %q", got)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		storage := newStorage(t)
+
+		if err := storage.Put("blob1", strings.NewReader("hello")); err != nil {
+			t.Fatalf("Failed to put blob: %v", err)
+		}
+		if err := storage.Delete("blob1"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if _, err := storage.Open("blob1"); err == nil {
+			t.Error("Expected deleted blob to be gone")
+		}
+		if err := storage.Delete("blob1"); err == nil {
+			t.Error("Expected error deleting a missing blob, got nil")
+		}
+	})
+}
+
+func readBlob(t *testing.T, storage domain.BlobStorage, key string) string {
+	t.Helper()
+
+	content, err := storage.Open(key)
+	if err != nil {
+		t.Fatalf("Failed to open blob: %v", err)
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		t.Fatalf("Failed to read blob: %v", err)
+	}
+	return string(data)
+}
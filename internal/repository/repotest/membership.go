@@ -0,0 +1,188 @@
+package repotest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func RunMembershipRepositoryTests(t *testing.T, newRepo func(t *testing.T) domain.MembershipRepository) {
+	t.Run("AddAndIsMember", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if repo.IsMember("room1", "user1") {
+			t.Error("Expected user to not be a member")
+		}
+
+		if err := repo.Add(newMembership("room1", "user1", 0)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !repo.IsMember("room1", "user1") {
+			t.Error("Expected user to be a member")
+		}
+		if repo.IsMember("room2", "user1") || repo.IsMember("room1", "user2") {
+			t.Error("Expected membership to be limited to its room and user")
+		}
+
+		if err := repo.Add(newMembership("room1", "user1", 1)); err == nil {
+			t.Error("Expected error for duplicate membership, got nil")
+		}
+	})
+
+	t.Run("Roles", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if _, err := repo.Get("room1", "user1"); err == nil {
+			t.Error("Expected error for missing membership, got nil")
+		}
+		if err := repo.SetRole("room1", "user1", domain.RoleModerator); err == nil {
+			t.Error("Expected error setting the role of a missing membership, got nil")
+		}
+
+		owner := newMembership("room1", "user1", 0)
+		owner.Role = domain.RoleOwner
+		if err := repo.Add(owner); err != nil {
+			t.Fatalf("Failed to add membership: %v", err)
+		}
+		if err := repo.Add(newMembership("room1", "user2", 1)); err != nil {
+			t.Fatalf("Failed to add membership: %v", err)
+		}
+
+		membership, err := repo.Get("room1", "user1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if membership.Role != domain.RoleOwner || !membership.JoinedAt.Equal(owner.JoinedAt) {
+			t.Errorf("Expected owner membership joined at %v, got %+v", owner.JoinedAt, membership)
+		}
+
+		if err := repo.SetRole("room1", "user2", domain.RoleModerator); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		membership, err = repo.Get("room1", "user2")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if membership.Role != domain.RoleModerator {
+			t.Errorf("Expected role %q, got %q", domain.RoleModerator, membership.Role)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Add(newMembership("room1", "user1", 0)); err != nil {
+			t.Fatalf("Failed to add membership: %v", err)
+		}
+
+		if err := repo.Remove("room1", "user1"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if repo.IsMember("room1", "user1") {
+			t.Error("Expected membership to be removed")
+		}
+
+		if err := repo.Remove("room1", "user1"); err == nil {
+			t.Error("Expected error for missing membership, got nil")
+		}
+	})
+
+	t.Run("GetRoomIDsByUserID", func(t *testing.T) {
+		repo := newRepo(t)
+
+		roomIDs, err := repo.GetRoomIDsByUserID("user1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if roomIDs == nil || len(roomIDs) != 0 {
+			t.Errorf("Expected empty non-nil slice, got %v", roomIDs)
+		}
+
+		for _, membership := range []*domain.Membership{
+			newMembership("room2", "user1", 0),
+			newMembership("room1", "user1", 1),
+			newMembership("room3", "user2", 2),
+		} {
+			if err := repo.Add(membership); err != nil {
+				t.Fatalf("Failed to add membership: %v", err)
+			}
+		}
+
+		roomIDs, err = repo.GetRoomIDsByUserID("user1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if want := []string{"room2", "room1"}; !reflect.DeepEqual(roomIDs, want) {
+			t.Errorf("Expected rooms %v in join order, got %v", want, roomIDs)
+		}
+	})
+
+	t.Run("Invitations", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if _, err := repo.GetInvitation("room1", "user2"); err == nil {
+			t.Fatal("Expected error for missing invitation, got nil")
+		}
+
+		for _, invitation := range []*domain.Invitation{
+			newInvitation("room2", "user2", 0),
+			newInvitation("room1", "user2", 1),
+			newInvitation("room1", "user3", 2),
+		} {
+			if err := repo.AddInvitation(invitation); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		if err := repo.AddInvitation(newInvitation("room1", "user2", 3)); err == nil {
+			t.Error("Expected error for duplicate invitation, got nil")
+		}
+
+		invitation, err := repo.GetInvitation("room1", "user2")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if invitation.InvitedBy != "user1" {
+			t.Errorf("Expected invitation from user1, got %s", invitation.InvitedBy)
+		}
+
+		invitations, err := repo.GetInvitationsByUserID("user2")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(invitations) != 2 || invitations[0].RoomID != "room2" || invitations[1].RoomID != "room1" {
+			t.Errorf("Expected invitations to room2 and room1, oldest first, got %v", invitations)
+		}
+
+		if err := repo.RemoveInvitation("room1", "user2"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := repo.RemoveInvitation("room1", "user2"); err == nil {
+			t.Error("Expected error for missing invitation, got nil")
+		}
+		if _, err := repo.GetInvitation("room1", "user3"); err != nil {
+			t.Errorf("Expected other invitations to stay, got %v", err)
+		}
+	})
+}
+
+var membershipEpoch = time.Now().Truncate(time.Microsecond)
+
+func newMembership(roomID, userID string, order int) *domain.Membership {
+	return &domain.Membership{
+		RoomID:   roomID,
+		UserID:   userID,
+		Role:     domain.RoleMember,
+		JoinedAt: membershipEpoch.Add(time.Duration(order) * time.Second),
+	}
+}
+
+func newInvitation(roomID, userID string, order int) *domain.Invitation {
+	return &domain.Invitation{
+		RoomID:    roomID,
+		UserID:    userID,
+		InvitedBy: "user1",
+		CreatedAt: membershipEpoch.Add(time.Duration(order) * time.Second),
+	}
+}
@@ -0,0 +1,105 @@
+package repotest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func RunMentionRepositoryTests(t *testing.T, newRepo func(t *testing.T) domain.MentionRepository) {
+	alice := domain.Mention{UserID: "user1", Username: "alice"}
+	bob := domain.Mention{UserID: "user2", Username: "bob"}
+	base := time.Now().Truncate(time.Microsecond)
+
+	t.Run("AddAndGetByMessageIDs", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Add("msg1", base, []domain.Mention{bob, alice}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := repo.Add("msg2", base, []domain.Mention{alice}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := repo.Add("msg3", base, nil); err != nil {
+			t.Fatalf("Expected no error for no mentions, got %v", err)
+		}
+
+		found, err := repo.GetByMessageIDs([]string{"msg1", "msg2", "msg3"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(found) != 2 {
+			t.Fatalf("Expected mentions of 2 messages, got %v", found)
+		}
+		if got := fmt.Sprint(found["msg1"]); got != fmt.Sprint([]domain.Mention{bob, alice}) {
+			t.Errorf("Expected msg1 mentions in the order added, got %s", got)
+		}
+		if got := fmt.Sprint(found["msg2"]); got != fmt.Sprint([]domain.Mention{alice}) {
+			t.Errorf("Expected msg2 mentions [alice], got %s", got)
+		}
+
+		empty, err := repo.GetByMessageIDs(nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if empty == nil || len(empty) != 0 {
+			t.Errorf("Expected empty non-nil map, got %v", empty)
+		}
+	})
+
+	t.Run("AddDuplicate", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Add("msg1", base, []domain.Mention{alice}); err != nil {
+			t.Fatalf("Failed to add mention: %v", err)
+		}
+		if err := repo.Add("msg1", base, []domain.Mention{alice}); err == nil {
+			t.Error("Expected error for duplicate mention, got nil")
+		}
+	})
+
+	t.Run("UnseenAndMarkSeen", func(t *testing.T) {
+		repo := newRepo(t)
+
+		// Added out of order: the feed follows message time.
+		for _, m := range []struct {
+			id string
+			at time.Time
+		}{
+			{"msg2", base.Add(2 * time.Second)},
+			{"msg1", base.Add(time.Second)},
+			{"msg3", base.Add(3 * time.Second)},
+		} {
+			if err := repo.Add(m.id, m.at, []domain.Mention{alice, bob}); err != nil {
+				t.Fatalf("Failed to add mentions: %v", err)
+			}
+		}
+
+		assertUnseen := func(userID string, limit int, want string) {
+			t.Helper()
+			ids, err := repo.GetUnseen(userID, limit)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got := fmt.Sprint(ids); got != want {
+				t.Errorf("Expected unseen %s for %s (limit %d), got %s", want, userID, limit, got)
+			}
+		}
+
+		assertUnseen("user1", 0, "[msg1 msg2 msg3]")
+		assertUnseen("user1", 2, "[msg1 msg2]")
+		assertUnseen("user3", 0, "[]")
+
+		if err := repo.MarkSeen("user1", []string{"msg1", "msg3", "missing"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := repo.MarkSeen("user1", nil); err != nil {
+			t.Fatalf("Expected no error for empty list, got %v", err)
+		}
+
+		assertUnseen("user1", 0, "[msg2]")
+		assertUnseen("user2", 0, "[msg1 msg2 msg3]")
+	})
+}
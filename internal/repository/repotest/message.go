@@ -0,0 +1,550 @@
+package repotest
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func RunMessageRepositoryTests(t *testing.T, newRepo func(t *testing.T) domain.MessageRepository) {
+	t.Run("CreateAndGetByID", func(t *testing.T) {
+		repo := newRepo(t)
+
+		message := newMessage("1", "room1", time.Now())
+		if err := repo.Create(message); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		retrieved, err := repo.GetByID("1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if retrieved.RoomID != message.RoomID {
+			t.Errorf("Expected RoomID %s, got %s", message.RoomID, retrieved.RoomID)
+		}
+		if retrieved.UserID != message.UserID {
+			t.Errorf("Expected UserID %s, got %s", message.UserID, retrieved.UserID)
+		}
+		if retrieved.Username != message.Username {
+			t.Errorf("Expected Username %s, got %s", message.Username, retrieved.Username)
+		}
+		if retrieved.Content != message.Content {
+			t.Errorf("Expected Content %s, got %s", message.Content, retrieved.Content)
+		}
+		if retrieved.Kind != message.Kind {
+			t.Errorf("Expected Kind %s, got %s", message.Kind, retrieved.Kind)
+		}
+		if !retrieved.CreatedAt.Equal(message.CreatedAt) {
+			t.Errorf("Expected CreatedAt %v, got %v", message.CreatedAt, retrieved.CreatedAt)
+		}
+	})
+
+	t.Run("GetByIDNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if _, err := repo.GetByID("missing"); err == nil {
+			t.Fatal("Expected error for non-existent message, got nil")
+		}
+	})
+
+	t.Run("GetByIDs", func(t *testing.T) {
+		repo := newRepo(t)
+
+		now := time.Now()
+		for i, id := range []string{"1", "2", "3"} {
+			if err := repo.Create(newMessage(id, "room1", now.Add(time.Duration(i)*time.Second))); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+
+		messages, err := repo.GetByIDs([]string{"3", "missing", "1"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(messages) != 2 {
+			t.Fatalf("Expected 2 messages, got %d", len(messages))
+		}
+		for _, id := range []string{"1", "3"} {
+			if message, ok := messages[id]; !ok || message.ID != id {
+				t.Errorf("Expected message %s to be returned, got %v", id, message)
+			}
+		}
+
+		empty, err := repo.GetByIDs(nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(empty) != 0 {
+			t.Errorf("Expected no messages, got %d", len(empty))
+		}
+	})
+
+	t.Run("CreateDuplicateID", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Create(newMessage("1", "room1", time.Now())); err != nil {
+			t.Fatalf("Failed to create message: %v", err)
+		}
+
+		if err := repo.Create(newMessage("1", "room1", time.Now())); err == nil {
+			t.Fatal("Expected error for duplicate message ID, got nil")
+		}
+	})
+
+	t.Run("CreateAssignsSeqPerRoom", func(t *testing.T) {
+		repo := newRepo(t)
+
+		tests := []struct {
+			id      string
+			roomID  string
+			wantSeq int64
+		}{
+			{"a1", "room1", 1},
+			{"a2", "room1", 2},
+			{"b1", "room2", 1},
+			{"a3", "room1", 3},
+			{"b2", "room2", 2},
+		}
+
+		for _, tt := range tests {
+			message := newMessage(tt.id, tt.roomID, time.Now())
+			if err := repo.Create(message); err != nil {
+				t.Fatalf("Failed to create message: %v", err)
+			}
+			if message.Seq != tt.wantSeq {
+				t.Errorf("Expected %s to get seq %d, got %d", tt.id, tt.wantSeq, message.Seq)
+			}
+
+			retrieved, err := repo.GetByID(tt.id)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if retrieved.Seq != tt.wantSeq {
+				t.Errorf("Expected stored %s to have seq %d, got %d", tt.id, tt.wantSeq, retrieved.Seq)
+			}
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepo(t)
+		createMessages(t, repo, "room1", 3)
+
+		editedAt := time.Now().Truncate(time.Microsecond)
+		if err := repo.Update(&domain.Message{ID: "room1-1", Content: "edited", EditedAt: &editedAt}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		retrieved, err := repo.GetByID("room1-1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if retrieved.Content != "edited" {
+			t.Errorf("Expected Content edited, got %s", retrieved.Content)
+		}
+		if retrieved.EditedAt == nil || !retrieved.EditedAt.Equal(editedAt) {
+			t.Errorf("Expected EditedAt %v, got %v", editedAt, retrieved.EditedAt)
+		}
+		if retrieved.DeletedAt != nil {
+			t.Errorf("Expected DeletedAt to be unset, got %v", retrieved.DeletedAt)
+		}
+		if retrieved.Seq != 2 || retrieved.RoomID != "room1" || retrieved.UserID != "user1" {
+			t.Errorf("Expected identity fields to be kept, got %+v", retrieved)
+		}
+
+		history, err := repo.GetByRoomIDSince("room1", 0, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertIDs(t, history, "room1-0", "room1-1", "room1-2")
+		if history[1].Content != "edited" {
+			t.Errorf("Expected history to show the edit, got %s", history[1].Content)
+		}
+	})
+
+	t.Run("UpdateSoftDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		createMessages(t, repo, "room1", 2)
+
+		deletedAt := time.Now().Truncate(time.Microsecond)
+		if err := repo.Update(&domain.Message{ID: "room1-0", DeletedAt: &deletedAt}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		history, err := repo.GetByRoomIDSince("room1", 0, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertIDs(t, history, "room1-0", "room1-1")
+		if history[0].DeletedAt == nil || !history[0].DeletedAt.Equal(deletedAt) {
+			t.Errorf("Expected DeletedAt %v, got %v", deletedAt, history[0].DeletedAt)
+		}
+		if history[0].Content != "" {
+			t.Errorf("Expected empty content, got %q", history[0].Content)
+		}
+	})
+
+	t.Run("UpdateNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Update(&domain.Message{ID: "missing", Content: "x"}); err == nil {
+			t.Fatal("Expected error for non-existent message, got nil")
+		}
+	})
+
+	t.Run("GetReplies", func(t *testing.T) {
+		repo := newRepo(t)
+		createMessages(t, repo, "room1", 2)
+		createReplies(t, repo, "room1", "room1-0", 5)
+		createReplies(t, repo, "room1", "room1-1", 1)
+
+		stored, err := repo.GetByID("room1-0-reply-0")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if stored.ParentID != "room1-0" {
+			t.Errorf("Expected ParentID room1-0, got %q", stored.ParentID)
+		}
+
+		tests := []struct {
+			name     string
+			parentID string
+			limit    int
+			offset   int
+			want     []string
+		}{
+			{"first page", "room1-0", 2, 0, []string{"room1-0-reply-0", "room1-0-reply-1"}},
+			{"last page", "room1-0", 2, 4, []string{"room1-0-reply-4"}},
+			{"offset past end", "room1-0", 2, 10, []string{}},
+			{"other thread", "room1-1", 10, 0, []string{"room1-1-reply-0"}},
+			{"no replies", "room1-0-reply-0", 10, 0, []string{}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				retrieved, err := repo.GetReplies(tt.parentID, tt.limit, tt.offset)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if retrieved == nil {
+					t.Fatal("Expected non-nil slice")
+				}
+				assertIDs(t, retrieved, tt.want...)
+			})
+		}
+	})
+
+	t.Run("GetRepliesSeesUpdates", func(t *testing.T) {
+		repo := newRepo(t)
+		createMessages(t, repo, "room1", 1)
+		createReplies(t, repo, "room1", "room1-0", 1)
+
+		editedAt := time.Now()
+		if err := repo.Update(&domain.Message{ID: "room1-0-reply-0", Content: "edited", EditedAt: &editedAt}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		retrieved, err := repo.GetReplies("room1-0", 10, 0)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertIDs(t, retrieved, "room1-0-reply-0")
+		if retrieved[0].Content != "edited" {
+			t.Errorf("Expected edited reply, got %q", retrieved[0].Content)
+		}
+	})
+
+	t.Run("CountReplies", func(t *testing.T) {
+		repo := newRepo(t)
+		createMessages(t, repo, "room1", 3)
+		createReplies(t, repo, "room1", "room1-0", 3)
+		createReplies(t, repo, "room1", "room1-2", 1)
+
+		counts, err := repo.CountReplies([]string{"room1-0", "room1-1", "room1-2", "missing"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		want := map[string]int{"room1-0": 3, "room1-2": 1}
+		if len(counts) != len(want) {
+			t.Errorf("Expected counts %v, got %v", want, counts)
+		}
+		for id, n := range want {
+			if counts[id] != n {
+				t.Errorf("Expected %d replies to %s, got %d", n, id, counts[id])
+			}
+		}
+
+		empty, err := repo.CountReplies(nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(empty) != 0 {
+			t.Errorf("Expected no counts, got %v", empty)
+		}
+	})
+
+	t.Run("GetByRoomIDOrdersBySeq", func(t *testing.T) {
+		repo := newRepo(t)
+
+		base := time.Now()
+		for _, message := range []*domain.Message{
+			newMessage("1", "room1", base),
+			newMessage("2", "room1", base.Add(-1*time.Hour)),
+			newMessage("3", "room1", base.Add(-2*time.Hour)),
+		} {
+			if err := repo.Create(message); err != nil {
+				t.Fatalf("Failed to create message: %v", err)
+			}
+		}
+
+		retrieved, err := repo.GetByRoomIDBefore("room1", math.MaxInt64, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		assertIDs(t, retrieved, "1", "2", "3")
+	})
+
+	t.Run("GetByRoomIDSince", func(t *testing.T) {
+		repo := newRepo(t)
+		createMessages(t, repo, "room1", 5)
+		createMessages(t, repo, "room2", 2)
+
+		tests := []struct {
+			name     string
+			roomID   string
+			sinceSeq int64
+			limit    int
+			want     []string
+		}{
+			{"from start", "room1", 0, 10, []string{"room1-0", "room1-1", "room1-2", "room1-3", "room1-4"}},
+			{"after seq", "room1", 2, 10, []string{"room1-2", "room1-3", "room1-4"}},
+			{"limited", "room1", 1, 2, []string{"room1-1", "room1-2"}},
+			{"caught up", "room1", 5, 10, []string{}},
+			{"ahead of room", "room1", 50, 10, []string{}},
+			{"other room", "room2", 1, 10, []string{"room2-1"}},
+			{"unknown room", "unknown", 0, 10, []string{}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				retrieved, err := repo.GetByRoomIDSince(tt.roomID, tt.sinceSeq, tt.limit)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if retrieved == nil {
+					t.Fatal("Expected non-nil slice")
+				}
+				assertIDs(t, retrieved, tt.want...)
+			})
+		}
+	})
+
+	t.Run("GetByRoomIDBefore", func(t *testing.T) {
+		repo := newRepo(t)
+		createMessages(t, repo, "room1", 5)
+		createMessages(t, repo, "room2", 2)
+
+		tests := []struct {
+			name      string
+			roomID    string
+			beforeSeq int64
+			limit     int
+			want      []string
+		}{
+			{"newest page", "room1", math.MaxInt64, 2, []string{"room1-3", "room1-4"}},
+			{"before seq", "room1", 4, 2, []string{"room1-1", "room1-2"}},
+			{"partial first page", "room1", 2, 2, []string{"room1-0"}},
+			{"at start", "room1", 1, 2, []string{}},
+			{"limit larger than room", "room1", math.MaxInt64, 100, []string{"room1-0", "room1-1", "room1-2", "room1-3", "room1-4"}},
+			{"other room", "room2", 50, 10, []string{"room2-0", "room2-1"}},
+			{"unknown room", "unknown", math.MaxInt64, 10, []string{}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				retrieved, err := repo.GetByRoomIDBefore(tt.roomID, tt.beforeSeq, tt.limit)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if retrieved == nil {
+					t.Fatal("Expected non-nil slice")
+				}
+				assertIDs(t, retrieved, tt.want...)
+			})
+		}
+	})
+
+	t.Run("GetByRoomIDIsolatesRooms", func(t *testing.T) {
+		repo := newRepo(t)
+		createMessages(t, repo, "room1", 3)
+		createMessages(t, repo, "room2", 2)
+
+		retrieved, err := repo.GetByRoomIDBefore("room2", math.MaxInt64, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		assertIDs(t, retrieved, "room2-0", "room2-1")
+
+		empty, err := repo.GetByRoomIDBefore("unknown", math.MaxInt64, 10)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if empty == nil || len(empty) != 0 {
+			t.Errorf("Expected empty non-nil slice for unknown room, got %v", empty)
+		}
+	})
+
+	t.Run("CountSinceManyAndLastSeq", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if seq, err := repo.LastSeq("room1"); err != nil || seq != 0 {
+			t.Errorf("Expected LastSeq 0 for an empty room, got %d (%v)", seq, err)
+		}
+
+		createMessages(t, repo, "room1", 4)
+		createMessages(t, repo, "room2", 2)
+		own := newMessage("room1-own", "room1", time.Now())
+		own.UserID = "user2"
+		if err := repo.Create(own); err != nil {
+			t.Fatalf("Failed to create message: %v", err)
+		}
+		system := newMessage("room1-system", "room1", time.Now())
+		system.Kind = domain.MessageKindSystem
+		system.UserID = ""
+		if err := repo.Create(system); err != nil {
+			t.Fatalf("Failed to create message: %v", err)
+		}
+		deletedAt := time.Now().Truncate(time.Microsecond)
+		if err := repo.Update(&domain.Message{ID: "room1-2", DeletedAt: &deletedAt}); err != nil {
+			t.Fatalf("Failed to delete message: %v", err)
+		}
+
+		if seq, err := repo.LastSeq("room1"); err != nil || seq != 6 {
+			t.Errorf("Expected LastSeq 6, got %d (%v)", seq, err)
+		}
+
+		tests := []struct {
+			name      string
+			sinceSeqs map[string]int64
+			exclude   string
+			want      map[string]int
+		}{
+			{"All", map[string]int64{"room1": 0, "room2": 0}, "", map[string]int{"room1": 4, "room2": 2}},
+			{"SkipsOwnMessages", map[string]int64{"room1": 0}, "user2", map[string]int{"room1": 3}},
+			{"AfterSeq", map[string]int64{"room1": 1, "room2": 1}, "user2", map[string]int{"room1": 2, "room2": 1}},
+			{"UpToDate", map[string]int64{"room1": 5, "room2": 2}, "user2", map[string]int{}},
+			{"UnknownRoom", map[string]int64{"missing": 0}, "", map[string]int{}},
+			{"NoRooms", map[string]int64{}, "", map[string]int{}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				counts, err := repo.CountSinceMany(tt.sinceSeqs, tt.exclude)
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if len(counts) != len(tt.want) {
+					t.Fatalf("Expected counts %v, got %v", tt.want, counts)
+				}
+				for roomID, want := range tt.want {
+					if counts[roomID] != want {
+						t.Errorf("Expected %d messages in %s, got %d", want, roomID, counts[roomID])
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("ConcurrentCreate", func(t *testing.T) {
+		repo := newRepo(t)
+
+		const workers = 50
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := repo.Create(newMessage(fmt.Sprintf("msg%d", i), "room1", time.Now())); err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		retrieved, err := repo.GetByRoomIDSince("room1", 0, workers*2)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(retrieved) != workers {
+			t.Errorf("Expected %d messages, got %d", workers, len(retrieved))
+		}
+
+		for i, message := range retrieved {
+			if message.Seq != int64(i+1) {
+				t.Errorf("Expected gapless seq %d at position %d, got %d", i+1, i, message.Seq)
+			}
+		}
+
+		for i := 0; i < workers; i++ {
+			if _, err := repo.GetByID(fmt.Sprintf("msg%d", i)); err != nil {
+				t.Errorf("Expected msg%d to be retrievable, got %v", i, err)
+			}
+		}
+	})
+}
+
+func newMessage(id, roomID string, createdAt time.Time) *domain.Message {
+	return &domain.Message{
+		ID:        id,
+		RoomID:    roomID,
+		UserID:    "user1",
+		Username:  "testuser",
+		Kind:      domain.MessageKindUser,
+		Content:   "Message " + id,
+		CreatedAt: createdAt.Truncate(time.Microsecond),
+	}
+}
+
+func createMessages(t *testing.T, repo domain.MessageRepository, roomID string, n int) {
+	t.Helper()
+
+	base := time.Now().Add(-time.Duration(n) * time.Minute)
+	for i := 0; i < n; i++ {
+		message := newMessage(fmt.Sprintf("%s-%d", roomID, i), roomID, base.Add(time.Duration(i)*time.Minute))
+		if err := repo.Create(message); err != nil {
+			t.Fatalf("Failed to create message: %v", err)
+		}
+	}
+}
+
+func createReplies(t *testing.T, repo domain.MessageRepository, roomID, parentID string, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		message := newMessage(fmt.Sprintf("%s-reply-%d", parentID, i), roomID, time.Now())
+		message.ParentID = parentID
+		if err := repo.Create(message); err != nil {
+			t.Fatalf("Failed to create reply: %v", err)
+		}
+	}
+}
+
+func assertIDs(t *testing.T, messages []*domain.Message, want ...string) {
+	t.Helper()
+
+	if len(messages) != len(want) {
+		t.Fatalf("Expected %d messages, got %d", len(want), len(messages))
+	}
+
+	for i, message := range messages {
+		if message.ID != want[i] {
+			t.Errorf("Expected message %d to have ID %s, got %s", i, want[i], message.ID)
+		}
+	}
+}
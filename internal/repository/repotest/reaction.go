@@ -0,0 +1,152 @@
+package repotest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func RunReactionRepositoryTests(t *testing.T, newRepo func(t *testing.T) domain.ReactionRepository) {
+	t.Run("AddAndCount", func(t *testing.T) {
+		repo := newRepo(t)
+
+		addReactions(t, repo,
+			newReaction("msg1", "user1", "👍"),
+			newReaction("msg1", "user2", "🎉"),
+			newReaction("msg1", "user2", "👍"),
+			newReaction("msg1", "user3", "👍"),
+			newReaction("msg2", "user1", "🎉"),
+		)
+
+		counts, err := repo.CountByMessageIDs([]string{"msg1", "msg2", "msg3"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		want := map[string][]domain.ReactionCount{
+			"msg1": {{Emoji: "👍", Count: 3}, {Emoji: "🎉", Count: 1}},
+			"msg2": {{Emoji: "🎉", Count: 1}},
+		}
+		if !reflect.DeepEqual(counts, want) {
+			t.Errorf("Expected counts %v, got %v", want, counts)
+		}
+	})
+
+	t.Run("AddDuplicate", func(t *testing.T) {
+		repo := newRepo(t)
+		addReactions(t, repo, newReaction("msg1", "user1", "👍"))
+
+		if err := repo.Add(newReaction("msg1", "user1", "👍")); err == nil {
+			t.Fatal("Expected error for duplicate reaction, got nil")
+		}
+
+		counts, err := repo.CountByMessageIDs([]string{"msg1"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if counts["msg1"][0].Count != 1 {
+			t.Errorf("Expected duplicate not to be counted, got %v", counts["msg1"])
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		repo := newRepo(t)
+		addReactions(t, repo,
+			newReaction("msg1", "user1", "👍"),
+			newReaction("msg1", "user2", "👍"),
+			newReaction("msg1", "user1", "🎉"),
+		)
+
+		if err := repo.Remove("msg1", "user1", "👍"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := repo.Remove("msg1", "user1", "🎉"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		counts, err := repo.CountByMessageIDs([]string{"msg1"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		want := []domain.ReactionCount{{Emoji: "👍", Count: 1}}
+		if !reflect.DeepEqual(counts["msg1"], want) {
+			t.Errorf("Expected %v, got %v", want, counts["msg1"])
+		}
+
+		if err := repo.Remove("msg1", "user1", "👍"); err == nil {
+			t.Error("Expected error when removing a missing reaction, got nil")
+		}
+
+		if err := repo.Remove("msg1", "user2", "👍"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		counts, err = repo.CountByMessageIDs([]string{"msg1"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, ok := counts["msg1"]; ok {
+			t.Errorf("Expected message without reactions to be left out, got %v", counts)
+		}
+	})
+
+	t.Run("CountEmpty", func(t *testing.T) {
+		repo := newRepo(t)
+
+		counts, err := repo.CountByMessageIDs(nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if counts == nil || len(counts) != 0 {
+			t.Errorf("Expected empty non-nil map, got %v", counts)
+		}
+	})
+
+	t.Run("ConcurrentAdd", func(t *testing.T) {
+		repo := newRepo(t)
+
+		const workers = 20
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := repo.Add(newReaction("msg1", fmt.Sprintf("user%d", i), "👍")); err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		counts, err := repo.CountByMessageIDs([]string{"msg1"})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(counts["msg1"]) != 1 || counts["msg1"][0].Count != workers {
+			t.Errorf("Expected %d reactions, got %v", workers, counts["msg1"])
+		}
+	})
+}
+
+func newReaction(messageID, userID, emoji string) *domain.Reaction {
+	return &domain.Reaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     emoji,
+		CreatedAt: time.Now(),
+	}
+}
+
+func addReactions(t *testing.T, repo domain.ReactionRepository, reactions ...*domain.Reaction) {
+	t.Helper()
+
+	for _, reaction := range reactions {
+		if err := repo.Add(reaction); err != nil {
+			t.Fatalf("Failed to add reaction: %v", err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func RunReadMarkerRepositoryTests(t *testing.T, newRepo func(t *testing.T) domain.ReadMarkerRepository) {
+	t.Run("PutAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if _, err := repo.Get("user1", "room1"); err == nil {
+			t.Fatal("Expected error for missing marker, got nil")
+		}
+
+		if err := repo.Put(newReadMarker("user1", "room1", 3)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		found, err := repo.Get("user1", "room1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if found.LastReadSeq != 3 || !found.UpdatedAt.Equal(readMarkerEpoch) {
+			t.Errorf("Expected marker at seq 3 updated at %v, got %+v", readMarkerEpoch, found)
+		}
+
+		if _, err := repo.Get("user2", "room1"); err == nil {
+			t.Error("Expected marker to be limited to its user")
+		}
+	})
+
+	t.Run("PutReplaces", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Put(newReadMarker("user1", "room1", 3)); err != nil {
+			t.Fatalf("Failed to put marker: %v", err)
+		}
+		if err := repo.Put(newReadMarker("user1", "room1", 7)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		found, err := repo.Get("user1", "room1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if found.LastReadSeq != 7 {
+			t.Errorf("Expected marker at seq 7, got %d", found.LastReadSeq)
+		}
+	})
+
+	t.Run("GetByUserID", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, marker := range []*domain.ReadMarker{
+			newReadMarker("user1", "room1", 1),
+			newReadMarker("user1", "room2", 2),
+			newReadMarker("user2", "room1", 5),
+		} {
+			if err := repo.Put(marker); err != nil {
+				t.Fatalf("Failed to put marker: %v", err)
+			}
+		}
+
+		markers, err := repo.GetByUserID("user1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		seqs := make(map[string]int64, len(markers))
+		for _, marker := range markers {
+			seqs[marker.RoomID] = marker.LastReadSeq
+		}
+		if len(seqs) != 2 || seqs["room1"] != 1 || seqs["room2"] != 2 {
+			t.Errorf("Expected user1's markers in room1 and room2, got %v", seqs)
+		}
+
+		none, err := repo.GetByUserID("user3")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if none == nil || len(none) != 0 {
+			t.Errorf("Expected empty non-nil slice for user without markers, got %v", none)
+		}
+	})
+}
+
+var readMarkerEpoch = time.Now().Truncate(time.Microsecond)
+
+func newReadMarker(userID, roomID string, seq int64) *domain.ReadMarker {
+	return &domain.ReadMarker{
+		UserID:      userID,
+		RoomID:      roomID,
+		LastReadSeq: seq,
+		UpdatedAt:   readMarkerEpoch,
+	}
+}
@@ -0,0 +1,60 @@
+// Package repotest holds the behavioural contract every storage backend must
+// satisfy. A backend proves itself by calling Run from its own tests with
+// factories that return fresh, empty repositories.
+package repotest
+
+import (
+	"testing"
+
+	"gochat/internal/domain"
+)
+
+type Factory struct {
+	NewUserRepository       func(t *testing.T) domain.UserRepository
+	NewRoomRepository       func(t *testing.T) domain.RoomRepository
+	NewMessageRepository    func(t *testing.T) domain.MessageRepository
+	NewReactionRepository   func(t *testing.T) domain.ReactionRepository
+	NewMembershipRepository func(t *testing.T) domain.MembershipRepository
+	NewSanctionRepository   func(t *testing.T) domain.SanctionRepository
+	NewReadMarkerRepository func(t *testing.T) domain.ReadMarkerRepository
+	NewSearchIndex          func(t *testing.T) domain.SearchIndex
+	NewAttachmentRepository func(t *testing.T) domain.AttachmentRepository
+	NewBlobStorage          func(t *testing.T) domain.BlobStorage
+	NewMentionRepository    func(t *testing.T) domain.MentionRepository
+}
+
+func Run(t *testing.T, f Factory) {
+	t.Run("UserRepository", func(t *testing.T) {
+		RunUserRepositoryTests(t, f.NewUserRepository)
+	})
+	t.Run("RoomRepository", func(t *testing.T) {
+		RunRoomRepositoryTests(t, f.NewRoomRepository)
+	})
+	t.Run("MessageRepository", func(t *testing.T) {
+		RunMessageRepositoryTests(t, f.NewMessageRepository)
+	})
+	t.Run("ReactionRepository", func(t *testing.T) {
+		RunReactionRepositoryTests(t, f.NewReactionRepository)
+	})
+	t.Run("MembershipRepository", func(t *testing.T) {
+		RunMembershipRepositoryTests(t, f.NewMembershipRepository)
+	})
+	t.Run("SanctionRepository", func(t *testing.T) {
+		RunSanctionRepositoryTests(t, f.NewSanctionRepository)
+	})
+	t.Run("ReadMarkerRepository", func(t *testing.T) {
+		RunReadMarkerRepositoryTests(t, f.NewReadMarkerRepository)
+	})
+	t.Run("SearchIndex", func(t *testing.T) {
+		RunSearchIndexTests(t, f.NewSearchIndex)
+	})
+	t.Run("AttachmentRepository", func(t *testing.T) {
+		RunAttachmentRepositoryTests(t, f.NewAttachmentRepository)
+	})
+	t.Run("BlobStorage", func(t *testing.T) {
+		RunBlobStorageTests(t, f.NewBlobStorage)
+	})
+	t.Run("MentionRepository", func(t *testing.T) {
+		RunMentionRepositoryTests(t, f.NewMentionRepository)
+	})
+}
@@ -0,0 +1,250 @@
+package repotest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func RunRoomRepositoryTests(t *testing.T, newRepo func(t *testing.T) domain.RoomRepository) {
+	t.Run("CreateAndGetByID", func(t *testing.T) {
+		repo := newRepo(t)
+
+		room := newRoom("room1", "General")
+		if err := repo.Create(room); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		retrieved, err := repo.GetByID("room1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if retrieved.Name != room.Name {
+			t.Errorf("Expected Name %s, got %s", room.Name, retrieved.Name)
+		}
+		if retrieved.Type != domain.RoomTypePublic {
+			t.Errorf("Expected Type %s, got %s", domain.RoomTypePublic, retrieved.Type)
+		}
+		if !retrieved.CreatedAt.Equal(room.CreatedAt) {
+			t.Errorf("Expected CreatedAt %v, got %v", room.CreatedAt, retrieved.CreatedAt)
+		}
+	})
+
+	t.Run("GetByIDNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if _, err := repo.GetByID("missing"); err == nil {
+			t.Fatal("Expected error for non-existent room, got nil")
+		}
+	})
+
+	t.Run("GetByDirectKey", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Create(newRoom("room1", "General")); err != nil {
+			t.Fatalf("Failed to create room: %v", err)
+		}
+
+		key := domain.DirectRoomKey("alice", "bob")
+		if _, err := repo.GetByDirectKey(key); err == nil {
+			t.Fatal("Expected error for non-existent direct room, got nil")
+		}
+
+		direct := newDirectRoom("dm1", "alice", "bob")
+		if err := repo.Create(direct); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		retrieved, err := repo.GetByDirectKey(domain.DirectRoomKey("bob", "alice"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if retrieved.ID != "dm1" || retrieved.Type != domain.RoomTypeDirect || retrieved.DirectKey != key {
+			t.Errorf("Expected direct room dm1 with key %s, got %+v", key, retrieved)
+		}
+
+		if !retrieved.HasParticipant("alice") || !retrieved.HasParticipant("bob") || retrieved.HasParticipant("carol") {
+			t.Errorf("Unexpected participants %v", retrieved.Participants())
+		}
+
+		if err := repo.Create(newDirectRoom("dm2", "bob", "alice")); err == nil {
+			t.Error("Expected error for a second direct room between the same users, got nil")
+		}
+		if err := repo.Create(newDirectRoom("dm3", "alice", "carol")); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("GetAll", func(t *testing.T) {
+		repo := newRepo(t)
+
+		rooms, err := repo.GetAll()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if rooms == nil || len(rooms) != 0 {
+			t.Errorf("Expected empty non-nil slice, got %v", rooms)
+		}
+
+		for i := 0; i < 3; i++ {
+			if err := repo.Create(newRoom(fmt.Sprintf("room%d", i), fmt.Sprintf("Room %d", i))); err != nil {
+				t.Fatalf("Failed to create room: %v", err)
+			}
+		}
+
+		rooms, err = repo.GetAll()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(rooms) != 3 {
+			t.Errorf("Expected 3 rooms, got %d", len(rooms))
+		}
+	})
+
+	t.Run("Exists", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if repo.Exists("room1") {
+			t.Error("Expected room to not exist")
+		}
+
+		if err := repo.Create(newRoom("room1", "General")); err != nil {
+			t.Fatalf("Failed to create room: %v", err)
+		}
+
+		if !repo.Exists("room1") {
+			t.Error("Expected room to exist")
+		}
+	})
+
+	t.Run("SetTopic", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Create(newRoom("room1", "General")); err != nil {
+			t.Fatalf("Failed to create room: %v", err)
+		}
+		before, _ := repo.GetByID("room1")
+
+		if err := repo.SetTopic("room1", "Release planning"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		retrieved, err := repo.GetByID("room1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if retrieved.Topic != "Release planning" {
+			t.Errorf("Expected topic to be stored, got %q", retrieved.Topic)
+		}
+		if before.Topic != "" {
+			t.Errorf("Expected rooms read earlier to be unchanged, got %q", before.Topic)
+		}
+
+		if err := repo.SetTopic("room1", ""); err != nil {
+			t.Fatalf("Expected no error clearing the topic, got %v", err)
+		}
+		if retrieved, _ := repo.GetByID("room1"); retrieved.Topic != "" {
+			t.Errorf("Expected topic to be cleared, got %q", retrieved.Topic)
+		}
+
+		if err := repo.SetTopic("missing", "x"); err == nil {
+			t.Error("Expected error for missing room, got nil")
+		}
+	})
+
+	t.Run("Pins", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, id := range []string{"room1", "room2"} {
+			if err := repo.Create(newRoom(id, "Room")); err != nil {
+				t.Fatalf("Failed to create room: %v", err)
+			}
+		}
+
+		for _, id := range []string{"msg2", "msg1", "msg3"} {
+			if err := repo.Pin("room1", id); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		if err := repo.Pin("room1", "msg1"); err == nil {
+			t.Error("Expected error pinning a message twice, got nil")
+		}
+		if err := repo.Pin("missing", "msg1"); err == nil {
+			t.Error("Expected error for missing room, got nil")
+		}
+
+		if err := repo.Unpin("room1", "msg1"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := repo.Unpin("room1", "msg1"); err == nil {
+			t.Error("Expected error unpinning a message that is not pinned, got nil")
+		}
+
+		retrieved, err := repo.GetByID("room1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got := fmt.Sprint(retrieved.PinnedMessageIDs); got != "[msg2 msg3]" {
+			t.Errorf("Expected pins in the order pinned, got %s", got)
+		}
+
+		rooms, err := repo.GetAll()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, room := range rooms {
+			want := "[]"
+			if room.ID == "room1" {
+				want = "[msg2 msg3]"
+			}
+			if got := fmt.Sprint(room.PinnedMessageIDs); got != want {
+				t.Errorf("Expected pins %s for %s, got %s", want, room.ID, got)
+			}
+		}
+	})
+
+	t.Run("ConcurrentCreate", func(t *testing.T) {
+		repo := newRepo(t)
+
+		const workers = 20
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := repo.Create(newRoom(fmt.Sprintf("room%d", i), "Room")); err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		rooms, err := repo.GetAll()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(rooms) != workers {
+			t.Errorf("Expected %d rooms, got %d", workers, len(rooms))
+		}
+	})
+}
+
+func newRoom(id, name string) *domain.Room {
+	return &domain.Room{
+		ID:        id,
+		Name:      name,
+		Type:      domain.RoomTypePublic,
+		CreatedAt: time.Now().Truncate(time.Microsecond),
+	}
+}
+
+func newDirectRoom(id, userA, userB string) *domain.Room {
+	room := newRoom(id, userA+" & "+userB)
+	room.Type = domain.RoomTypeDirect
+	room.DirectKey = domain.DirectRoomKey(userA, userB)
+	return room
+}
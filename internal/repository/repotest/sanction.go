@@ -0,0 +1,105 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func RunSanctionRepositoryTests(t *testing.T, newRepo func(t *testing.T) domain.SanctionRepository) {
+	t.Run("PutAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if _, err := repo.Get("room1", "user2", domain.SanctionBan); err == nil {
+			t.Fatal("Expected error for missing sanction, got nil")
+		}
+
+		expires := sanctionEpoch.Add(time.Hour)
+		ban := newSanction("room1", "user2", domain.SanctionBan, &expires)
+		if err := repo.Put(ban); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := repo.Put(newSanction("room1", "user2", domain.SanctionMute, nil)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		found, err := repo.Get("room1", "user2", domain.SanctionBan)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if found.IssuedBy != "user1" || found.ExpiresAt == nil || !found.ExpiresAt.Equal(expires) {
+			t.Errorf("Expected ban by user1 until %v, got %+v", expires, found)
+		}
+
+		mute, err := repo.Get("room1", "user2", domain.SanctionMute)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if mute.ExpiresAt != nil {
+			t.Errorf("Expected a permanent mute, got one expiring at %v", mute.ExpiresAt)
+		}
+
+		if _, err := repo.Get("room2", "user2", domain.SanctionBan); err == nil {
+			t.Error("Expected sanction to be limited to its room")
+		}
+	})
+
+	t.Run("PutReplaces", func(t *testing.T) {
+		repo := newRepo(t)
+
+		expires := sanctionEpoch.Add(time.Hour)
+		if err := repo.Put(newSanction("room1", "user2", domain.SanctionBan, &expires)); err != nil {
+			t.Fatalf("Failed to put sanction: %v", err)
+		}
+		if err := repo.Put(newSanction("room1", "user2", domain.SanctionBan, nil)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		found, err := repo.Get("room1", "user2", domain.SanctionBan)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if found.ExpiresAt != nil {
+			t.Errorf("Expected the ban to become permanent, got one expiring at %v", found.ExpiresAt)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Put(newSanction("room1", "user2", domain.SanctionBan, nil)); err != nil {
+			t.Fatalf("Failed to put sanction: %v", err)
+		}
+		if err := repo.Put(newSanction("room1", "user2", domain.SanctionMute, nil)); err != nil {
+			t.Fatalf("Failed to put sanction: %v", err)
+		}
+
+		if err := repo.Remove("room1", "user2", domain.SanctionBan); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := repo.Get("room1", "user2", domain.SanctionBan); err == nil {
+			t.Error("Expected ban to be removed")
+		}
+		if _, err := repo.Get("room1", "user2", domain.SanctionMute); err != nil {
+			t.Errorf("Expected mute to stay, got %v", err)
+		}
+
+		if err := repo.Remove("room1", "user2", domain.SanctionBan); err == nil {
+			t.Error("Expected error for missing sanction, got nil")
+		}
+	})
+}
+
+var sanctionEpoch = time.Now().Truncate(time.Microsecond)
+
+func newSanction(roomID, userID, kind string, expiresAt *time.Time) *domain.Sanction {
+	return &domain.Sanction{
+		RoomID:    roomID,
+		UserID:    userID,
+		Kind:      kind,
+		IssuedBy:  "user1",
+		CreatedAt: sanctionEpoch,
+		ExpiresAt: expiresAt,
+	}
+}
@@ -0,0 +1,158 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func RunSearchIndexTests(t *testing.T, newIndex func(t *testing.T) domain.SearchIndex) {
+	t.Run("MatchesAllTerms", func(t *testing.T) {
+		index := newSearchIndex(t, newIndex)
+
+		results := search(t, index, domain.SearchQuery{Terms: []string{"gopher"}})
+		assertResultIDs(t, results, "m1", "m2", "m3", "m4")
+
+		results = search(t, index, domain.SearchQuery{Terms: []string{"gopher", "lunch"}})
+		assertResultIDs(t, results, "m2")
+
+		results = search(t, index, domain.SearchQuery{Terms: []string{"привет"}})
+		assertResultIDs(t, results, "m5")
+
+		results = search(t, index, domain.SearchQuery{Terms: []string{"nothing"}})
+		assertResultIDs(t, results)
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		index := newSearchIndex(t, newIndex)
+
+		tests := []struct {
+			name  string
+			query domain.SearchQuery
+			want  []string
+		}{
+			{"Room", domain.SearchQuery{RoomIDs: []string{"room2"}}, []string{"m4"}},
+			{"Author", domain.SearchQuery{UserID: "user2"}, []string{"m3"}},
+			{"Since", domain.SearchQuery{Since: searchEpoch.Add(2 * time.Minute)}, []string{"m3", "m4"}},
+			{"Until", domain.SearchQuery{Until: searchEpoch.Add(2 * time.Minute)}, []string{"m1", "m2"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				tt.query.Terms = []string{"gopher"}
+				assertResultIDs(t, search(t, index, tt.query), tt.want...)
+			})
+		}
+	})
+
+	t.Run("Ranking", func(t *testing.T) {
+		index := newSearchIndex(t, newIndex)
+
+		results := search(t, index, domain.SearchQuery{Terms: []string{"gopher"}})
+		if len(results) == 0 || results[0].MessageID != "m1" {
+			t.Fatalf("Expected the short message repeating the term first, got %+v", results)
+		}
+		for i := 1; i < len(results); i++ {
+			if results[i].Score > results[i-1].Score {
+				t.Errorf("Expected results best first, got %+v", results)
+			}
+		}
+	})
+
+	t.Run("LimitOffset", func(t *testing.T) {
+		index := newSearchIndex(t, newIndex)
+
+		all := search(t, index, domain.SearchQuery{Terms: []string{"gopher"}})
+		page := search(t, index, domain.SearchQuery{Terms: []string{"gopher"}, Limit: 2, Offset: 1})
+		if len(all) != 4 || len(page) != 2 || page[0].MessageID != all[1].MessageID || page[1].MessageID != all[2].MessageID {
+			t.Errorf("Expected the second and third of %+v, got %+v", all, page)
+		}
+	})
+
+	t.Run("ReindexAndRemove", func(t *testing.T) {
+		index := newSearchIndex(t, newIndex)
+
+		edited := newSearchMessage("m2", "room1", "user1", "now about rust", 1)
+		if err := index.Index(edited); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := index.Remove("m3"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := index.Remove("missing"); err != nil {
+			t.Errorf("Expected removing an unknown message to be a no-op, got %v", err)
+		}
+
+		assertResultIDs(t, search(t, index, domain.SearchQuery{Terms: []string{"gopher"}}), "m1", "m4")
+		assertResultIDs(t, search(t, index, domain.SearchQuery{Terms: []string{"rust"}}), "m2")
+	})
+}
+
+var searchEpoch = time.Now().Truncate(time.Microsecond)
+
+// newSearchIndex returns an index of five messages, m1 to m5, written a
+// minute apart; all but m5 mention "gopher".
+func newSearchIndex(t *testing.T, newIndex func(t *testing.T) domain.SearchIndex) domain.SearchIndex {
+	t.Helper()
+
+	index := newIndex(t)
+	for _, message := range []*domain.Message{
+		newSearchMessage("m1", "room1", "user1", "Gopher, gopher!", 0),
+		newSearchMessage("m2", "room1", "user1", "the gopher went out for lunch with some friends", 1),
+		newSearchMessage("m3", "room1", "user2", "is there a gopher in this long sentence about many other things", 2),
+		newSearchMessage("m4", "room2", "user1", "another gopher somewhere else entirely", 3),
+		newSearchMessage("m5", "room1", "user1", "Привет всем", 4),
+	} {
+		if err := index.Index(message); err != nil {
+			t.Fatalf("Failed to index message: %v", err)
+		}
+	}
+	return index
+}
+
+func newSearchMessage(id, roomID, userID, content string, minute int) *domain.Message {
+	return &domain.Message{
+		ID:        id,
+		RoomID:    roomID,
+		UserID:    userID,
+		Content:   content,
+		CreatedAt: searchEpoch.Add(time.Duration(minute) * time.Minute),
+	}
+}
+
+// search runs the query in both rooms unless it names its own, with room
+// for every result unless it sets a limit.
+func search(t *testing.T, index domain.SearchIndex, query domain.SearchQuery) []domain.SearchResult {
+	t.Helper()
+
+	if query.RoomIDs == nil {
+		query.RoomIDs = []string{"room1", "room2"}
+	}
+	if query.Limit == 0 {
+		query.Limit = 10
+	}
+
+	results, err := index.Search(query)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return results
+}
+
+// assertResultIDs checks the set of results, ignoring their order.
+func assertResultIDs(t *testing.T, results []domain.SearchResult, want ...string) {
+	t.Helper()
+
+	got := make(map[string]bool, len(results))
+	for _, result := range results {
+		got[result.MessageID] = true
+	}
+	if len(results) != len(want) || len(got) != len(want) {
+		t.Fatalf("Expected %v, got %+v", want, results)
+	}
+	for _, id := range want {
+		if !got[id] {
+			t.Errorf("Expected %s among %+v", id, results)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package repotest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func RunUserRepositoryTests(t *testing.T, newRepo func(t *testing.T) domain.UserRepository) {
+	t.Run("Create", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Create(newUser("1", "testuser")); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("CreateDuplicateUsername", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Create(newUser("1", "testuser")); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		if err := repo.Create(newUser("2", "testuser")); err == nil {
+			t.Fatal("Expected error for duplicate username, got nil")
+		}
+
+		retrieved, err := repo.GetByUsername("testuser")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if retrieved.ID != "1" {
+			t.Errorf("Expected original user to be kept, got ID %s", retrieved.ID)
+		}
+	})
+
+	t.Run("GetByID", func(t *testing.T) {
+		repo := newRepo(t)
+
+		user := newUser("1", "testuser")
+		if err := repo.Create(user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		retrieved, err := repo.GetByID("1")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if retrieved.ID != user.ID {
+			t.Errorf("Expected ID %s, got %s", user.ID, retrieved.ID)
+		}
+		if retrieved.Username != user.Username {
+			t.Errorf("Expected Username %s, got %s", user.Username, retrieved.Username)
+		}
+		if retrieved.PasswordHash != user.PasswordHash {
+			t.Errorf("Expected PasswordHash %s, got %s", user.PasswordHash, retrieved.PasswordHash)
+		}
+		if !retrieved.CreatedAt.Equal(user.CreatedAt) {
+			t.Errorf("Expected CreatedAt %v, got %v", user.CreatedAt, retrieved.CreatedAt)
+		}
+	})
+
+	t.Run("GetByIDNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if _, err := repo.GetByID("999"); err == nil {
+			t.Fatal("Expected error for non-existent user, got nil")
+		}
+	})
+
+	t.Run("GetByUsername", func(t *testing.T) {
+		repo := newRepo(t)
+
+		user := newUser("1", "testuser")
+		if err := repo.Create(user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		retrieved, err := repo.GetByUsername("testuser")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if retrieved.ID != user.ID {
+			t.Errorf("Expected ID %s, got %s", user.ID, retrieved.ID)
+		}
+
+		if _, err := repo.GetByUsername("nobody"); err == nil {
+			t.Fatal("Expected error for non-existent username, got nil")
+		}
+	})
+
+	t.Run("Exists", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if repo.Exists("testuser") {
+			t.Error("Expected user to not exist")
+		}
+
+		if err := repo.Create(newUser("1", "testuser")); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		if !repo.Exists("testuser") {
+			t.Error("Expected user to exist")
+		}
+	})
+
+	t.Run("ConcurrentCreate", func(t *testing.T) {
+		repo := newRepo(t)
+
+		const workers = 20
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs <- repo.Create(newUser(fmt.Sprintf("id%d", i), fmt.Sprintf("user%d", i)))
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		}
+
+		for i := 0; i < workers; i++ {
+			if !repo.Exists(fmt.Sprintf("user%d", i)) {
+				t.Errorf("Expected user%d to exist", i)
+			}
+		}
+	})
+
+	t.Run("ConcurrentCreateSameUsername", func(t *testing.T) {
+		repo := newRepo(t)
+
+		const workers = 20
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs <- repo.Create(newUser(fmt.Sprintf("id%d", i), "testuser"))
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		succeeded := 0
+		for err := range errs {
+			if err == nil {
+				succeeded++
+			}
+		}
+
+		if succeeded != 1 {
+			t.Errorf("Expected exactly 1 successful create, got %d", succeeded)
+		}
+	})
+}
+
+func newUser(id, username string) *domain.User {
+	return &domain.User{
+		ID:           id,
+		Username:     username,
+		PasswordHash: "hash-" + id,
+		CreatedAt:    time.Now().Truncate(time.Microsecond),
+	}
+}
@@ -8,13 +8,15 @@ import (
 )
 
 type InMemoryRoomRepository struct {
-	rooms map[string]*domain.Room
-	mu    sync.RWMutex
+	rooms      map[string]*domain.Room
+	directKeys map[string]string
+	mu         sync.RWMutex
 }
 
 func NewInMemoryRoomRepository() *InMemoryRoomRepository {
 	return &InMemoryRoomRepository{
-		rooms: make(map[string]*domain.Room),
+		rooms:      make(map[string]*domain.Room),
+		directKeys: make(map[string]string),
 	}
 }
 
@@ -22,6 +24,13 @@ func (r *InMemoryRoomRepository) Create(room *domain.Room) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if room.DirectKey != "" {
+		if _, exists := r.directKeys[room.DirectKey]; exists {
+			return errors.New("room already exists")
+		}
+		r.directKeys[room.DirectKey] = room.ID
+	}
+
 	r.rooms[room.ID] = room
 	return nil
 }
@@ -38,6 +47,18 @@ func (r *InMemoryRoomRepository) GetByID(id string) (*domain.Room, error) {
 	return room, nil
 }
 
+func (r *InMemoryRoomRepository) GetByDirectKey(key string) (*domain.Room, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, exists := r.directKeys[key]
+	if !exists {
+		return nil, errors.New("room not found")
+	}
+
+	return r.rooms[id], nil
+}
+
 func (r *InMemoryRoomRepository) GetAll() ([]*domain.Room, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -50,6 +71,58 @@ func (r *InMemoryRoomRepository) GetAll() ([]*domain.Room, error) {
 	return rooms, nil
 }
 
+// update replaces the stored room with a changed copy, so that rooms already
+// handed out are never modified.
+func (r *InMemoryRoomRepository) update(id string, change func(room *domain.Room) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	room, exists := r.rooms[id]
+	if !exists {
+		return errors.New("room not found")
+	}
+
+	updated := *room
+	updated.PinnedMessageIDs = append([]string(nil), room.PinnedMessageIDs...)
+	if err := change(&updated); err != nil {
+		return err
+	}
+
+	r.rooms[id] = &updated
+	return nil
+}
+
+func (r *InMemoryRoomRepository) SetTopic(id, topic string) error {
+	return r.update(id, func(room *domain.Room) error {
+		room.Topic = topic
+		return nil
+	})
+}
+
+func (r *InMemoryRoomRepository) Pin(id, messageID string) error {
+	return r.update(id, func(room *domain.Room) error {
+		for _, pinned := range room.PinnedMessageIDs {
+			if pinned == messageID {
+				return errors.New("message is already pinned")
+			}
+		}
+		room.PinnedMessageIDs = append(room.PinnedMessageIDs, messageID)
+		return nil
+	})
+}
+
+func (r *InMemoryRoomRepository) Unpin(id, messageID string) error {
+	return r.update(id, func(room *domain.Room) error {
+		for i, pinned := range room.PinnedMessageIDs {
+			if pinned == messageID {
+				room.PinnedMessageIDs = append(room.PinnedMessageIDs[:i], room.PinnedMessageIDs[i+1:]...)
+				return nil
+			}
+		}
+		return errors.New("message is not pinned")
+	})
+}
+
 func (r *InMemoryRoomRepository) Exists(id string) bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
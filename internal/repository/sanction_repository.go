@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+
+	"gochat/internal/domain"
+)
+
+type sanctionKey struct {
+	roomID, userID, kind string
+}
+
+type InMemorySanctionRepository struct {
+	sanctions map[sanctionKey]*domain.Sanction
+	mu        sync.RWMutex
+}
+
+func NewInMemorySanctionRepository() *InMemorySanctionRepository {
+	return &InMemorySanctionRepository{
+		sanctions: make(map[sanctionKey]*domain.Sanction),
+	}
+}
+
+func (r *InMemorySanctionRepository) Put(sanction *domain.Sanction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sanctions[sanctionKey{sanction.RoomID, sanction.UserID, sanction.Kind}] = sanction
+	return nil
+}
+
+func (r *InMemorySanctionRepository) Get(roomID, userID, kind string) (*domain.Sanction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sanction, exists := r.sanctions[sanctionKey{roomID, userID, kind}]
+	if !exists {
+		return nil, errors.New("sanction not found")
+	}
+	return sanction, nil
+}
+
+func (r *InMemorySanctionRepository) Remove(roomID, userID, kind string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := sanctionKey{roomID, userID, kind}
+	if _, exists := r.sanctions[key]; !exists {
+		return errors.New("sanction not found")
+	}
+
+	delete(r.sanctions, key)
+	return nil
+}
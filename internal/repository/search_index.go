@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+// BM25 parameters, the same defaults SQLite's FTS5 uses, so that both
+// indexes rank alike.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type searchDocument struct {
+	roomID    string
+	userID    string
+	createdAt time.Time
+	length    int
+	terms     map[string]int
+}
+
+type InMemorySearchIndex struct {
+	documents map[string]*searchDocument
+	// postings maps each term to the IDs of the messages containing it.
+	postings    map[string]map[string]bool
+	totalLength int
+	mu          sync.RWMutex
+}
+
+func NewInMemorySearchIndex() *InMemorySearchIndex {
+	return &InMemorySearchIndex{
+		documents: make(map[string]*searchDocument),
+		postings:  make(map[string]map[string]bool),
+	}
+}
+
+func (r *InMemorySearchIndex) Index(message *domain.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.remove(message.ID)
+
+	words := domain.SearchTerms(message.Content)
+	document := &searchDocument{
+		roomID:    message.RoomID,
+		userID:    message.UserID,
+		createdAt: message.CreatedAt,
+		length:    len(words),
+		terms:     make(map[string]int),
+	}
+	for _, word := range words {
+		document.terms[word]++
+	}
+
+	for term := range document.terms {
+		if r.postings[term] == nil {
+			r.postings[term] = make(map[string]bool)
+		}
+		r.postings[term][message.ID] = true
+	}
+	r.documents[message.ID] = document
+	r.totalLength += document.length
+	return nil
+}
+
+func (r *InMemorySearchIndex) Remove(messageID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.remove(messageID)
+	return nil
+}
+
+// remove drops a message from the index; r.mu must be held.
+func (r *InMemorySearchIndex) remove(messageID string) {
+	document, exists := r.documents[messageID]
+	if !exists {
+		return
+	}
+
+	for term := range document.terms {
+		delete(r.postings[term], messageID)
+		if len(r.postings[term]) == 0 {
+			delete(r.postings, term)
+		}
+	}
+	delete(r.documents, messageID)
+	r.totalLength -= document.length
+}
+
+func (r *InMemorySearchIndex) Search(query domain.SearchQuery) ([]domain.SearchResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(query.Terms) == 0 || len(query.RoomIDs) == 0 {
+		return []domain.SearchResult{}, nil
+	}
+
+	rooms := make(map[string]bool, len(query.RoomIDs))
+	for _, id := range query.RoomIDs {
+		rooms[id] = true
+	}
+
+	// Every term has to match, so walking the rarest term's postings is
+	// enough to find all candidates.
+	rarest := query.Terms[0]
+	for _, term := range query.Terms[1:] {
+		if len(r.postings[term]) < len(r.postings[rarest]) {
+			rarest = term
+		}
+	}
+
+	type match struct {
+		result    domain.SearchResult
+		createdAt time.Time
+	}
+	matches := make([]match, 0)
+	for id := range r.postings[rarest] {
+		document := r.documents[id]
+		if !r.matches(document, query, rooms) {
+			continue
+		}
+		matches = append(matches, match{
+			result:    domain.SearchResult{MessageID: id, Score: r.score(document, query.Terms)},
+			createdAt: document.createdAt,
+		})
+	}
+
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].result.Score != matches[b].result.Score {
+			return matches[a].result.Score > matches[b].result.Score
+		}
+		return matches[a].createdAt.After(matches[b].createdAt)
+	})
+
+	start := query.Offset
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := start + query.Limit
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	results := make([]domain.SearchResult, 0, end-start)
+	for _, m := range matches[start:end] {
+		results = append(results, m.result)
+	}
+	return results, nil
+}
+
+func (r *InMemorySearchIndex) matches(document *searchDocument, query domain.SearchQuery, rooms map[string]bool) bool {
+	if !rooms[document.roomID] {
+		return false
+	}
+	if query.UserID != "" && document.userID != query.UserID {
+		return false
+	}
+	if !query.Since.IsZero() && document.createdAt.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && !document.createdAt.Before(query.Until) {
+		return false
+	}
+
+	for _, term := range query.Terms {
+		if document.terms[term] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// score rates a document with Okapi BM25.
+func (r *InMemorySearchIndex) score(document *searchDocument, terms []string) float64 {
+	n := float64(len(r.documents))
+	avgLength := float64(r.totalLength) / n
+
+	score := 0.0
+	for _, term := range terms {
+		df := float64(len(r.postings[term]))
+		idf := math.Log((n-df+0.5)/(df+0.5) + 1)
+		tf := float64(document.terms[term])
+		score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(document.length)/avgLength))
+	}
+	return score
+}
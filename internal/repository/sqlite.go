@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// migrations are applied in order by OpenSQLite. Never edit an entry that has
+// been released; append a new one instead.
+var migrations = []string{
+	`CREATE TABLE users (
+		id         TEXT PRIMARY KEY,
+		username   TEXT NOT NULL UNIQUE,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE rooms (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE messages (
+		id         TEXT PRIMARY KEY,
+		room_id    TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		username   TEXT NOT NULL,
+		content    TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX idx_messages_room_created ON messages (room_id, created_at)`,
+	`ALTER TABLE users ADD COLUMN password_hash TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE messages ADD COLUMN seq INTEGER NOT NULL DEFAULT 0`,
+	`UPDATE messages SET seq = (
+		SELECT COUNT(*) FROM messages AS earlier
+		WHERE earlier.room_id = messages.room_id
+		AND (earlier.created_at < messages.created_at
+			OR (earlier.created_at = messages.created_at AND earlier.rowid <= messages.rowid))
+	)`,
+	`CREATE UNIQUE INDEX idx_messages_room_seq ON messages (room_id, seq)`,
+	`ALTER TABLE messages ADD COLUMN edited_at INTEGER`,
+	`ALTER TABLE messages ADD COLUMN deleted_at INTEGER`,
+	`ALTER TABLE messages ADD COLUMN parent_id TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX idx_messages_parent_seq ON messages (parent_id, seq)`,
+	`CREATE TABLE reactions (
+		message_id TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		emoji      TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (message_id, user_id, emoji)
+	)`,
+	`ALTER TABLE rooms ADD COLUMN type TEXT NOT NULL DEFAULT 'public'`,
+	`ALTER TABLE rooms ADD COLUMN direct_key TEXT`,
+	`CREATE UNIQUE INDEX idx_rooms_direct_key ON rooms (direct_key)`,
+	`CREATE TABLE room_members (
+		room_id   TEXT NOT NULL,
+		user_id   TEXT NOT NULL,
+		joined_at INTEGER NOT NULL,
+		PRIMARY KEY (room_id, user_id)
+	)`,
+	`CREATE INDEX idx_room_members_user ON room_members (user_id, joined_at)`,
+	`CREATE TABLE room_invitations (
+		room_id    TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		invited_by TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (room_id, user_id)
+	)`,
+	`CREATE INDEX idx_room_invitations_user ON room_invitations (user_id, created_at)`,
+	`ALTER TABLE room_members ADD COLUMN role TEXT NOT NULL DEFAULT 'member'`,
+	`CREATE TABLE room_sanctions (
+		room_id    TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		kind       TEXT NOT NULL,
+		issued_by  TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER,
+		PRIMARY KEY (room_id, user_id, kind)
+	)`,
+	`CREATE TABLE read_markers (
+		user_id       TEXT NOT NULL,
+		room_id       TEXT NOT NULL,
+		last_read_seq INTEGER NOT NULL,
+		updated_at    INTEGER NOT NULL,
+		PRIMARY KEY (user_id, room_id)
+	)`,
+	// The search index keeps the filterable fields in an ordinary table and
+	// the text in an FTS5 table sharing its rowid.
+	`CREATE TABLE search_documents (
+		doc_id     INTEGER PRIMARY KEY,
+		message_id TEXT NOT NULL UNIQUE,
+		room_id    TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX idx_search_documents_room ON search_documents (room_id, created_at)`,
+	`CREATE VIRTUAL TABLE search_content USING fts5 (content, tokenize = 'unicode61')`,
+	`INSERT INTO search_documents (message_id, room_id, user_id, created_at)
+	SELECT id, room_id, user_id, created_at FROM messages WHERE deleted_at IS NULL`,
+	`INSERT INTO search_content (rowid, content)
+	SELECT d.doc_id, m.content FROM search_documents d JOIN messages m ON m.id = d.message_id`,
+	`CREATE TABLE attachments (
+		id           TEXT PRIMARY KEY,
+		message_id   TEXT NOT NULL,
+		room_id      TEXT NOT NULL,
+		user_id      TEXT NOT NULL,
+		filename     TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size         INTEGER NOT NULL,
+		created_at   INTEGER NOT NULL
+	)`,
+	`CREATE INDEX idx_attachments_message ON attachments (message_id)`,
+	`CREATE TABLE mentions (
+		message_id TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		username   TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		seen       INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (message_id, user_id)
+	)`,
+	`CREATE INDEX idx_mentions_unseen ON mentions (user_id, seen, created_at)`,
+	`ALTER TABLE rooms ADD COLUMN topic TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE room_pins (
+		room_id    TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		pinned_at  INTEGER NOT NULL,
+		PRIMARY KEY (room_id, message_id)
+	)`,
+	`ALTER TABLE messages ADD COLUMN kind TEXT NOT NULL DEFAULT 'user'`,
+}
+
+// OpenSQLite opens the database at path and brings its schema up to date.
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer; serialising access through one
+	// connection avoids SQLITE_BUSY and keeps ":memory:" databases shared.
+	db.SetMaxOpenConns(1)
+
+	pragmas := []string{
+		"PRAGMA foreign_keys = ON",
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA busy_timeout = 5000",
+	}
+	for _, pragma := range pragmas {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to set %q: %w", pragma, err)
+		}
+	}
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
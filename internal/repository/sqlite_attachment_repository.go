@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+const attachmentColumns = `id, message_id, room_id, user_id, filename, content_type, size, created_at`
+
+type SQLiteAttachmentRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteAttachmentRepository(db *sql.DB) *SQLiteAttachmentRepository {
+	return &SQLiteAttachmentRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteAttachmentRepository) Create(attachment *domain.Attachment) error {
+	_, err := r.db.Exec(
+		`INSERT INTO attachments (`+attachmentColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		attachment.ID, attachment.MessageID, attachment.RoomID, attachment.UserID,
+		attachment.Filename, attachment.ContentType, attachment.Size, attachment.CreatedAt.UnixNano(),
+	)
+	if isUniqueViolation(err) {
+		return errors.New("attachment already exists")
+	}
+	return err
+}
+
+func (r *SQLiteAttachmentRepository) GetByID(id string) (*domain.Attachment, error) {
+	attachment, err := scanAttachment(r.db.QueryRow(
+		`SELECT `+attachmentColumns+` FROM attachments WHERE id = ?`,
+		id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("attachment not found")
+	}
+	return attachment, err
+}
+
+func (r *SQLiteAttachmentRepository) GetByMessageIDs(messageIDs []string) (map[string][]*domain.Attachment, error) {
+	result := make(map[string][]*domain.Attachment)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+
+	rows, err := r.db.Query(
+		`SELECT `+attachmentColumns+` FROM attachments
+		WHERE message_id IN (?`+strings.Repeat(", ?", len(messageIDs)-1)+`)
+		ORDER BY rowid`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[attachment.MessageID] = append(result[attachment.MessageID], attachment)
+	}
+	return result, rows.Err()
+}
+
+func scanAttachment(row rowScanner) (*domain.Attachment, error) {
+	var (
+		attachment domain.Attachment
+		createdAt  int64
+	)
+	if err := row.Scan(
+		&attachment.ID, &attachment.MessageID, &attachment.RoomID, &attachment.UserID,
+		&attachment.Filename, &attachment.ContentType, &attachment.Size, &createdAt,
+	); err != nil {
+		return nil, err
+	}
+
+	attachment.CreatedAt = time.Unix(0, createdAt)
+	return &attachment, nil
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+type SQLiteMembershipRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteMembershipRepository(db *sql.DB) *SQLiteMembershipRepository {
+	return &SQLiteMembershipRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteMembershipRepository) Add(membership *domain.Membership) error {
+	_, err := r.db.Exec(
+		`INSERT INTO room_members (room_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)`,
+		membership.RoomID, membership.UserID, membership.Role, membership.JoinedAt.UnixNano(),
+	)
+	if isUniqueViolation(err) {
+		return errors.New("user is already a member")
+	}
+	return err
+}
+
+func (r *SQLiteMembershipRepository) Get(roomID, userID string) (*domain.Membership, error) {
+	var (
+		membership domain.Membership
+		joinedAt   int64
+	)
+
+	err := r.db.QueryRow(
+		`SELECT room_id, user_id, role, joined_at FROM room_members WHERE room_id = ? AND user_id = ?`,
+		roomID, userID,
+	).Scan(&membership.RoomID, &membership.UserID, &membership.Role, &joinedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("membership not found")
+		}
+		return nil, err
+	}
+
+	membership.JoinedAt = time.Unix(0, joinedAt)
+	return &membership, nil
+}
+
+func (r *SQLiteMembershipRepository) SetRole(roomID, userID, role string) error {
+	result, err := r.db.Exec(
+		`UPDATE room_members SET role = ? WHERE room_id = ? AND user_id = ?`,
+		role, roomID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return errors.New("membership not found")
+	}
+	return nil
+}
+
+func (r *SQLiteMembershipRepository) Remove(roomID, userID string) error {
+	return deleteOne(r.db, "membership not found",
+		`DELETE FROM room_members WHERE room_id = ? AND user_id = ?`, roomID, userID)
+}
+
+func (r *SQLiteMembershipRepository) IsMember(roomID, userID string) bool {
+	var exists bool
+	err := r.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM room_members WHERE room_id = ? AND user_id = ?)`,
+		roomID, userID,
+	).Scan(&exists)
+	return err == nil && exists
+}
+
+func (r *SQLiteMembershipRepository) GetRoomIDsByUserID(userID string) ([]string, error) {
+	rows, err := r.db.Query(
+		`SELECT room_id FROM room_members WHERE user_id = ? ORDER BY joined_at, room_id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roomIDs := make([]string, 0)
+	for rows.Next() {
+		var roomID string
+		if err := rows.Scan(&roomID); err != nil {
+			return nil, err
+		}
+		roomIDs = append(roomIDs, roomID)
+	}
+
+	return roomIDs, rows.Err()
+}
+
+func (r *SQLiteMembershipRepository) AddInvitation(invitation *domain.Invitation) error {
+	_, err := r.db.Exec(
+		`INSERT INTO room_invitations (room_id, user_id, invited_by, created_at) VALUES (?, ?, ?, ?)`,
+		invitation.RoomID, invitation.UserID, invitation.InvitedBy, invitation.CreatedAt.UnixNano(),
+	)
+	if isUniqueViolation(err) {
+		return errors.New("user is already invited")
+	}
+	return err
+}
+
+func (r *SQLiteMembershipRepository) GetInvitation(roomID, userID string) (*domain.Invitation, error) {
+	var (
+		invitation domain.Invitation
+		createdAt  int64
+	)
+
+	err := r.db.QueryRow(
+		`SELECT room_id, user_id, invited_by, created_at FROM room_invitations WHERE room_id = ? AND user_id = ?`,
+		roomID, userID,
+	).Scan(&invitation.RoomID, &invitation.UserID, &invitation.InvitedBy, &createdAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("invitation not found")
+		}
+		return nil, err
+	}
+
+	invitation.CreatedAt = time.Unix(0, createdAt)
+	return &invitation, nil
+}
+
+func (r *SQLiteMembershipRepository) RemoveInvitation(roomID, userID string) error {
+	return deleteOne(r.db, "invitation not found",
+		`DELETE FROM room_invitations WHERE room_id = ? AND user_id = ?`, roomID, userID)
+}
+
+func (r *SQLiteMembershipRepository) GetInvitationsByUserID(userID string) ([]*domain.Invitation, error) {
+	rows, err := r.db.Query(
+		`SELECT room_id, user_id, invited_by, created_at FROM room_invitations
+		WHERE user_id = ? ORDER BY created_at, room_id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := make([]*domain.Invitation, 0)
+	for rows.Next() {
+		var (
+			invitation domain.Invitation
+			createdAt  int64
+		)
+		if err := rows.Scan(&invitation.RoomID, &invitation.UserID, &invitation.InvitedBy, &createdAt); err != nil {
+			return nil, err
+		}
+		invitation.CreatedAt = time.Unix(0, createdAt)
+		invitations = append(invitations, &invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+// deleteOne runs a DELETE that is expected to remove a row, returning
+// notFound as an error if it removed none.
+func deleteOne(db *sql.DB, notFound, query string, args ...interface{}) error {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return errors.New(notFound)
+	}
+	return nil
+}
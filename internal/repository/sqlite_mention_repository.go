@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+type SQLiteMentionRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteMentionRepository(db *sql.DB) *SQLiteMentionRepository {
+	return &SQLiteMentionRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteMentionRepository) Add(messageID string, createdAt time.Time, mentions []domain.Mention) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, mention := range mentions {
+		_, err := tx.Exec(
+			`INSERT INTO mentions (message_id, user_id, username, created_at) VALUES (?, ?, ?, ?)`,
+			messageID, mention.UserID, mention.Username, createdAt.UnixNano(),
+		)
+		if isUniqueViolation(err) {
+			return errors.New("mention already exists")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteMentionRepository) GetByMessageIDs(messageIDs []string) (map[string][]domain.Mention, error) {
+	result := make(map[string][]domain.Mention)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+
+	rows, err := r.db.Query(
+		`SELECT message_id, user_id, username FROM mentions
+		WHERE message_id IN (?`+strings.Repeat(", ?", len(messageIDs)-1)+`)
+		ORDER BY rowid`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			messageID string
+			mention   domain.Mention
+		)
+		if err := rows.Scan(&messageID, &mention.UserID, &mention.Username); err != nil {
+			return nil, err
+		}
+		result[messageID] = append(result[messageID], mention)
+	}
+	return result, rows.Err()
+}
+
+func (r *SQLiteMentionRepository) GetUnseen(userID string, limit int) ([]string, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := r.db.Query(
+		`SELECT message_id FROM mentions
+		WHERE user_id = ? AND seen = 0
+		ORDER BY created_at, rowid
+		LIMIT ?`,
+		userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *SQLiteMentionRepository) MarkSeen(userID string, messageIDs []string) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, 0, len(messageIDs)+1)
+	args = append(args, userID)
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	_, err := r.db.Exec(
+		`UPDATE mentions SET seen = 1
+		WHERE user_id = ? AND message_id IN (?`+strings.Repeat(", ?", len(messageIDs)-1)+`)`,
+		args...,
+	)
+	return err
+}
@@ -0,0 +1,297 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+const messageColumns = `id, room_id, seq, user_id, username, content, created_at, edited_at, deleted_at, parent_id, kind`
+
+type SQLiteMessageRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteMessageRepository(db *sql.DB) *SQLiteMessageRepository {
+	return &SQLiteMessageRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteMessageRepository) Create(message *domain.Message) error {
+	// Computing the next sequence number inside the INSERT keeps it atomic
+	// with respect to concurrent writers to the same room.
+	err := r.db.QueryRow(
+		`INSERT INTO messages (`+messageColumns+`)
+		SELECT ?, ?, COALESCE(MAX(seq), 0) + 1, ?, ?, ?, ?, ?, ?, ?, ?
+		FROM messages WHERE room_id = ?
+		RETURNING seq`,
+		message.ID, message.RoomID, message.UserID, message.Username, message.Content, message.CreatedAt.UnixNano(),
+		nullableTime(message.EditedAt), nullableTime(message.DeletedAt), message.ParentID, message.Kind,
+		message.RoomID,
+	).Scan(&message.Seq)
+	if isUniqueViolation(err) {
+		return errors.New("message already exists")
+	}
+	return err
+}
+
+func (r *SQLiteMessageRepository) Update(message *domain.Message) error {
+	result, err := r.db.Exec(
+		`UPDATE messages SET content = ?, edited_at = ?, deleted_at = ? WHERE id = ?`,
+		message.Content, nullableTime(message.EditedAt), nullableTime(message.DeletedAt), message.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return errors.New("message not found")
+	}
+	return nil
+}
+
+func (r *SQLiteMessageRepository) GetByRoomIDBefore(roomID string, beforeSeq int64, limit int) ([]*domain.Message, error) {
+	// The newest messages are picked in descending order and put back into
+	// ascending order by the outer query.
+	rows, err := r.db.Query(
+		`SELECT `+messageColumns+` FROM (
+			SELECT `+messageColumns+` FROM messages
+			WHERE room_id = ? AND seq < ?
+			ORDER BY seq DESC
+			LIMIT ?
+		)
+		ORDER BY seq`,
+		roomID, beforeSeq, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+func (r *SQLiteMessageRepository) GetByRoomIDSince(roomID string, sinceSeq int64, limit int) ([]*domain.Message, error) {
+	rows, err := r.db.Query(
+		`SELECT `+messageColumns+` FROM messages
+		WHERE room_id = ? AND seq > ?
+		ORDER BY seq
+		LIMIT ?`,
+		roomID, sinceSeq, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+func (r *SQLiteMessageRepository) GetReplies(parentID string, limit, offset int) ([]*domain.Message, error) {
+	rows, err := r.db.Query(
+		`SELECT `+messageColumns+` FROM messages
+		WHERE parent_id = ?
+		ORDER BY seq
+		LIMIT ? OFFSET ?`,
+		parentID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMessages(rows)
+}
+
+func (r *SQLiteMessageRepository) CountReplies(parentIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(parentIDs) == 0 {
+		return counts, nil
+	}
+
+	args := make([]interface{}, len(parentIDs))
+	for i, id := range parentIDs {
+		args[i] = id
+	}
+
+	rows, err := r.db.Query(
+		`SELECT parent_id, COUNT(*) FROM messages
+		WHERE parent_id IN (?`+strings.Repeat(", ?", len(parentIDs)-1)+`)
+		GROUP BY parent_id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			parentID string
+			count    int
+		)
+		if err := rows.Scan(&parentID, &count); err != nil {
+			return nil, err
+		}
+		counts[parentID] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (r *SQLiteMessageRepository) CountSinceMany(sinceSeqs map[string]int64, excludeUserID string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(sinceSeqs) == 0 {
+		return counts, nil
+	}
+
+	// The rooms and their starting points are joined in as a table of
+	// values, so that all rooms are counted in one query.
+	args := make([]interface{}, 0, 2*len(sinceSeqs)+2)
+	for roomID, sinceSeq := range sinceSeqs {
+		args = append(args, roomID, sinceSeq)
+	}
+	args = append(args, domain.MessageKindSystem, excludeUserID)
+
+	rows, err := r.db.Query(
+		`WITH since (room_id, seq) AS (VALUES (?, ?)`+strings.Repeat(", (?, ?)", len(sinceSeqs)-1)+`)
+		SELECT m.room_id, COUNT(*) FROM messages m
+		JOIN since s ON m.room_id = s.room_id AND m.seq > s.seq
+		WHERE m.deleted_at IS NULL AND m.kind != ? AND m.user_id != ?
+		GROUP BY m.room_id`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			roomID string
+			count  int
+		)
+		if err := rows.Scan(&roomID, &count); err != nil {
+			return nil, err
+		}
+		counts[roomID] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (r *SQLiteMessageRepository) LastSeq(roomID string) (int64, error) {
+	var seq int64
+	err := r.db.QueryRow(`SELECT COALESCE(MAX(seq), 0) FROM messages WHERE room_id = ?`, roomID).Scan(&seq)
+	return seq, err
+}
+
+func scanMessages(rows *sql.Rows) ([]*domain.Message, error) {
+	defer rows.Close()
+
+	messages := make([]*domain.Message, 0)
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+func (r *SQLiteMessageRepository) GetByID(id string) (*domain.Message, error) {
+	message, err := scanMessage(r.db.QueryRow(`SELECT `+messageColumns+` FROM messages WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("message not found")
+	}
+	return message, err
+}
+
+func (r *SQLiteMessageRepository) GetByIDs(ids []string) (map[string]*domain.Message, error) {
+	messages := make(map[string]*domain.Message, len(ids))
+	if len(ids) == 0 {
+		return messages, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := r.db.Query(
+		`SELECT `+messageColumns+` FROM messages
+		WHERE id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages[message.ID] = message
+	}
+
+	return messages, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMessage(row rowScanner) (*domain.Message, error) {
+	var (
+		message   domain.Message
+		createdAt int64
+		editedAt  sql.NullInt64
+		deletedAt sql.NullInt64
+	)
+
+	err := row.Scan(
+		&message.ID,
+		&message.RoomID,
+		&message.Seq,
+		&message.UserID,
+		&message.Username,
+		&message.Content,
+		&createdAt,
+		&editedAt,
+		&deletedAt,
+		&message.ParentID,
+		&message.Kind,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	message.CreatedAt = time.Unix(0, createdAt)
+	message.EditedAt = timeFromNullable(editedAt)
+	message.DeletedAt = timeFromNullable(deletedAt)
+	return &message, nil
+}
+
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+func timeFromNullable(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.Unix(0, v.Int64)
+	return &t
+}
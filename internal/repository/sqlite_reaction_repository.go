@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"gochat/internal/domain"
+)
+
+type SQLiteReactionRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteReactionRepository(db *sql.DB) *SQLiteReactionRepository {
+	return &SQLiteReactionRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteReactionRepository) Add(reaction *domain.Reaction) error {
+	_, err := r.db.Exec(
+		`INSERT INTO reactions (message_id, user_id, emoji, created_at) VALUES (?, ?, ?, ?)`,
+		reaction.MessageID, reaction.UserID, reaction.Emoji, reaction.CreatedAt.UnixNano(),
+	)
+	if isUniqueViolation(err) {
+		return errors.New("reaction already exists")
+	}
+	return err
+}
+
+func (r *SQLiteReactionRepository) Remove(messageID, userID, emoji string) error {
+	result, err := r.db.Exec(
+		`DELETE FROM reactions WHERE message_id = ? AND user_id = ? AND emoji = ?`,
+		messageID, userID, emoji,
+	)
+	if err != nil {
+		return err
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return errors.New("reaction not found")
+	}
+	return nil
+}
+
+func (r *SQLiteReactionRepository) CountByMessageIDs(messageIDs []string) (map[string][]domain.ReactionCount, error) {
+	result := make(map[string][]domain.ReactionCount)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+
+	// rowid breaks ties between emoji first used within the same nanosecond.
+	rows, err := r.db.Query(
+		`SELECT message_id, emoji, COUNT(*) FROM reactions
+		WHERE message_id IN (?`+strings.Repeat(", ?", len(messageIDs)-1)+`)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at), MIN(rowid)`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			messageID string
+			count     domain.ReactionCount
+		)
+		if err := rows.Scan(&messageID, &count.Emoji, &count.Count); err != nil {
+			return nil, err
+		}
+		result[messageID] = append(result[messageID], count)
+	}
+
+	return result, rows.Err()
+}
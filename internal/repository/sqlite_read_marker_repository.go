@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+type SQLiteReadMarkerRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteReadMarkerRepository(db *sql.DB) *SQLiteReadMarkerRepository {
+	return &SQLiteReadMarkerRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteReadMarkerRepository) Put(marker *domain.ReadMarker) error {
+	_, err := r.db.Exec(
+		`INSERT OR REPLACE INTO read_markers (user_id, room_id, last_read_seq, updated_at)
+		VALUES (?, ?, ?, ?)`,
+		marker.UserID, marker.RoomID, marker.LastReadSeq, marker.UpdatedAt.UnixNano(),
+	)
+	return err
+}
+
+func (r *SQLiteReadMarkerRepository) Get(userID, roomID string) (*domain.ReadMarker, error) {
+	marker, err := scanReadMarker(r.db.QueryRow(
+		`SELECT user_id, room_id, last_read_seq, updated_at FROM read_markers
+		WHERE user_id = ? AND room_id = ?`,
+		userID, roomID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("read marker not found")
+	}
+	return marker, err
+}
+
+func (r *SQLiteReadMarkerRepository) GetByUserID(userID string) ([]*domain.ReadMarker, error) {
+	rows, err := r.db.Query(
+		`SELECT user_id, room_id, last_read_seq, updated_at FROM read_markers
+		WHERE user_id = ?`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	markers := make([]*domain.ReadMarker, 0)
+	for rows.Next() {
+		marker, err := scanReadMarker(rows)
+		if err != nil {
+			return nil, err
+		}
+		markers = append(markers, marker)
+	}
+	return markers, rows.Err()
+}
+
+func scanReadMarker(row rowScanner) (*domain.ReadMarker, error) {
+	var (
+		marker    domain.ReadMarker
+		updatedAt int64
+	)
+	if err := row.Scan(&marker.UserID, &marker.RoomID, &marker.LastReadSeq, &updatedAt); err != nil {
+		return nil, err
+	}
+
+	marker.UpdatedAt = time.Unix(0, updatedAt)
+	return &marker, nil
+}
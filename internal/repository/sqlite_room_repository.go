@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+const roomColumns = "id, name, type, direct_key, topic, created_at"
+
+type SQLiteRoomRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRoomRepository(db *sql.DB) *SQLiteRoomRepository {
+	return &SQLiteRoomRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteRoomRepository) Create(room *domain.Room) error {
+	var directKey interface{}
+	if room.DirectKey != "" {
+		directKey = room.DirectKey
+	}
+
+	_, err := r.db.Exec(
+		`INSERT INTO rooms (`+roomColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		room.ID, room.Name, room.Type, directKey, room.Topic, room.CreatedAt.UnixNano(),
+	)
+	if isUniqueViolation(err) {
+		return errors.New("room already exists")
+	}
+	return err
+}
+
+func (r *SQLiteRoomRepository) GetByID(id string) (*domain.Room, error) {
+	return r.getOne(`SELECT `+roomColumns+` FROM rooms WHERE id = ?`, id)
+}
+
+func (r *SQLiteRoomRepository) GetByDirectKey(key string) (*domain.Room, error) {
+	return r.getOne(`SELECT `+roomColumns+` FROM rooms WHERE direct_key = ?`, key)
+}
+
+func (r *SQLiteRoomRepository) getOne(query, arg string) (*domain.Room, error) {
+	room, err := scanRoom(r.db.QueryRow(query, arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("room not found")
+		}
+		return nil, err
+	}
+
+	if err := r.loadPins([]*domain.Room{room}); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+func (r *SQLiteRoomRepository) GetAll() ([]*domain.Room, error) {
+	rows, err := r.db.Query(`SELECT ` + roomColumns + ` FROM rooms ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rooms := make([]*domain.Room, 0)
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadPins(rooms); err != nil {
+		return nil, err
+	}
+	return rooms, nil
+}
+
+// loadPins fills in the pinned messages of rooms.
+func (r *SQLiteRoomRepository) loadPins(rooms []*domain.Room) error {
+	if len(rooms) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*domain.Room, len(rooms))
+	args := make([]interface{}, len(rooms))
+	for i, room := range rooms {
+		byID[room.ID] = room
+		args[i] = room.ID
+	}
+
+	rows, err := r.db.Query(
+		`SELECT room_id, message_id FROM room_pins
+		WHERE room_id IN (?`+strings.Repeat(", ?", len(rooms)-1)+`)
+		ORDER BY pinned_at, rowid`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roomID, messageID string
+		if err := rows.Scan(&roomID, &messageID); err != nil {
+			return err
+		}
+		room := byID[roomID]
+		room.PinnedMessageIDs = append(room.PinnedMessageIDs, messageID)
+	}
+	return rows.Err()
+}
+
+func (r *SQLiteRoomRepository) Exists(id string) bool {
+	var exists bool
+	err := r.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM rooms WHERE id = ?)`, id).Scan(&exists)
+	return err == nil && exists
+}
+
+func (r *SQLiteRoomRepository) SetTopic(id, topic string) error {
+	result, err := r.db.Exec(`UPDATE rooms SET topic = ? WHERE id = ?`, topic, id)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return errors.New("room not found")
+	}
+	return nil
+}
+
+func (r *SQLiteRoomRepository) Pin(id, messageID string) error {
+	if !r.Exists(id) {
+		return errors.New("room not found")
+	}
+
+	_, err := r.db.Exec(
+		`INSERT INTO room_pins (room_id, message_id, pinned_at) VALUES (?, ?, ?)`,
+		id, messageID, time.Now().UnixNano(),
+	)
+	if isUniqueViolation(err) {
+		return errors.New("message is already pinned")
+	}
+	return err
+}
+
+func (r *SQLiteRoomRepository) Unpin(id, messageID string) error {
+	result, err := r.db.Exec(`DELETE FROM room_pins WHERE room_id = ? AND message_id = ?`, id, messageID)
+	if err != nil {
+		return err
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return errors.New("message is not pinned")
+	}
+	return nil
+}
+
+func scanRoom(row rowScanner) (*domain.Room, error) {
+	var (
+		room      domain.Room
+		directKey sql.NullString
+		createdAt int64
+	)
+
+	if err := row.Scan(&room.ID, &room.Name, &room.Type, &directKey, &room.Topic, &createdAt); err != nil {
+		return nil, err
+	}
+
+	room.DirectKey = directKey.String
+	room.CreatedAt = time.Unix(0, createdAt)
+	return &room, nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+type SQLiteSanctionRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteSanctionRepository(db *sql.DB) *SQLiteSanctionRepository {
+	return &SQLiteSanctionRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteSanctionRepository) Put(sanction *domain.Sanction) error {
+	_, err := r.db.Exec(
+		`INSERT OR REPLACE INTO room_sanctions (room_id, user_id, kind, issued_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		sanction.RoomID, sanction.UserID, sanction.Kind, sanction.IssuedBy,
+		sanction.CreatedAt.UnixNano(), nullableTime(sanction.ExpiresAt),
+	)
+	return err
+}
+
+func (r *SQLiteSanctionRepository) Get(roomID, userID, kind string) (*domain.Sanction, error) {
+	var (
+		sanction  domain.Sanction
+		createdAt int64
+		expiresAt sql.NullInt64
+	)
+
+	err := r.db.QueryRow(
+		`SELECT room_id, user_id, kind, issued_by, created_at, expires_at FROM room_sanctions
+		WHERE room_id = ? AND user_id = ? AND kind = ?`,
+		roomID, userID, kind,
+	).Scan(&sanction.RoomID, &sanction.UserID, &sanction.Kind, &sanction.IssuedBy, &createdAt, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("sanction not found")
+		}
+		return nil, err
+	}
+
+	sanction.CreatedAt = time.Unix(0, createdAt)
+	sanction.ExpiresAt = timeFromNullable(expiresAt)
+	return &sanction, nil
+}
+
+func (r *SQLiteSanctionRepository) Remove(roomID, userID, kind string) error {
+	return deleteOne(r.db, "sanction not found",
+		`DELETE FROM room_sanctions WHERE room_id = ? AND user_id = ? AND kind = ?`, roomID, userID, kind)
+}
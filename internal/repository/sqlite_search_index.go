@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"gochat/internal/domain"
+)
+
+// SQLiteSearchIndex keeps the search index in the database next to the
+// messages, using SQLite's FTS5 for matching and BM25 ranking.
+type SQLiteSearchIndex struct {
+	db *sql.DB
+}
+
+func NewSQLiteSearchIndex(db *sql.DB) *SQLiteSearchIndex {
+	return &SQLiteSearchIndex{
+		db: db,
+	}
+}
+
+func (r *SQLiteSearchIndex) Index(message *domain.Message) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := removeSearchDocument(tx, message.ID); err != nil {
+		return err
+	}
+
+	var docID int64
+	err = tx.QueryRow(
+		`INSERT INTO search_documents (message_id, room_id, user_id, created_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING doc_id`,
+		message.ID, message.RoomID, message.UserID, message.CreatedAt.UnixNano(),
+	).Scan(&docID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO search_content (rowid, content) VALUES (?, ?)`, docID, message.Content); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *SQLiteSearchIndex) Remove(messageID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := removeSearchDocument(tx, messageID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func removeSearchDocument(tx *sql.Tx, messageID string) error {
+	var docID int64
+	err := tx.QueryRow(`SELECT doc_id FROM search_documents WHERE message_id = ?`, messageID).Scan(&docID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM search_content WHERE rowid = ?`, docID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM search_documents WHERE doc_id = ?`, docID)
+	return err
+}
+
+func (r *SQLiteSearchIndex) Search(query domain.SearchQuery) ([]domain.SearchResult, error) {
+	if len(query.Terms) == 0 || len(query.RoomIDs) == 0 {
+		return []domain.SearchResult{}, nil
+	}
+
+	// Terms are letters and digits only, so quoting each one makes a safe
+	// FTS5 query in which all of them must match.
+	phrases := make([]string, len(query.Terms))
+	for n, term := range query.Terms {
+		phrases[n] = `"` + term + `"`
+	}
+
+	conditions := []string{
+		`search_content MATCH ?`,
+		`d.room_id IN (?` + strings.Repeat(", ?", len(query.RoomIDs)-1) + `)`,
+	}
+	args := []interface{}{strings.Join(phrases, " ")}
+	for _, id := range query.RoomIDs {
+		args = append(args, id)
+	}
+	if query.UserID != "" {
+		conditions = append(conditions, `d.user_id = ?`)
+		args = append(args, query.UserID)
+	}
+	if !query.Since.IsZero() {
+		conditions = append(conditions, `d.created_at >= ?`)
+		args = append(args, query.Since.UnixNano())
+	}
+	if !query.Until.IsZero() {
+		conditions = append(conditions, `d.created_at < ?`)
+		args = append(args, query.Until.UnixNano())
+	}
+	args = append(args, query.Limit, query.Offset)
+
+	// bm25 is lower for better matches.
+	rows, err := r.db.Query(
+		`SELECT d.message_id, -bm25(search_content) FROM search_content
+		JOIN search_documents d ON d.doc_id = search_content.rowid
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY bm25(search_content), d.created_at DESC
+		LIMIT ? OFFSET ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]domain.SearchResult, 0)
+	for rows.Next() {
+		var result domain.SearchResult
+		if err := rows.Scan(&result.MessageID, &result.Score); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
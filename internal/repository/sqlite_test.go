@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+func newTestSQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestOpenSQLite_MigrationsAreIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.Close()
+
+	db, err = OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("Expected reopening to succeed, got %v", err)
+	}
+	defer db.Close()
+
+	var version int
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatalf("Failed to read schema version: %v", err)
+	}
+
+	if version != len(migrations) {
+		t.Errorf("Expected schema version %d, got %d", len(migrations), version)
+	}
+}
+
+func TestOpenSQLite_BackfillsMessageSeq(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	seqMigration := -1
+	for i, migration := range migrations {
+		if strings.Contains(migration, "ADD COLUMN seq") {
+			seqMigration = i
+			break
+		}
+	}
+	if seqMigration < 0 {
+		t.Fatal("seq migration not found")
+	}
+
+	// Bring the schema up to just before seq existed and insert legacy rows.
+	saved := migrations
+	migrations = saved[:seqMigration]
+	err = migrate(db)
+	migrations = saved
+	if err != nil {
+		t.Fatalf("Failed to apply legacy migrations: %v", err)
+	}
+
+	legacy := []struct {
+		id, roomID string
+		createdAt  int64
+	}{
+		{"b", "room1", 200},
+		{"a", "room1", 100},
+		{"x", "room2", 150},
+		{"c", "room1", 300},
+	}
+	for _, m := range legacy {
+		_, err := db.Exec(
+			`INSERT INTO messages (id, room_id, user_id, username, content, created_at) VALUES (?, ?, 'u', 'u', 'text', ?)`,
+			m.id, m.roomID, m.createdAt,
+		)
+		if err != nil {
+			t.Fatalf("Failed to insert legacy message: %v", err)
+		}
+	}
+	db.Close()
+
+	db, err = OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewSQLiteMessageRepository(db)
+
+	messages, err := repo.GetByRoomIDSince("room1", 0, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for i, want := range []string{"a", "b", "c"} {
+		if messages[i].ID != want || messages[i].Seq != int64(i+1) {
+			t.Errorf("Expected %s with seq %d, got %s with seq %d", want, i+1, messages[i].ID, messages[i].Seq)
+		}
+		if messages[i].Kind != domain.MessageKindUser {
+			t.Errorf("Expected legacy message %s to be a user message, got %q", want, messages[i].Kind)
+		}
+	}
+
+	next := &domain.Message{ID: "d", RoomID: "room1", UserID: "u", Username: "u", Content: "new", CreatedAt: time.Now()}
+	if err := repo.Create(next); err != nil {
+		t.Fatalf("Failed to create message: %v", err)
+	}
+	if next.Seq != 4 {
+		t.Errorf("Expected new message to continue at seq 4, got %d", next.Seq)
+	}
+}
+
+func TestOpenSQLite_IndexesExistingMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	searchMigration := -1
+	for i, migration := range migrations {
+		if strings.Contains(migration, "CREATE TABLE search_documents") {
+			searchMigration = i
+			break
+		}
+	}
+	if searchMigration < 0 {
+		t.Fatal("search migration not found")
+	}
+
+	// Store messages with the schema from before the search index existed.
+	saved := migrations
+	migrations = saved[:searchMigration]
+	err = migrate(db)
+	migrations = saved
+	if err != nil {
+		t.Fatalf("Failed to apply earlier migrations: %v", err)
+	}
+
+	now := time.Now().UnixNano()
+	for i, message := range []struct {
+		id, content string
+		deletedAt   *int64
+	}{
+		{"a", "hello gophers", nil},
+		{"b", "hello again", nil},
+		{"c", "hello", &now},
+	} {
+		_, err := db.Exec(
+			`INSERT INTO messages (id, room_id, seq, user_id, username, content, created_at, deleted_at) VALUES (?, 'room1', ?, 'u', 'u', ?, ?, ?)`,
+			message.id, i+1, message.content, now, message.deletedAt,
+		)
+		if err != nil {
+			t.Fatalf("Failed to insert message: %v", err)
+		}
+	}
+	db.Close()
+
+	db, err = OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	defer db.Close()
+
+	results, err := NewSQLiteSearchIndex(db).Search(domain.SearchQuery{Terms: []string{"hello"}, RoomIDs: []string{"room1"}, Limit: 10})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected the two messages that were not deleted, got %+v", results)
+	}
+}
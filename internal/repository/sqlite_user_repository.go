@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+type SQLiteUserRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
+	return &SQLiteUserRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteUserRepository) Create(user *domain.User) error {
+	_, err := r.db.Exec(
+		`INSERT INTO users (id, username, password_hash, created_at) VALUES (?, ?, ?, ?)`,
+		user.ID, user.Username, user.PasswordHash, user.CreatedAt.UnixNano(),
+	)
+	if isUniqueViolation(err) {
+		return errors.New("username already exists")
+	}
+	return err
+}
+
+func (r *SQLiteUserRepository) GetByID(id string) (*domain.User, error) {
+	return r.scanUser(r.db.QueryRow(`SELECT id, username, password_hash, created_at FROM users WHERE id = ?`, id))
+}
+
+func (r *SQLiteUserRepository) GetByUsername(username string) (*domain.User, error) {
+	return r.scanUser(r.db.QueryRow(`SELECT id, username, password_hash, created_at FROM users WHERE username = ?`, username))
+}
+
+func (r *SQLiteUserRepository) Exists(username string) bool {
+	var exists bool
+	err := r.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)`, username).Scan(&exists)
+	return err == nil && exists
+}
+
+func (r *SQLiteUserRepository) scanUser(row *sql.Row) (*domain.User, error) {
+	var (
+		user      domain.User
+		createdAt int64
+	)
+
+	if err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &createdAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	user.CreatedAt = time.Unix(0, createdAt)
+	return &user, nil
+}
@@ -1,62 +1,720 @@
 package usecase
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"gochat/internal/domain"
 )
 
+var (
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrNotMessageAuthor   = errors.New("only the author can change this message")
+	ErrSystemMessage      = errors.New("system messages cannot be changed")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrAttachmentTooLarge = errors.New("attachment is too large")
+	ErrAttachmentType     = errors.New("attachment type is not allowed")
+)
+
+const (
+	maxEmojiLength    = 32
+	maxFilenameLength = 255
+	// maxMentions bounds how many distinct names of a message are looked
+	// up as mentions.
+	maxMentions = 20
+)
+
+// AttachmentLimits bound the files MessageUsecase accepts as attachments.
+type AttachmentLimits struct {
+	MaxSize int64
+	// AllowedTypes are MIME types such as "image/png", or "image/*" for a
+	// whole family. The type of a file is detected from its content.
+	AllowedTypes []string
+}
+
+func DefaultAttachmentLimits() AttachmentLimits {
+	return AttachmentLimits{
+		MaxSize:      10 << 20,
+		AllowedTypes: []string{"image/*", "text/plain", "application/pdf", "application/zip", "application/x-gzip"},
+	}
+}
+
+func (l AttachmentLimits) allows(contentType string) bool {
+	for _, allowed := range l.AllowedTypes {
+		if allowed == contentType {
+			return true
+		}
+		if family, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(contentType, family+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 type MessageUsecase struct {
-	messageRepo domain.MessageRepository
-	userRepo    domain.UserRepository
-	roomRepo    domain.RoomRepository
+	messageRepo    domain.MessageRepository
+	userRepo       domain.UserRepository
+	roomRepo       domain.RoomRepository
+	reactionRepo   domain.ReactionRepository
+	attachmentRepo domain.AttachmentRepository
+	mentionRepo    domain.MentionRepository
+	blobs          domain.BlobStorage
+	limits         AttachmentLimits
+	access         roomAccess
 }
 
 func NewMessageUsecase(
 	messageRepo domain.MessageRepository,
 	userRepo domain.UserRepository,
 	roomRepo domain.RoomRepository,
+	reactionRepo domain.ReactionRepository,
+	membershipRepo domain.MembershipRepository,
+	sanctionRepo domain.SanctionRepository,
+	attachmentRepo domain.AttachmentRepository,
+	mentionRepo domain.MentionRepository,
+	blobs domain.BlobStorage,
+	limits AttachmentLimits,
 ) *MessageUsecase {
 	return &MessageUsecase{
-		messageRepo: messageRepo,
-		userRepo:    userRepo,
-		roomRepo:    roomRepo,
+		messageRepo:    messageRepo,
+		userRepo:       userRepo,
+		roomRepo:       roomRepo,
+		reactionRepo:   reactionRepo,
+		attachmentRepo: attachmentRepo,
+		mentionRepo:    mentionRepo,
+		blobs:          blobs,
+		limits:         limits,
+		access: roomAccess{
+			roomRepo:       roomRepo,
+			membershipRepo: membershipRepo,
+			sanctionRepo:   sanctionRepo,
+		},
 	}
 }
 
 func (uc *MessageUsecase) SendMessage(roomID, userID, content string) (*domain.Message, error) {
+	return uc.send(roomID, "", userID, content)
+}
+
+// SendReply posts content to the thread started by parentID, which must be a
+// message in the same room. Replying to a reply adds to the same thread.
+func (uc *MessageUsecase) SendReply(roomID, parentID, userID, content string) (*domain.Message, error) {
+	if parentID == "" {
+		return nil, errors.New("parent message is required")
+	}
+
+	return uc.send(roomID, parentID, userID, content)
+}
+
+func (uc *MessageUsecase) send(roomID, parentID, userID, content string) (*domain.Message, error) {
 	if content == "" {
 		return nil, errors.New("message content cannot be empty")
 	}
 
+	message, err := uc.newMessage(roomID, parentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	message.Content = content
+
+	if err := uc.messageRepo.Create(message); err != nil {
+		return nil, err
+	}
+
+	// The repository may keep the message it was given, so the mentions are
+	// added to a copy.
+	sent := *message
+	uc.addMentions(&sent)
+
+	return &sent, nil
+}
+
+// newMessage checks that userID may post to the room, and to the thread of
+// parentID if set, and returns a message without content for them.
+func (uc *MessageUsecase) newMessage(roomID, parentID, userID string) (*domain.Message, error) {
 	user, err := uc.userRepo.GetByID(userID)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
 
-	if !uc.roomRepo.Exists(roomID) {
-		return nil, errors.New("room not found")
+	if _, err := uc.access.check(roomID, userID); err != nil {
+		return nil, err
+	}
+	if uc.access.sanctioned(roomID, userID, domain.SanctionMute) {
+		return nil, ErrMutedInRoom
 	}
 
-	message := &domain.Message{
+	if parentID != "" {
+		parent, err := uc.messageRepo.GetByID(parentID)
+		if err != nil || parent.DeletedAt != nil {
+			return nil, errors.New("parent message not found")
+		}
+		if parent.RoomID != roomID {
+			return nil, errors.New("parent message is in another room")
+		}
+		if parent.Kind == domain.MessageKindSystem {
+			return nil, errors.New("cannot reply to a system message")
+		}
+		if parent.ParentID != "" {
+			parentID = parent.ParentID
+		}
+	}
+
+	return &domain.Message{
 		ID:        uuid.New().String(),
 		RoomID:    roomID,
+		Kind:      domain.MessageKindUser,
+		ParentID:  parentID,
 		UserID:    userID,
 		Username:  user.Username,
-		Content:   content,
 		CreatedAt: time.Now(),
+	}, nil
+}
+
+// addMentions records the users named with @username in the content of a
+// stored message and sets its Mentions. Unknown names, the author and users
+// who cannot read the room are skipped. A failure to record them is only
+// logged: the message is already stored, and failing the send would make
+// the client send it again.
+func (uc *MessageUsecase) addMentions(message *domain.Message) {
+	var mentions []domain.Mention
+	for _, name := range parseMentions(message.Content) {
+		user, err := uc.userRepo.GetByUsername(name)
+		if err != nil || user.ID == message.UserID {
+			continue
+		}
+		if _, err := uc.access.check(message.RoomID, user.ID); err != nil {
+			continue
+		}
+		mentions = append(mentions, domain.Mention{UserID: user.ID, Username: user.Username})
+	}
+
+	if len(mentions) == 0 {
+		return
+	}
+	if err := uc.mentionRepo.Add(message.ID, message.CreatedAt, mentions); err != nil {
+		log.Printf("Failed to record mentions of message %s: %v", message.ID, err)
+		return
+	}
+
+	message.Mentions = mentions
+}
+
+// parseMentions returns the distinct names written as @name in content. An
+// @ only starts a mention at the beginning of the text or after a character
+// that cannot be part of a name, so e-mail addresses are not mentions.
+func parseMentions(content string) []string {
+	isNameRune := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.'
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	runes := []rune(content)
+	for i := 0; i < len(runes) && len(names) < maxMentions; i++ {
+		if runes[i] != '@' || (i > 0 && isNameRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isNameRune(runes[end]) {
+			end++
+		}
+
+		// A name ends before trailing dots, as in "thanks @bob."
+		name := strings.TrimRight(string(runes[i+1:end]), ".")
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		i = end - 1
+	}
+	return names
+}
+
+// SendAttachment posts a message carrying the file read from content, with
+// caption as its text, which may be empty.
+func (uc *MessageUsecase) SendAttachment(roomID, userID, caption, filename string, content io.Reader) (*domain.Message, error) {
+	filename = cleanFilename(filename)
+	if filename == "" {
+		return nil, errors.New("file name is required")
+	}
+
+	message, err := uc.newMessage(roomID, "", userID)
+	if err != nil {
+		return nil, err
+	}
+	message.Content = caption
+
+	// The type is detected from the first bytes of the file instead of
+	// being trusted from the upload.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.New("file is empty")
+	}
+	head = head[:n]
+
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil || !uc.limits.allows(contentType) {
+		return nil, ErrAttachmentType
+	}
+
+	attachment := &domain.Attachment{
+		ID:          uuid.New().String(),
+		MessageID:   message.ID,
+		RoomID:      roomID,
+		UserID:      userID,
+		Filename:    filename,
+		ContentType: contentType,
+		CreatedAt:   message.CreatedAt,
 	}
 
+	// Reading one byte past the limit tells a file of exactly MaxSize from
+	// a larger one.
+	counter := &countingReader{r: io.LimitReader(io.MultiReader(bytes.NewReader(head), content), uc.limits.MaxSize+1)}
+	if err := uc.blobs.Put(attachment.ID, counter); err != nil {
+		return nil, err
+	}
+	if counter.n > uc.limits.MaxSize {
+		_ = uc.blobs.Delete(attachment.ID)
+		return nil, ErrAttachmentTooLarge
+	}
+	attachment.Size = counter.n
+
+	// The attachment is recorded before its message so that a failure leaves
+	// nothing in history. An attachment whose message was never stored
+	// cannot be opened.
+	if err := uc.attachmentRepo.Create(attachment); err != nil {
+		_ = uc.blobs.Delete(attachment.ID)
+		return nil, err
+	}
 	if err := uc.messageRepo.Create(message); err != nil {
+		_ = uc.blobs.Delete(attachment.ID)
 		return nil, err
 	}
 
+	// The repository may keep the message it was given, so the details are
+	// added to a copy.
+	sent := *message
+	sent.Attachments = []*domain.Attachment{attachment}
+	uc.addMentions(&sent)
+
+	return &sent, nil
+}
+
+// OpenAttachment returns an attachment userID may read together with its
+// content, which the caller must close. Attachments of deleted messages
+// are gone.
+func (uc *MessageUsecase) OpenAttachment(attachmentID, userID string) (*domain.Attachment, io.ReadCloser, error) {
+	attachment, err := uc.attachmentRepo.GetByID(attachmentID)
+	if err != nil {
+		return nil, nil, ErrAttachmentNotFound
+	}
+
+	if _, err := uc.access.check(attachment.RoomID, userID); err != nil {
+		return nil, nil, err
+	}
+
+	message, err := uc.messageRepo.GetByID(attachment.MessageID)
+	if err != nil || message.DeletedAt != nil {
+		return nil, nil, ErrAttachmentNotFound
+	}
+
+	content, err := uc.blobs.Open(attachment.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return attachment, content, nil
+}
+
+// MaxAttachmentSize is the largest file SendAttachment accepts, in bytes.
+func (uc *MessageUsecase) MaxAttachmentSize() int64 {
+	return uc.limits.MaxSize
+}
+
+// cleanFilename keeps the last element of a file path sent by a client,
+// without control characters.
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+
+	if runes := []rune(name); len(runes) > maxFilenameLength {
+		name = string(runes[:maxFilenameLength])
+	}
+	return name
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// EditMessage replaces the content of a message. Only its author may edit
+// it, as long as they may still post to the room, and deleted messages
+// cannot be edited.
+func (uc *MessageUsecase) EditMessage(messageID, userID, content string) (*domain.Message, error) {
+	if content == "" {
+		return nil, errors.New("message content cannot be empty")
+	}
+
+	message, err := uc.getOwnMessage(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	edited := *message
+	edited.Content = content
+	edited.EditedAt = &now
+
+	if err := uc.messageRepo.Update(&edited); err != nil {
+		return nil, err
+	}
+
+	return &edited, nil
+}
+
+// DeleteMessage soft-deletes a message: it keeps its place in the room but
+// loses its content. Its author may delete it, and so may the room's
+// moderators if they outrank the author.
+func (uc *MessageUsecase) DeleteMessage(messageID, userID string) (*domain.Message, error) {
+	message, err := uc.getOwnMessage(messageID, userID)
+	if errors.Is(err, ErrNotMessageAuthor) {
+		message, err = uc.getModeratedMessage(messageID, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	deleted := *message
+	deleted.Content = ""
+	deleted.DeletedAt = &now
+
+	if err := uc.messageRepo.Update(&deleted); err != nil {
+		return nil, err
+	}
+
+	return &deleted, nil
+}
+
+func (uc *MessageUsecase) getOwnMessage(messageID, userID string) (*domain.Message, error) {
+	message, err := uc.messageRepo.GetByID(messageID)
+	if err != nil || message.DeletedAt != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	if message.UserID != userID {
+		return nil, ErrNotMessageAuthor
+	}
+
+	// Authors who can no longer post to the room cannot change what they
+	// posted there either.
+	if _, err := uc.access.check(message.RoomID, userID); err != nil {
+		return nil, err
+	}
+	if uc.access.sanctioned(message.RoomID, userID, domain.SanctionMute) {
+		return nil, ErrMutedInRoom
+	}
+
+	return message, nil
+}
+
+func (uc *MessageUsecase) getModeratedMessage(messageID, moderatorID string) (*domain.Message, error) {
+	message, err := uc.messageRepo.GetByID(messageID)
+	if err != nil || message.DeletedAt != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	room, err := uc.access.check(message.RoomID, moderatorID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Kind == domain.MessageKindSystem {
+		return nil, ErrSystemMessage
+	}
+	if room.IsDirect() || !uc.access.outranks(room.ID, moderatorID, message.UserID) {
+		return nil, ErrNotMessageAuthor
+	}
+
 	return message, nil
 }
 
-func (uc *MessageUsecase) GetMessagesHistory(roomID string, limit, offset int) ([]*domain.Message, error) {
+// HistoryCursor selects a page of room history. Before and After are each a
+// message ID or a Seq: the page holds the messages just before or just after
+// that message, or the newest messages of the room if neither is set.
+type HistoryCursor struct {
+	Before string
+	After  string
+}
+
+// HistoryPage is a run of consecutive messages of a room, oldest first.
+// PrevCursor and NextCursor are the Before and After cursors of the pages on
+// either side of it; they are empty if there are no older or newer messages.
+type HistoryPage struct {
+	Messages   []*domain.Message
+	PrevCursor string
+	NextCursor string
+}
+
+func (uc *MessageUsecase) GetMessagesHistory(roomID, userID string, cursor HistoryCursor, limit int) (*HistoryPage, error) {
+	if _, err := uc.access.check(roomID, userID); err != nil {
+		return nil, err
+	}
+	if cursor.Before != "" && cursor.After != "" {
+		return nil, errors.New("only one of before and after may be set")
+	}
+
+	limit, _ = normalizePage(limit, 0)
+
+	var (
+		messages []*domain.Message
+		err      error
+	)
+	if cursor.After != "" {
+		var afterSeq int64
+		if afterSeq, err = uc.cursorSeq(roomID, cursor.After); err != nil {
+			return nil, err
+		}
+		messages, err = uc.messageRepo.GetByRoomIDSince(roomID, afterSeq, limit)
+	} else {
+		beforeSeq := int64(math.MaxInt64)
+		if cursor.Before != "" {
+			if beforeSeq, err = uc.cursorSeq(roomID, cursor.Before); err != nil {
+				return nil, err
+			}
+		}
+		messages, err = uc.messageRepo.GetByRoomIDBefore(roomID, beforeSeq, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	page := &HistoryPage{}
+	if len(messages) > 0 {
+		lastSeq, err := uc.messageRepo.LastSeq(roomID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Seqs have no gaps, so the ends of the page show whether there is
+		// anything beyond them.
+		if first := messages[0].Seq; first > 1 {
+			page.PrevCursor = strconv.FormatInt(first, 10)
+		}
+		if last := messages[len(messages)-1].Seq; last < lastSeq {
+			page.NextCursor = strconv.FormatInt(last, 10)
+		}
+	}
+
+	if page.Messages, err = uc.withDetails(messages); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// cursorSeq resolves a history cursor, a Seq or the ID of a message in the
+// room, to a Seq.
+func (uc *MessageUsecase) cursorSeq(roomID, cursor string) (int64, error) {
+	if seq, err := strconv.ParseInt(cursor, 10, 64); err == nil {
+		if seq < 0 {
+			return 0, errors.New("invalid cursor")
+		}
+		return seq, nil
+	}
+
+	message, err := uc.messageRepo.GetByID(cursor)
+	if err != nil || message.RoomID != roomID {
+		return 0, ErrMessageNotFound
+	}
+	return message.Seq, nil
+}
+
+// GetThread returns the message that starts the thread of messageID and a
+// page of its replies, oldest first. messageID may be any message of the
+// thread.
+func (uc *MessageUsecase) GetThread(messageID, userID string, limit, offset int) (*domain.Message, []*domain.Message, error) {
+	parent, err := uc.messageRepo.GetByID(messageID)
+	if err != nil {
+		return nil, nil, ErrMessageNotFound
+	}
+	if parent.ParentID != "" {
+		if parent, err = uc.messageRepo.GetByID(parent.ParentID); err != nil {
+			return nil, nil, ErrMessageNotFound
+		}
+	}
+
+	if _, err := uc.access.check(parent.RoomID, userID); err != nil {
+		return nil, nil, err
+	}
+
+	limit, offset = normalizePage(limit, offset)
+	replies, err := uc.messageRepo.GetReplies(parent.ID, limit, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	thread, err := uc.withDetails(append([]*domain.Message{parent}, replies...))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return thread[0], thread[1:], nil
+}
+
+// AddReaction puts emoji on a message on behalf of userID and returns the
+// message with its updated reaction counts.
+func (uc *MessageUsecase) AddReaction(messageID, userID, emoji string) (*domain.Message, error) {
+	if err := validateEmoji(emoji); err != nil {
+		return nil, err
+	}
+
+	message, err := uc.messageRepo.GetByID(messageID)
+	if err != nil || message.DeletedAt != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	if _, err := uc.access.check(message.RoomID, userID); err != nil {
+		return nil, err
+	}
+
+	reaction := &domain.Reaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     emoji,
+		CreatedAt: time.Now(),
+	}
+	if err := uc.reactionRepo.Add(reaction); err != nil {
+		return nil, err
+	}
+
+	return uc.withReactions(message)
+}
+
+// RemoveReaction takes back a reaction userID added earlier and returns the
+// message with its updated reaction counts.
+func (uc *MessageUsecase) RemoveReaction(messageID, userID, emoji string) (*domain.Message, error) {
+	message, err := uc.messageRepo.GetByID(messageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+
+	if _, err := uc.access.check(message.RoomID, userID); err != nil {
+		return nil, err
+	}
+
+	if err := uc.reactionRepo.Remove(messageID, userID, emoji); err != nil {
+		return nil, err
+	}
+
+	return uc.withReactions(message)
+}
+
+func (uc *MessageUsecase) withReactions(message *domain.Message) (*domain.Message, error) {
+	result, err := uc.withDetails([]*domain.Message{message})
+	if err != nil {
+		return nil, err
+	}
+	return result[0], nil
+}
+
+func validateEmoji(emoji string) error {
+	if emoji == "" {
+		return errors.New("emoji cannot be empty")
+	}
+	if len(emoji) > maxEmojiLength || !utf8.ValidString(emoji) || strings.ContainsFunc(emoji, unicode.IsSpace) {
+		return errors.New("invalid emoji")
+	}
+	return nil
+}
+
+// withDetails fills in ReplyCount, Reactions, Attachments and Mentions on
+// copies of the messages, leaving the repository's values untouched.
+func (uc *MessageUsecase) withDetails(messages []*domain.Message) ([]*domain.Message, error) {
+	if len(messages) == 0 {
+		return messages, nil
+	}
+
+	ids := make([]string, 0, len(messages))
+	parentIDs := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+		if message.ParentID == "" {
+			parentIDs = append(parentIDs, message.ID)
+		}
+	}
+
+	replyCounts, err := uc.messageRepo.CountReplies(parentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions, err := uc.reactionRepo.CountByMessageIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := uc.attachmentRepo.GetByMessageIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	mentions, err := uc.mentionRepo.GetByMessageIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*domain.Message, len(messages))
+	for i, message := range messages {
+		detailed := *message
+		detailed.ReplyCount = replyCounts[message.ID]
+		if message.DeletedAt == nil {
+			detailed.Reactions = reactions[message.ID]
+			detailed.Attachments = attachments[message.ID]
+			detailed.Mentions = mentions[message.ID]
+		} else {
+			// A deleted message gives away nothing it carried.
+			detailed.Reactions = nil
+			detailed.Attachments = nil
+			detailed.Mentions = nil
+		}
+		result[i] = &detailed
+	}
+	return result, nil
+}
+
+func normalizePage(limit, offset int) (int, int) {
 	const (
 		defaultLimit = 50
 		maxLimit     = 100
@@ -72,5 +730,135 @@ func (uc *MessageUsecase) GetMessagesHistory(roomID string, limit, offset int) (
 		offset = 0
 	}
 
-	return uc.messageRepo.GetByRoomID(roomID, limit, offset)
+	return limit, offset
+}
+
+// CheckRoomAccess reports whether userID may read and write in the room.
+func (uc *MessageUsecase) CheckRoomAccess(roomID, userID string) error {
+	_, err := uc.access.check(roomID, userID)
+	return err
+}
+
+// DirectParticipants returns the IDs of the two users of a direct room, or
+// nil if roomID is not a direct room.
+func (uc *MessageUsecase) DirectParticipants(roomID string) []string {
+	room, err := uc.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil
+	}
+	return room.Participants()
+}
+
+// PostSystemMessage stores text as a system message of the room, so that
+// events such as people coming and going show up in its history.
+func (uc *MessageUsecase) PostSystemMessage(roomID, text string) (*domain.Message, error) {
+	if text == "" {
+		return nil, errors.New("message content cannot be empty")
+	}
+	if !uc.roomRepo.Exists(roomID) {
+		return nil, errors.New("room not found")
+	}
+
+	message := &domain.Message{
+		ID:        uuid.New().String(),
+		RoomID:    roomID,
+		Kind:      domain.MessageKindSystem,
+		Content:   text,
+		CreatedAt: time.Now(),
+	}
+	if err := uc.messageRepo.Create(message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// GetMessagesSince returns up to limit messages of the room whose Seq is
+// greater than sinceSeq, oldest first.
+func (uc *MessageUsecase) GetMessagesSince(roomID string, sinceSeq int64, limit int) ([]*domain.Message, error) {
+	if !uc.roomRepo.Exists(roomID) {
+		return nil, errors.New("room not found")
+	}
+
+	if sinceSeq < 0 {
+		sinceSeq = 0
+	}
+	if limit <= 0 {
+		return []*domain.Message{}, nil
+	}
+
+	messages, err := uc.messageRepo.GetByRoomIDSince(roomID, sinceSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return uc.withDetails(messages)
+}
+
+// GetNotifications returns up to limit messages mentioning userID that they
+// have not marked seen, oldest first. Mentions in deleted messages and in
+// rooms userID can no longer read are left out.
+func (uc *MessageUsecase) GetNotifications(userID string, limit int) ([]*domain.Message, error) {
+	limit, _ = normalizePage(limit, 0)
+
+	// Some unseen mentions may point to deleted messages or rooms userID can
+	// no longer read, so the scan widens until the page is full or there are
+	// no more mentions.
+	messages := make([]*domain.Message, 0, limit)
+	readable := make(map[string]bool)
+	scanned := 0
+	for scan := limit; ; scan *= 2 {
+		ids, err := uc.mentionRepo.GetUnseen(userID, scan)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) <= scanned {
+			break
+		}
+
+		found, err := uc.messageRepo.GetByIDs(ids[scanned:])
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids[scanned:] {
+			message, ok := found[id]
+			if !ok || message.DeletedAt != nil {
+				continue
+			}
+			allowed, checked := readable[message.RoomID]
+			if !checked {
+				_, err := uc.access.check(message.RoomID, userID)
+				allowed = err == nil
+				readable[message.RoomID] = allowed
+			}
+			if !allowed {
+				continue
+			}
+			messages = append(messages, message)
+			if len(messages) == limit {
+				return uc.withDetails(messages)
+			}
+		}
+
+		if len(ids) < scan {
+			break
+		}
+		scanned = len(ids)
+	}
+
+	return uc.withDetails(messages)
+}
+
+// MarkNotificationsSeen removes the mentions of the given messages from the
+// notifications of userID, or all of them if messageIDs is empty.
+func (uc *MessageUsecase) MarkNotificationsSeen(userID string, messageIDs []string) error {
+	if len(messageIDs) == 0 {
+		ids, err := uc.mentionRepo.GetUnseen(userID, 0)
+		if err != nil {
+			return err
+		}
+		messageIDs = ids
+	}
+
+	return uc.mentionRepo.MarkSeen(userID, messageIDs)
 }
@@ -1,8 +1,12 @@
 package usecase
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -22,30 +26,83 @@ func NewMockMessageRepository() *MockMessageRepository {
 }
 
 func (m *MockMessageRepository) Create(message *domain.Message) error {
+	message.Seq = int64(len(m.roomMessages[message.RoomID]) + 1)
 	m.messages[message.ID] = message
 	m.roomMessages[message.RoomID] = append(m.roomMessages[message.RoomID], message)
 	return nil
 }
 
-func (m *MockMessageRepository) GetByRoomID(roomID string, limit, offset int) ([]*domain.Message, error) {
-	messages, exists := m.roomMessages[roomID]
+func (m *MockMessageRepository) Update(message *domain.Message) error {
+	stored, exists := m.messages[message.ID]
 	if !exists {
-		return []*domain.Message{}, nil
+		return errors.New("message not found")
+	}
+	stored.Content = message.Content
+	stored.EditedAt = message.EditedAt
+	stored.DeletedAt = message.DeletedAt
+	return nil
+}
+
+func (m *MockMessageRepository) GetReplies(parentID string, limit, offset int) ([]*domain.Message, error) {
+	result := make([]*domain.Message, 0)
+	for _, messages := range m.roomMessages {
+		for _, message := range messages {
+			if message.ParentID == parentID {
+				result = append(result, message)
+			}
+		}
 	}
 
-	start := offset
-	if start > len(messages) {
+	if offset > len(result) {
 		return []*domain.Message{}, nil
 	}
+	result = result[offset:]
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (m *MockMessageRepository) CountReplies(parentIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, id := range parentIDs {
+		for _, messages := range m.roomMessages {
+			for _, message := range messages {
+				if message.ParentID == id {
+					counts[id]++
+				}
+			}
+		}
+	}
+	return counts, nil
+}
+
+func (m *MockMessageRepository) GetByRoomIDBefore(roomID string, beforeSeq int64, limit int) ([]*domain.Message, error) {
+	messages := m.roomMessages[roomID]
+
+	end := 0
+	for end < len(messages) && messages[end].Seq < beforeSeq {
+		end++
+	}
 
-	end := start + limit
-	if end > len(messages) {
-		end = len(messages)
+	start := end - limit
+	if start < 0 {
+		start = 0
 	}
 
 	return messages[start:end], nil
 }
 
+func (m *MockMessageRepository) GetByRoomIDSince(roomID string, sinceSeq int64, limit int) ([]*domain.Message, error) {
+	result := make([]*domain.Message, 0)
+	for _, message := range m.roomMessages[roomID] {
+		if message.Seq > sinceSeq && len(result) < limit {
+			result = append(result, message)
+		}
+	}
+	return result, nil
+}
+
 func (m *MockMessageRepository) GetByID(id string) (*domain.Message, error) {
 	message, exists := m.messages[id]
 	if !exists {
@@ -54,6 +111,215 @@ func (m *MockMessageRepository) GetByID(id string) (*domain.Message, error) {
 	return message, nil
 }
 
+func (m *MockMessageRepository) GetByIDs(ids []string) (map[string]*domain.Message, error) {
+	messages := make(map[string]*domain.Message)
+	for _, id := range ids {
+		if message, exists := m.messages[id]; exists {
+			messages[id] = message
+		}
+	}
+	return messages, nil
+}
+
+func (m *MockMessageRepository) CountSinceMany(sinceSeqs map[string]int64, excludeUserID string) (map[string]int, error) {
+	counts := make(map[string]int)
+	for roomID, sinceSeq := range sinceSeqs {
+		for _, message := range m.roomMessages[roomID] {
+			if message.Seq > sinceSeq && message.DeletedAt == nil && message.Kind != domain.MessageKindSystem && message.UserID != excludeUserID {
+				counts[roomID]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+func (m *MockMessageRepository) LastSeq(roomID string) (int64, error) {
+	return int64(len(m.roomMessages[roomID])), nil
+}
+
+type MockReactionRepository struct {
+	reactions []*domain.Reaction
+}
+
+func NewMockReactionRepository() *MockReactionRepository {
+	return &MockReactionRepository{}
+}
+
+func (m *MockReactionRepository) Add(reaction *domain.Reaction) error {
+	for _, existing := range m.reactions {
+		if existing.MessageID == reaction.MessageID && existing.UserID == reaction.UserID && existing.Emoji == reaction.Emoji {
+			return errors.New("reaction already exists")
+		}
+	}
+	m.reactions = append(m.reactions, reaction)
+	return nil
+}
+
+func (m *MockReactionRepository) Remove(messageID, userID, emoji string) error {
+	for i, existing := range m.reactions {
+		if existing.MessageID == messageID && existing.UserID == userID && existing.Emoji == emoji {
+			m.reactions = append(m.reactions[:i], m.reactions[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("reaction not found")
+}
+
+func (m *MockReactionRepository) CountByMessageIDs(messageIDs []string) (map[string][]domain.ReactionCount, error) {
+	result := make(map[string][]domain.ReactionCount)
+	for _, id := range messageIDs {
+		for _, reaction := range m.reactions {
+			if reaction.MessageID != id {
+				continue
+			}
+			counts := result[id]
+			found := false
+			for i := range counts {
+				if counts[i].Emoji == reaction.Emoji {
+					counts[i].Count++
+					found = true
+				}
+			}
+			if !found {
+				counts = append(counts, domain.ReactionCount{Emoji: reaction.Emoji, Count: 1})
+			}
+			result[id] = counts
+		}
+	}
+	return result, nil
+}
+
+type MockAttachmentRepository struct {
+	attachments []*domain.Attachment
+	// createErr, when set, is returned by Create.
+	createErr error
+}
+
+func NewMockAttachmentRepository() *MockAttachmentRepository {
+	return &MockAttachmentRepository{}
+}
+
+func (m *MockAttachmentRepository) Create(attachment *domain.Attachment) error {
+	if m.createErr != nil {
+		return m.createErr
+	}
+	m.attachments = append(m.attachments, attachment)
+	return nil
+}
+
+func (m *MockAttachmentRepository) GetByID(id string) (*domain.Attachment, error) {
+	for _, attachment := range m.attachments {
+		if attachment.ID == id {
+			return attachment, nil
+		}
+	}
+	return nil, errors.New("attachment not found")
+}
+
+func (m *MockAttachmentRepository) GetByMessageIDs(messageIDs []string) (map[string][]*domain.Attachment, error) {
+	result := make(map[string][]*domain.Attachment)
+	for _, id := range messageIDs {
+		for _, attachment := range m.attachments {
+			if attachment.MessageID == id {
+				result[id] = append(result[id], attachment)
+			}
+		}
+	}
+	return result, nil
+}
+
+type mockMention struct {
+	messageID string
+	mention   domain.Mention
+	seen      bool
+}
+
+type MockMentionRepository struct {
+	mentions []*mockMention
+	// addErr, when set, is returned by Add.
+	addErr error
+}
+
+func NewMockMentionRepository() *MockMentionRepository {
+	return &MockMentionRepository{}
+}
+
+func (m *MockMentionRepository) Add(messageID string, createdAt time.Time, mentions []domain.Mention) error {
+	if m.addErr != nil {
+		return m.addErr
+	}
+	for _, mention := range mentions {
+		m.mentions = append(m.mentions, &mockMention{messageID: messageID, mention: mention})
+	}
+	return nil
+}
+
+func (m *MockMentionRepository) GetByMessageIDs(messageIDs []string) (map[string][]domain.Mention, error) {
+	result := make(map[string][]domain.Mention)
+	for _, id := range messageIDs {
+		for _, entry := range m.mentions {
+			if entry.messageID == id {
+				result[id] = append(result[id], entry.mention)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *MockMentionRepository) GetUnseen(userID string, limit int) ([]string, error) {
+	var ids []string
+	for _, entry := range m.mentions {
+		if entry.mention.UserID == userID && !entry.seen && (limit <= 0 || len(ids) < limit) {
+			ids = append(ids, entry.messageID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *MockMentionRepository) MarkSeen(userID string, messageIDs []string) error {
+	for _, entry := range m.mentions {
+		for _, id := range messageIDs {
+			if entry.messageID == id && entry.mention.UserID == userID {
+				entry.seen = true
+			}
+		}
+	}
+	return nil
+}
+
+type MockBlobStorage struct {
+	blobs map[string][]byte
+}
+
+func NewMockBlobStorage() *MockBlobStorage {
+	return &MockBlobStorage{blobs: make(map[string][]byte)}
+}
+
+func (m *MockBlobStorage) Put(key string, content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	m.blobs[key] = data
+	return nil
+}
+
+func (m *MockBlobStorage) Open(key string) (io.ReadCloser, error) {
+	data, exists := m.blobs[key]
+	if !exists {
+		return nil, errors.New("blob not found")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *MockBlobStorage) Delete(key string) error {
+	if _, exists := m.blobs[key]; !exists {
+		return errors.New("blob not found")
+	}
+	delete(m.blobs, key)
+	return nil
+}
+
 type MockRoomRepository struct {
 	rooms map[string]*domain.Room
 }
@@ -77,6 +343,15 @@ func (m *MockRoomRepository) GetByID(id string) (*domain.Room, error) {
 	return room, nil
 }
 
+func (m *MockRoomRepository) GetByDirectKey(key string) (*domain.Room, error) {
+	for _, room := range m.rooms {
+		if room.DirectKey == key {
+			return room, nil
+		}
+	}
+	return nil, errors.New("room not found")
+}
+
 func (m *MockRoomRepository) GetAll() ([]*domain.Room, error) {
 	rooms := make([]*domain.Room, 0, len(m.rooms))
 	for _, room := range m.rooms {
@@ -90,6 +365,43 @@ func (m *MockRoomRepository) Exists(id string) bool {
 	return exists
 }
 
+func (m *MockRoomRepository) SetTopic(id, topic string) error {
+	room, exists := m.rooms[id]
+	if !exists {
+		return errors.New("room not found")
+	}
+	room.Topic = topic
+	return nil
+}
+
+func (m *MockRoomRepository) Pin(id, messageID string) error {
+	room, exists := m.rooms[id]
+	if !exists {
+		return errors.New("room not found")
+	}
+	for _, pinned := range room.PinnedMessageIDs {
+		if pinned == messageID {
+			return errors.New("message is already pinned")
+		}
+	}
+	room.PinnedMessageIDs = append(room.PinnedMessageIDs, messageID)
+	return nil
+}
+
+func (m *MockRoomRepository) Unpin(id, messageID string) error {
+	room, exists := m.rooms[id]
+	if !exists {
+		return errors.New("room not found")
+	}
+	for i, pinned := range room.PinnedMessageIDs {
+		if pinned == messageID {
+			room.PinnedMessageIDs = append(room.PinnedMessageIDs[:i], room.PinnedMessageIDs[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("message is not pinned")
+}
+
 func TestMessageUsecase_SendMessage(t *testing.T) {
 	userRepo := NewMockUserRepository()
 	roomRepo := NewMockRoomRepository()
@@ -113,7 +425,7 @@ func TestMessageUsecase_SendMessage(t *testing.T) {
 		t.Fatalf("Failed to create room: %v", err)
 	}
 
-	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo)
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
 
 	message, err := usecase.SendMessage("room1", "user1", "Hello, world!")
 	if err != nil {
@@ -149,7 +461,9 @@ func TestMessageUsecase_GetMessagesHistory(t *testing.T) {
 	roomRepo := NewMockRoomRepository()
 	messageRepo := NewMockMessageRepository()
 
-	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo)
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Room 1"})
 
 	for i := 0; i < 5; i++ {
 		message := &domain.Message{
@@ -165,21 +479,859 @@ func TestMessageUsecase_GetMessagesHistory(t *testing.T) {
 		}
 	}
 
-	messages, err := usecase.GetMessagesHistory("room1", 10, 0)
+	page, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{}, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertPage(t, page, []string{"msg1", "msg2", "msg3", "msg4", "msg5"}, "", "")
+
+	newest, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{}, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertPage(t, newest, []string{"msg4", "msg5"}, "4", "")
+
+	older, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{Before: newest.PrevCursor}, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertPage(t, older, []string{"msg2", "msg3"}, "2", "3")
+
+	// A message ID works as a cursor as well as a Seq.
+	oldest, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{Before: "msg2"}, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertPage(t, oldest, []string{"msg1"}, "", "1")
+
+	newer, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{After: oldest.NextCursor}, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertPage(t, newer, []string{"msg2", "msg3"}, "2", "3")
+
+	// Messages sent while paging do not shift the pages already seen.
+	if err := messageRepo.Create(&domain.Message{ID: "msg6", RoomID: "room1", UserID: "user1", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to create message: %v", err)
+	}
+	again, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{Before: newest.PrevCursor}, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertPage(t, again, []string{"msg2", "msg3"}, "2", "3")
+
+	caughtUp, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{After: "msg6"}, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	assertPage(t, caughtUp, []string{}, "", "")
+
+	roomRepo.Create(&domain.Room{ID: "room2", Name: "Room 2"})
+	if _, err := usecase.GetMessagesHistory("room2", "user1", HistoryCursor{Before: "msg3"}, 2); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound for a message of another room, got %v", err)
+	}
+	if _, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{Before: "3", After: "1"}, 2); err == nil {
+		t.Error("Expected error when both cursors are set")
+	}
+	if _, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{After: "-1"}, 2); err == nil {
+		t.Error("Expected error for a negative cursor")
+	}
+}
+
+func assertPage(t *testing.T, page *HistoryPage, wantIDs []string, wantPrev, wantNext string) {
+	t.Helper()
+
+	ids := make([]string, len(page.Messages))
+	for i, message := range page.Messages {
+		ids[i] = message.ID
+	}
+	if !reflect.DeepEqual(ids, wantIDs) {
+		t.Errorf("Expected messages %v, got %v", wantIDs, ids)
+	}
+	if page.PrevCursor != wantPrev || page.NextCursor != wantNext {
+		t.Errorf("Expected cursors %q and %q, got %q and %q", wantPrev, wantNext, page.PrevCursor, page.NextCursor)
+	}
+}
+
+func TestMessageUsecase_GetMessagesSince(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+
+	if err := userRepo.Create(&domain.User{ID: "user1", Username: "testuser"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := roomRepo.Create(&domain.Room{ID: "room1", Name: "Test Room"}); err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	for i := 0; i < 5; i++ {
+		if _, err := usecase.SendMessage("room1", "user1", fmt.Sprintf("Message %d", i+1)); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+
+	missed, err := usecase.GetMessagesSince("room1", 3, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(missed) != 2 {
+		t.Fatalf("Expected 2 missed messages, got %d", len(missed))
+	}
+
+	if missed[0].Seq != 4 || missed[1].Seq != 5 {
+		t.Errorf("Expected seqs 4 and 5, got %d and %d", missed[0].Seq, missed[1].Seq)
+	}
+
+	if _, err := usecase.GetMessagesSince("nonexistent", 0, 10); err == nil {
+		t.Fatal("Expected error for non-existent room, got nil")
+	}
+}
+
+func TestMessageUsecase_EditMessage(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "author"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "other"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Test Room"})
+
+	message, err := usecase.SendMessage("room1", "user1", "helo")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	if _, err := usecase.EditMessage(message.ID, "user2", "hijacked"); !errors.Is(err, ErrNotMessageAuthor) {
+		t.Errorf("Expected ErrNotMessageAuthor, got %v", err)
+	}
+
+	if _, err := usecase.EditMessage(message.ID, "user1", ""); err == nil {
+		t.Error("Expected error for empty content, got nil")
+	}
+
+	if _, err := usecase.EditMessage("missing", "user1", "hello"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound, got %v", err)
+	}
+
+	edited, err := usecase.EditMessage(message.ID, "user1", "hello")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
+	if edited.Content != "hello" || edited.EditedAt == nil {
+		t.Errorf("Expected edited content with EditedAt, got %+v", edited)
+	}
+
+	stored, _ := messageRepo.GetByID(message.ID)
+	if stored.Content != "hello" {
+		t.Errorf("Expected stored content hello, got %s", stored.Content)
+	}
+}
+
+func TestMessageUsecase_EditRequiresRoomAccess(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	membershipRepo := NewMockMembershipRepository()
+	sanctionRepo := NewMockSanctionRepository()
+	rooms := NewRoomUsecase(roomRepo, userRepo, membershipRepo, sanctionRepo, NewMockMessageRepository(), NewMockReadMarkerRepository())
+	usecase := NewMessageUsecase(NewMockMessageRepository(), userRepo, roomRepo, NewMockReactionRepository(), membershipRepo, sanctionRepo, NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+	userRepo.Create(&domain.User{ID: "user3", Username: "carol"})
+
+	room, err := rooms.CreateRoom("user1", "General", false)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	muted, err := usecase.SendMessage(room.ID, "user2", "hello")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	banned, err := usecase.SendMessage(room.ID, "user3", "hello")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	if _, err := rooms.Mute(room.ID, "user1", "user2", 0); err != nil {
+		t.Fatalf("Failed to mute: %v", err)
+	}
+	if _, err := usecase.EditMessage(muted.ID, "user2", "said anyway"); !errors.Is(err, ErrMutedInRoom) {
+		t.Errorf("Expected ErrMutedInRoom for an edit while muted, got %v", err)
+	}
+	if _, err := usecase.DeleteMessage(muted.ID, "user2"); !errors.Is(err, ErrMutedInRoom) {
+		t.Errorf("Expected ErrMutedInRoom for a delete while muted, got %v", err)
+	}
+
+	if _, err := rooms.Ban(room.ID, "user1", "user3", 0); err != nil {
+		t.Fatalf("Failed to ban: %v", err)
+	}
+	if _, err := usecase.EditMessage(banned.ID, "user3", "still here"); !errors.Is(err, ErrBannedFromRoom) {
+		t.Errorf("Expected ErrBannedFromRoom for an edit while banned, got %v", err)
+	}
+	if _, err := usecase.DeleteMessage(banned.ID, "user3"); !errors.Is(err, ErrBannedFromRoom) {
+		t.Errorf("Expected ErrBannedFromRoom for a delete while banned, got %v", err)
+	}
+
+	secret, err := rooms.CreateRoom("user1", "Secret", true)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	if _, err := rooms.InviteUser(secret.ID, "user1", "user2"); err != nil {
+		t.Fatalf("Failed to invite: %v", err)
+	}
+	if _, err := rooms.AcceptInvitation(secret.ID, "user2"); err != nil {
+		t.Fatalf("Failed to accept invitation: %v", err)
+	}
+	left, err := usecase.SendMessage(secret.ID, "user2", "bye")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	if err := rooms.LeaveRoom(secret.ID, "user2"); err != nil {
+		t.Fatalf("Failed to leave room: %v", err)
+	}
+	if _, err := usecase.EditMessage(left.ID, "user2", "changed my mind"); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied for an edit after leaving, got %v", err)
+	}
+}
+
+func TestMessageUsecase_DeleteMessage(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "author"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "other"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Test Room"})
 
-	if len(messages) != 5 {
-		t.Errorf("Expected 5 messages, got %d", len(messages))
+	message, err := usecase.SendMessage("room1", "user1", "oops")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	if _, err := usecase.DeleteMessage(message.ID, "user2"); !errors.Is(err, ErrNotMessageAuthor) {
+		t.Errorf("Expected ErrNotMessageAuthor, got %v", err)
 	}
 
-	limited, err := usecase.GetMessagesHistory("room1", 3, 0)
+	deleted, err := usecase.DeleteMessage(message.ID, "user1")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
+	if deleted.Content != "" || deleted.DeletedAt == nil {
+		t.Errorf("Expected empty content with DeletedAt, got %+v", deleted)
+	}
 
-	if len(limited) != 3 {
-		t.Errorf("Expected 3 messages with limit, got %d", len(limited))
+	if _, err := usecase.DeleteMessage(message.ID, "user1"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound for repeated delete, got %v", err)
+	}
+	if _, err := usecase.EditMessage(message.ID, "user1", "back"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound when editing a deleted message, got %v", err)
+	}
+
+	page, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{}, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	history := page.Messages
+	if len(history) != 1 || history[0].DeletedAt == nil {
+		t.Errorf("Expected deleted message to stay in history, got %v", history)
+	}
+}
+
+func TestMessageUsecase_SendReply(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "testuser"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Room 1"})
+	roomRepo.Create(&domain.Room{ID: "room2", Name: "Room 2"})
+
+	parent, err := usecase.SendMessage("room1", "user1", "question")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	reply, err := usecase.SendReply("room1", parent.ID, "user1", "answer")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if reply.ParentID != parent.ID {
+		t.Errorf("Expected ParentID %s, got %s", parent.ID, reply.ParentID)
+	}
+
+	nested, err := usecase.SendReply("room1", reply.ID, "user1", "follow-up")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if nested.ParentID != parent.ID {
+		t.Errorf("Expected reply to a reply to join thread %s, got %s", parent.ID, nested.ParentID)
+	}
+
+	if _, err := usecase.SendReply("room2", parent.ID, "user1", "wrong room"); err == nil {
+		t.Error("Expected error for parent in another room, got nil")
+	}
+	if _, err := usecase.SendReply("room1", "missing", "user1", "orphan"); err == nil {
+		t.Error("Expected error for missing parent, got nil")
+	}
+
+	if _, err := usecase.DeleteMessage(parent.ID, "user1"); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+	if _, err := usecase.SendReply("room1", parent.ID, "user1", "too late"); err == nil {
+		t.Error("Expected error for deleted parent, got nil")
+	}
+}
+
+func TestMessageUsecase_PostSystemMessage(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+	membershipRepo := NewMockMembershipRepository()
+
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), membershipRepo, NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "testuser"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Room 1"})
+
+	sent, err := usecase.SendMessage("room1", "user1", "hello")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	if sent.Kind != domain.MessageKindUser {
+		t.Errorf("Expected a user message, got kind %q", sent.Kind)
+	}
+
+	system, err := usecase.PostSystemMessage("room1", "testuser entered the room")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if system.Kind != domain.MessageKindSystem || system.UserID != "" || system.Seq != 2 {
+		t.Errorf("Expected an authorless system message with seq 2, got %+v", system)
+	}
+
+	page, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{}, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Messages) != 2 || page.Messages[1].ID != system.ID {
+		t.Errorf("Expected the system message in history, got %+v", page.Messages)
+	}
+
+	if _, err := usecase.SendReply("room1", system.ID, "user1", "welcome"); err == nil {
+		t.Error("Expected error for a reply to a system message, got nil")
+	}
+	if _, err := usecase.EditMessage(system.ID, "user1", "rewritten"); err != ErrNotMessageAuthor {
+		t.Errorf("Expected ErrNotMessageAuthor, got %v", err)
+	}
+
+	membershipRepo.Add(&domain.Membership{RoomID: "room1", UserID: "user1", Role: domain.RoleOwner})
+	if _, err := usecase.DeleteMessage(system.ID, "user1"); !errors.Is(err, ErrSystemMessage) {
+		t.Errorf("Expected ErrSystemMessage when a moderator deletes a system message, got %v", err)
+	}
+	if stored, _ := messageRepo.GetByID(system.ID); stored.DeletedAt != nil {
+		t.Error("Expected the system message to stay in history")
+	}
+	if _, err := usecase.PostSystemMessage("missing", "nobody here"); err == nil {
+		t.Error("Expected error for a missing room, got nil")
+	}
+}
+
+func TestMessageUsecase_GetThread(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "testuser"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Room 1"})
+
+	parent, err := usecase.SendMessage("room1", "user1", "question")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	var firstReply *domain.Message
+	for i := 0; i < 3; i++ {
+		reply, err := usecase.SendReply("room1", parent.ID, "user1", fmt.Sprintf("answer %d", i))
+		if err != nil {
+			t.Fatalf("Failed to send reply: %v", err)
+		}
+		if firstReply == nil {
+			firstReply = reply
+		}
+	}
+
+	root, replies, err := usecase.GetThread(firstReply.ID, "user1", 2, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if root.ID != parent.ID {
+		t.Errorf("Expected thread root %s, got %s", parent.ID, root.ID)
+	}
+	if root.ReplyCount != 3 {
+		t.Errorf("Expected reply count 3, got %d", root.ReplyCount)
+	}
+	if len(replies) != 2 || replies[0].Content != "answer 0" {
+		t.Errorf("Expected first page of 2 replies, got %v", replies)
+	}
+
+	if _, _, err := usecase.GetThread("missing", "user1", 10, 0); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound, got %v", err)
+	}
+
+	page, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{}, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	history := page.Messages
+	if history[0].ReplyCount != 3 {
+		t.Errorf("Expected history to show 3 replies on the parent, got %d", history[0].ReplyCount)
+	}
+	if stored, _ := messageRepo.GetByID(parent.ID); stored.ReplyCount != 0 {
+		t.Errorf("Expected stored message to stay without a reply count, got %d", stored.ReplyCount)
+	}
+}
+
+func TestMessageUsecase_Reactions(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Test Room"})
+
+	message, err := usecase.SendMessage("room1", "user1", "ship it?")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	if _, err := usecase.AddReaction(message.ID, "user1", "👍"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	reacted, err := usecase.AddReaction(message.ID, "user2", "👍")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []domain.ReactionCount{{Emoji: "👍", Count: 2}}
+	if !reflect.DeepEqual(reacted.Reactions, want) {
+		t.Errorf("Expected reactions %v, got %v", want, reacted.Reactions)
+	}
+
+	if _, err := usecase.AddReaction(message.ID, "user2", "👍"); err == nil {
+		t.Error("Expected error for duplicate reaction, got nil")
+	}
+	for _, emoji := range []string{"", "thumbs up", strings.Repeat("x", 33)} {
+		if _, err := usecase.AddReaction(message.ID, "user2", emoji); err == nil {
+			t.Errorf("Expected error for emoji %q, got nil", emoji)
+		}
+	}
+	if _, err := usecase.AddReaction("missing", "user2", "👍"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound, got %v", err)
+	}
+
+	page, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{}, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	history := page.Messages
+	if !reflect.DeepEqual(history[0].Reactions, want) {
+		t.Errorf("Expected history to include reactions %v, got %v", want, history[0].Reactions)
+	}
+
+	removed, err := usecase.RemoveReaction(message.ID, "user1", "👍")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(removed.Reactions) != 1 || removed.Reactions[0].Count != 1 {
+		t.Errorf("Expected one remaining reaction, got %v", removed.Reactions)
+	}
+
+	if _, err := usecase.RemoveReaction(message.ID, "user1", "👍"); err == nil {
+		t.Error("Expected error when removing a missing reaction, got nil")
+	}
+}
+
+func TestMessageUsecase_DirectRoomAccess(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+	userRepo.Create(&domain.User{ID: "user3", Username: "carol"})
+	roomRepo.Create(&domain.Room{
+		ID:        "dm1",
+		Name:      "alice & bob",
+		Type:      domain.RoomTypeDirect,
+		DirectKey: domain.DirectRoomKey("user1", "user2"),
+	})
+
+	message, err := usecase.SendMessage("dm1", "user1", "psst")
+	if err != nil {
+		t.Fatalf("Expected participant to send, got %v", err)
+	}
+	if page, err := usecase.GetMessagesHistory("dm1", "user2", HistoryCursor{}, 10); err != nil || len(page.Messages) != 1 {
+		t.Errorf("Expected participant to read 1 message, got %v", err)
+	}
+
+	if _, err := usecase.SendMessage("dm1", "user3", "hi"); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied on send, got %v", err)
+	}
+	if _, err := usecase.GetMessagesHistory("dm1", "user3", HistoryCursor{}, 10); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied on history, got %v", err)
+	}
+	if _, _, err := usecase.GetThread(message.ID, "user3", 10, 0); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied on thread, got %v", err)
+	}
+	if _, err := usecase.AddReaction(message.ID, "user3", "👀"); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied on reaction, got %v", err)
+	}
+
+	if got := usecase.DirectParticipants("dm1"); len(got) != 2 {
+		t.Errorf("Expected 2 participants, got %v", got)
+	}
+}
+
+func TestMessageUsecase_Attachments(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+	blobs := NewMockBlobStorage()
+
+	limits := AttachmentLimits{MaxSize: 16, AllowedTypes: []string{"text/plain", "image/*"}}
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), blobs, limits)
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+	userRepo.Create(&domain.User{ID: "user3", Username: "carol"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Room 1"})
+	roomRepo.Create(&domain.Room{
+		ID:        "dm1",
+		Name:      "alice & bob",
+		Type:      domain.RoomTypeDirect,
+		DirectKey: domain.DirectRoomKey("user1", "user2"),
+	})
+
+	message, err := usecase.SendAttachment("room1", "user1", "see log", "/var/log/app.log", strings.NewReader("boot ok\n"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if message.Content != "see log" || len(message.Attachments) != 1 {
+		t.Fatalf("Expected captioned message with one attachment, got %+v", message)
+	}
+	attachment := message.Attachments[0]
+	if attachment.Filename != "app.log" || attachment.ContentType != "text/plain" || attachment.Size != 8 {
+		t.Errorf("Expected app.log, text/plain, 8 bytes, got %+v", attachment)
+	}
+
+	found, content, err := usecase.OpenAttachment(attachment.ID, "user2")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	data, _ := io.ReadAll(content)
+	content.Close()
+	if found.ID != attachment.ID || string(data) != "boot ok\n" {
+		t.Errorf("Expected stored content back, got %q", data)
+	}
+
+	page, err := usecase.GetMessagesHistory("room1", "user1", HistoryCursor{}, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Messages) != 1 || len(page.Messages[0].Attachments) != 1 {
+		t.Errorf("Expected history to include the attachment, got %+v", page.Messages)
+	}
+
+	if _, err := usecase.SendAttachment("room1", "user1", "", "big.txt", strings.NewReader(strings.Repeat("x", 17))); !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Errorf("Expected ErrAttachmentTooLarge, got %v", err)
+	}
+	if _, err := usecase.SendAttachment("room1", "user1", "", "exact.txt", strings.NewReader(strings.Repeat("x", 16))); err != nil {
+		t.Errorf("Expected a file of exactly the limit to be accepted, got %v", err)
+	}
+	if _, err := usecase.SendAttachment("room1", "user1", "", "page.pdf", strings.NewReader("%PDF-1.4")); !errors.Is(err, ErrAttachmentType) {
+		t.Errorf("Expected ErrAttachmentType, got %v", err)
+	}
+	if _, err := usecase.SendAttachment("room1", "user1", "", "empty.txt", strings.NewReader("")); err == nil {
+		t.Error("Expected error for an empty file, got nil")
+	}
+	if _, err := usecase.SendAttachment("room1", "user1", "", "..", strings.NewReader("x")); err == nil {
+		t.Error("Expected error for a file without a name, got nil")
+	}
+	if len(blobs.blobs) != 2 {
+		t.Errorf("Expected rejected uploads to leave no blobs, got %d", len(blobs.blobs))
+	}
+
+	private, err := usecase.SendAttachment("dm1", "user1", "", "note.txt", strings.NewReader("secret"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, _, err := usecase.OpenAttachment(private.Attachments[0].ID, "user3"); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied, got %v", err)
+	}
+	if _, err := usecase.SendAttachment("dm1", "user3", "", "note.txt", strings.NewReader("hi")); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied on upload, got %v", err)
+	}
+
+	if _, err := usecase.DeleteMessage(message.ID, "user1"); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+	if _, _, err := usecase.OpenAttachment(attachment.ID, "user1"); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("Expected ErrAttachmentNotFound after deleting the message, got %v", err)
+	}
+	if _, _, err := usecase.OpenAttachment("missing", "user1"); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("Expected ErrAttachmentNotFound, got %v", err)
+	}
+}
+
+func TestMessageUsecase_DeletedAttachmentMessage(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Room 1"})
+
+	message, err := usecase.SendAttachment("room1", "user1", "for @bob", "notes.txt", strings.NewReader("notes"))
+	if err != nil {
+		t.Fatalf("Failed to send attachment: %v", err)
+	}
+	if len(message.Attachments) != 1 || len(message.Mentions) != 1 {
+		t.Fatalf("Expected the sent message to carry its attachment and mention, got %+v", message)
+	}
+	if _, err := usecase.AddReaction(message.ID, "user2", "👍"); err != nil {
+		t.Fatalf("Failed to react: %v", err)
+	}
+	if _, err := usecase.DeleteMessage(message.ID, "user1"); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+
+	page, err := usecase.GetMessagesHistory("room1", "user2", HistoryCursor{}, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(page.Messages) != 1 {
+		t.Fatalf("Expected the deleted message to keep its place, got %+v", page.Messages)
+	}
+	deleted := page.Messages[0]
+	if deleted.DeletedAt == nil || deleted.Content != "" || deleted.Attachments != nil || deleted.Mentions != nil || deleted.Reactions != nil {
+		t.Errorf("Expected a deleted message without content or details, got %+v", deleted)
+	}
+}
+
+func TestMessageUsecase_AttachmentRecordFailure(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+	attachmentRepo := NewMockAttachmentRepository()
+	attachmentRepo.createErr = errors.New("disk full")
+	blobs := NewMockBlobStorage()
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), attachmentRepo, NewMockMentionRepository(), blobs, DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Room 1"})
+
+	if _, err := usecase.SendAttachment("room1", "user1", "see log", "app.log", strings.NewReader("boot ok\n")); err == nil {
+		t.Fatal("Expected error when the attachment cannot be recorded, got nil")
+	}
+
+	if seq, _ := messageRepo.LastSeq("room1"); seq != 0 {
+		t.Errorf("Expected no message in history, got seq %d", seq)
+	}
+	if len(blobs.blobs) != 0 {
+		t.Errorf("Expected the stored file to be deleted, got %d blob(s)", len(blobs.blobs))
+	}
+}
+
+func TestCleanFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"/home/alice/shot.png", "shot.png"},
+		{`C:\Users\alice\shot.png`, "shot.png"},
+		{"bad\x00name\n.txt", "badname.txt"},
+		{"", ""},
+		{"dir/", "dir"},
+		{"..", ""},
+		{strings.Repeat("é", 300), strings.Repeat("é", maxFilenameLength)},
+	}
+
+	for _, tt := range tests {
+		if got := cleanFilename(tt.name); got != tt.want {
+			t.Errorf("cleanFilename(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMessageUsecase_Mentions(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+	userRepo.Create(&domain.User{ID: "user3", Username: "carol"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Room 1"})
+	roomRepo.Create(&domain.Room{
+		ID:        "dm1",
+		Name:      "alice & bob",
+		Type:      domain.RoomTypeDirect,
+		DirectKey: domain.DirectRoomKey("user1", "user2"),
+	})
+
+	message, err := usecase.SendMessage("room1", "user1", "@bob, @carol and @bob again, thanks @alice @nobody bob@example.com")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := fmt.Sprint(message.Mentions); got != "[{user2 bob} {user3 carol}]" {
+		t.Errorf("Expected bob and carol mentioned once each, got %s", got)
+	}
+
+	// carol cannot read the direct room, so she is not notified from it.
+	private, err := usecase.SendMessage("dm1", "user1", "hi @bob and @carol.")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := fmt.Sprint(private.Mentions); got != "[{user2 bob}]" {
+		t.Errorf("Expected only bob mentioned in the direct room, got %s", got)
+	}
+
+	plain, err := usecase.SendMessage("room1", "user2", "no mentions here")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if plain.Mentions != nil {
+		t.Errorf("Expected no mentions, got %v", plain.Mentions)
+	}
+
+	notifications, err := usecase.GetNotifications("user2", 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(notifications) != 2 || notifications[0].ID != message.ID || notifications[1].ID != private.ID {
+		t.Fatalf("Expected both mentions of bob oldest first, got %+v", notifications)
+	}
+	if len(notifications[0].Mentions) != 2 {
+		t.Errorf("Expected notifications to carry their mentions, got %+v", notifications[0])
+	}
+
+	if err := usecase.MarkNotificationsSeen("user2", []string{message.ID}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if notifications, _ := usecase.GetNotifications("user2", 0); len(notifications) != 1 || notifications[0].ID != private.ID {
+		t.Errorf("Expected only the direct mention left, got %+v", notifications)
+	}
+
+	if _, err := usecase.DeleteMessage(message.ID, "user1"); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+	if notifications, _ := usecase.GetNotifications("user3", 0); len(notifications) != 0 {
+		t.Errorf("Expected mentions in deleted messages to be left out, got %+v", notifications)
+	}
+
+	if err := usecase.MarkNotificationsSeen("user2", nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if notifications, _ := usecase.GetNotifications("user2", 0); len(notifications) != 0 {
+		t.Errorf("Expected no notifications after marking all seen, got %+v", notifications)
+	}
+}
+
+func TestMessageUsecase_NotificationsSkipDeletedMessages(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	usecase := NewMessageUsecase(NewMockMessageRepository(), userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Room 1"})
+
+	var sent []*domain.Message
+	for i := 0; i < 4; i++ {
+		message, err := usecase.SendMessage("room1", "user1", fmt.Sprintf("ping %d @bob", i))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		sent = append(sent, message)
+	}
+	for _, message := range sent[:3] {
+		if _, err := usecase.DeleteMessage(message.ID, "user1"); err != nil {
+			t.Fatalf("Failed to delete message: %v", err)
+		}
+	}
+
+	notifications, err := usecase.GetNotifications("user2", 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(notifications) != 1 || notifications[0].ID != sent[3].ID {
+		t.Errorf("Expected the page to be filled past deleted messages, got %+v", notifications)
+	}
+}
+
+func TestMessageUsecase_MentionFailureKeepsMessage(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	messageRepo := NewMockMessageRepository()
+	mentionRepo := NewMockMentionRepository()
+	mentionRepo.addErr = errors.New("database is locked")
+	usecase := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockAttachmentRepository(), mentionRepo, NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+	roomRepo.Create(&domain.Room{ID: "room1", Name: "Room 1"})
+
+	message, err := usecase.SendMessage("room1", "user1", "hi @bob")
+	if err != nil {
+		t.Fatalf("Expected the stored message to be sent anyway, got %v", err)
+	}
+	if len(message.Mentions) != 0 {
+		t.Errorf("Expected no mentions when they could not be recorded, got %+v", message.Mentions)
+	}
+	if seq, _ := messageRepo.LastSeq("room1"); seq != 1 {
+		t.Errorf("Expected exactly one stored message, got seq %d", seq)
+	}
+
+	if _, err := usecase.SendAttachment("room1", "user1", "for @bob", "notes.txt", strings.NewReader("notes")); err != nil {
+		t.Errorf("Expected the attachment to be sent anyway, got %v", err)
+	}
+}
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"hello @bob", "[bob]"},
+		{"@alice: ping @bob.", "[alice bob]"},
+		{"(@j.doe) @j.doe @Ann-Marie_2", "[j.doe Ann-Marie_2]"},
+		{"mail bob@example.com", "[]"},
+		{"@ alone @@bob", "[bob]"},
+		{"привет @иван!", "[иван]"},
+	}
+
+	for _, tt := range tests {
+		if got := fmt.Sprint(parseMentions(tt.content)); got != tt.want {
+			t.Errorf("parseMentions(%q) = %s, want %s", tt.content, got, tt.want)
+		}
 	}
 }
@@ -0,0 +1,144 @@
+package usecase
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+// PresenceUsecase tracks who is connected. It is fed by the WebSocket hub as
+// connections come and go, and keeps no state across restarts.
+type PresenceUsecase struct {
+	users map[string]*presenceState
+	mu    sync.Mutex
+}
+
+type presenceState struct {
+	username string
+	// connections maps the ID of each open connection to whether it is away.
+	connections map[string]bool
+	lastSeen    time.Time
+}
+
+func NewPresenceUsecase() *PresenceUsecase {
+	return &PresenceUsecase{
+		users: make(map[string]*presenceState),
+	}
+}
+
+// Connect records a new connection of userID. It returns the user's presence
+// and whether its status changed.
+func (uc *PresenceUsecase) Connect(userID, username, connID string) (*domain.Presence, bool) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	state, ok := uc.users[userID]
+	if !ok {
+		state = &presenceState{connections: make(map[string]bool)}
+		uc.users[userID] = state
+	}
+	if username != "" {
+		state.username = username
+	}
+
+	return uc.update(userID, state, func() {
+		state.connections[connID] = false
+	})
+}
+
+// Disconnect forgets a connection of userID. It returns the user's presence
+// and whether its status changed.
+func (uc *PresenceUsecase) Disconnect(userID, connID string) (*domain.Presence, bool) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	state, ok := uc.users[userID]
+	if !ok {
+		return uc.presence(userID, nil), false
+	}
+
+	return uc.update(userID, state, func() {
+		delete(state.connections, connID)
+	})
+}
+
+// SetAway marks a connection of userID as idle or active again. It returns
+// the user's presence and whether its status changed.
+func (uc *PresenceUsecase) SetAway(userID, connID string, away bool) (*domain.Presence, bool) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	state, ok := uc.users[userID]
+	if !ok {
+		return uc.presence(userID, nil), false
+	}
+	if _, ok := state.connections[connID]; !ok {
+		return uc.presence(userID, state), false
+	}
+
+	return uc.update(userID, state, func() {
+		state.connections[connID] = away
+	})
+}
+
+// Get returns the presence of userID; users never seen are offline.
+func (uc *PresenceUsecase) Get(userID string) *domain.Presence {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	return uc.presence(userID, uc.users[userID])
+}
+
+// GetMany returns the presence of each of userIDs, ordered by username.
+func (uc *PresenceUsecase) GetMany(userIDs []string) []*domain.Presence {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	result := make([]*domain.Presence, 0, len(userIDs))
+	for _, userID := range userIDs {
+		result = append(result, uc.presence(userID, uc.users[userID]))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Username != result[j].Username {
+			return result[i].Username < result[j].Username
+		}
+		return result[i].UserID < result[j].UserID
+	})
+
+	return result
+}
+
+// update applies change to state and reports the resulting presence. uc.mu
+// must be held.
+func (uc *PresenceUsecase) update(userID string, state *presenceState, change func()) (*domain.Presence, bool) {
+	before := presenceStatus(state)
+	change()
+	state.lastSeen = time.Now()
+
+	presence := uc.presence(userID, state)
+	return presence, presence.Status != before
+}
+
+func (uc *PresenceUsecase) presence(userID string, state *presenceState) *domain.Presence {
+	presence := &domain.Presence{UserID: userID, Status: domain.PresenceOffline}
+	if state != nil {
+		presence.Username = state.username
+		presence.Status = presenceStatus(state)
+		presence.LastSeen = state.lastSeen
+	}
+	return presence
+}
+
+func presenceStatus(state *presenceState) string {
+	if len(state.connections) == 0 {
+		return domain.PresenceOffline
+	}
+	for _, away := range state.connections {
+		if !away {
+			return domain.PresenceOnline
+		}
+	}
+	return domain.PresenceAway
+}
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"testing"
+
+	"gochat/internal/domain"
+)
+
+func TestPresenceUsecase_MultipleConnections(t *testing.T) {
+	usecase := NewPresenceUsecase()
+
+	if presence := usecase.Get("user1"); presence.Status != domain.PresenceOffline {
+		t.Errorf("Expected unknown users to be offline, got %s", presence.Status)
+	}
+
+	presence, changed := usecase.Connect("user1", "alice", "conn1")
+	if !changed || presence.Status != domain.PresenceOnline || presence.Username != "alice" {
+		t.Errorf("Expected alice to come online, got %+v (changed %v)", presence, changed)
+	}
+	if _, changed := usecase.Connect("user1", "alice", "conn2"); changed {
+		t.Error("Expected a second connection not to change the status")
+	}
+
+	if _, changed := usecase.SetAway("user1", "conn1", true); changed {
+		t.Error("Expected the user to stay online while another connection is active")
+	}
+	presence, changed = usecase.SetAway("user1", "conn2", true)
+	if !changed || presence.Status != domain.PresenceAway {
+		t.Errorf("Expected the user to be away once all connections are, got %+v", presence)
+	}
+
+	if _, changed := usecase.Disconnect("user1", "conn1"); changed {
+		t.Error("Expected the user to stay away while a connection is left")
+	}
+	presence, changed = usecase.Disconnect("user1", "conn2")
+	if !changed || presence.Status != domain.PresenceOffline || presence.LastSeen.IsZero() {
+		t.Errorf("Expected the user to go offline with a last-seen time, got %+v", presence)
+	}
+}
+
+func TestPresenceUsecase_GetMany(t *testing.T) {
+	usecase := NewPresenceUsecase()
+	usecase.Connect("user2", "bob", "conn1")
+	usecase.Connect("user1", "alice", "conn2")
+
+	presences := usecase.GetMany([]string{"user2", "user1", "user3"})
+	if len(presences) != 3 {
+		t.Fatalf("Expected 3 presences, got %d", len(presences))
+	}
+	if presences[0].UserID != "user3" || presences[0].Status != domain.PresenceOffline {
+		t.Errorf("Expected the unknown user first and offline, got %+v", presences[0])
+	}
+	if presences[1].Username != "alice" || presences[2].Username != "bob" {
+		t.Errorf("Expected presences ordered by username, got %v and %v", presences[1].Username, presences[2].Username)
+	}
+}
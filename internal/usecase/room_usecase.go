@@ -2,23 +2,66 @@ package usecase
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"gochat/internal/domain"
 )
 
+var (
+	ErrRoomNotFound       = errors.New("room not found")
+	ErrRoomAccessDenied   = errors.New("you do not have access to this room")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrNotRoomModerator   = errors.New("you are not allowed to moderate this user in this room")
+	ErrBannedFromRoom     = errors.New("you are banned from this room")
+	ErrMutedInRoom        = errors.New("you are muted in this room")
+	ErrNotRoomEditor      = errors.New("only moderators can change this room")
+	ErrOwnerCannotLeave   = errors.New("the room owner cannot leave the room")
+)
+
+const (
+	maxTopicLength = 250
+	maxPins        = 50
+)
+
 type RoomUsecase struct {
-	roomRepo domain.RoomRepository
+	roomRepo       domain.RoomRepository
+	userRepo       domain.UserRepository
+	membershipRepo domain.MembershipRepository
+	sanctionRepo   domain.SanctionRepository
+	messageRepo    domain.MessageRepository
+	readMarkerRepo domain.ReadMarkerRepository
+	access         roomAccess
 }
 
-func NewRoomUsecase(roomRepo domain.RoomRepository) *RoomUsecase {
+func NewRoomUsecase(
+	roomRepo domain.RoomRepository,
+	userRepo domain.UserRepository,
+	membershipRepo domain.MembershipRepository,
+	sanctionRepo domain.SanctionRepository,
+	messageRepo domain.MessageRepository,
+	readMarkerRepo domain.ReadMarkerRepository,
+) *RoomUsecase {
 	return &RoomUsecase{
-		roomRepo: roomRepo,
+		roomRepo:       roomRepo,
+		userRepo:       userRepo,
+		membershipRepo: membershipRepo,
+		sanctionRepo:   sanctionRepo,
+		messageRepo:    messageRepo,
+		readMarkerRepo: readMarkerRepo,
+		access: roomAccess{
+			roomRepo:       roomRepo,
+			membershipRepo: membershipRepo,
+			sanctionRepo:   sanctionRepo,
+		},
 	}
 }
 
-func (uc *RoomUsecase) CreateRoom(name string) (*domain.Room, error) {
+// CreateRoom creates a room on behalf of userID, who becomes its owner.
+func (uc *RoomUsecase) CreateRoom(userID, name string, private bool) (*domain.Room, error) {
 	if name == "" {
 		return nil, errors.New("room name cannot be empty")
 	}
@@ -26,24 +69,556 @@ func (uc *RoomUsecase) CreateRoom(name string) (*domain.Room, error) {
 	room := &domain.Room{
 		ID:        uuid.New().String(),
 		Name:      name,
+		Type:      domain.RoomTypePublic,
+		CreatedAt: time.Now(),
+	}
+	if private {
+		room.Type = domain.RoomTypePrivate
+	}
+
+	if err := uc.roomRepo.Create(room); err != nil {
+		return nil, err
+	}
+
+	membership := &domain.Membership{RoomID: room.ID, UserID: userID, Role: domain.RoleOwner, JoinedAt: room.CreatedAt}
+	if err := uc.membershipRepo.Add(membership); err != nil {
+		return nil, err
+	}
+
+	return room, nil
+}
+
+// OpenDirectRoom returns the direct room between userID and otherUserID,
+// creating it on first use.
+func (uc *RoomUsecase) OpenDirectRoom(userID, otherUserID string) (*domain.Room, error) {
+	if userID == otherUserID {
+		return nil, errors.New("cannot open a direct conversation with yourself")
+	}
+
+	key := domain.DirectRoomKey(userID, otherUserID)
+	if room, err := uc.roomRepo.GetByDirectKey(key); err == nil {
+		return room, nil
+	}
+
+	user, err := uc.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	other, err := uc.userRepo.GetByID(otherUserID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	room := &domain.Room{
+		ID:        uuid.New().String(),
+		Name:      user.Username + " & " + other.Username,
+		Type:      domain.RoomTypeDirect,
+		DirectKey: key,
 		CreatedAt: time.Now(),
 	}
 
 	if err := uc.roomRepo.Create(room); err != nil {
+		// Both users may open the conversation at the same time.
+		if existing, getErr := uc.roomRepo.GetByDirectKey(key); getErr == nil {
+			return existing, nil
+		}
 		return nil, err
 	}
 
 	return room, nil
 }
 
-func (uc *RoomUsecase) GetRoom(id string) (*domain.Room, error) {
-	return uc.roomRepo.GetByID(id)
+// InviteUser lets inviteeID join a private room inviterID is a member of.
+func (uc *RoomUsecase) InviteUser(roomID, inviterID, inviteeID string) (*domain.Invitation, error) {
+	room, err := uc.access.check(roomID, inviterID)
+	if err != nil {
+		return nil, err
+	}
+	if !room.IsPrivate() {
+		return nil, errors.New("only private rooms take invitations")
+	}
+
+	inviter, err := uc.userRepo.GetByID(inviterID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if _, err := uc.userRepo.GetByID(inviteeID); err != nil {
+		return nil, errors.New("user not found")
+	}
+	if uc.membershipRepo.IsMember(roomID, inviteeID) {
+		return nil, errors.New("user is already a member")
+	}
+
+	invitation := &domain.Invitation{
+		RoomID:      roomID,
+		UserID:      inviteeID,
+		InvitedBy:   inviterID,
+		CreatedAt:   time.Now(),
+		RoomName:    room.Name,
+		InviterName: inviter.Username,
+	}
+	if err := uc.membershipRepo.AddInvitation(invitation); err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// AcceptInvitation makes userID a member of the room they were invited to.
+func (uc *RoomUsecase) AcceptInvitation(roomID, userID string) (*domain.Room, error) {
+	if _, err := uc.membershipRepo.GetInvitation(roomID, userID); err != nil {
+		return nil, ErrInvitationNotFound
+	}
+
+	room, err := uc.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, ErrRoomNotFound
+	}
+	if uc.access.sanctioned(roomID, userID, domain.SanctionBan) {
+		return nil, ErrBannedFromRoom
+	}
+
+	membership := &domain.Membership{RoomID: roomID, UserID: userID, Role: domain.RoleMember, JoinedAt: time.Now()}
+	if err := uc.membershipRepo.Add(membership); err != nil {
+		return nil, err
+	}
+	if err := uc.membershipRepo.RemoveInvitation(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	return room, nil
+}
+
+// LeaveRoom ends userID's membership. Leaving a private room takes away
+// access to it until the user is invited again. The owner may not leave,
+// since roles cannot be handed over and the room would be left without one.
+func (uc *RoomUsecase) LeaveRoom(roomID, userID string) error {
+	if uc.access.role(roomID, userID) == domain.RoleOwner {
+		return ErrOwnerCannotLeave
+	}
+	if err := uc.membershipRepo.Remove(roomID, userID); err != nil {
+		return errors.New("you are not a member of this room")
+	}
+	return nil
+}
+
+// SetRole makes targetID a moderator or a plain member of the room. Only the
+// owner may change roles; in a public room this also makes targetID a member.
+func (uc *RoomUsecase) SetRole(roomID, ownerID, targetID, role string) (*domain.Membership, error) {
+	if role != domain.RoleModerator && role != domain.RoleMember {
+		return nil, errors.New("role must be moderator or member")
+	}
+
+	room, err := uc.access.check(roomID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if uc.access.role(roomID, ownerID) != domain.RoleOwner {
+		return nil, errors.New("only the room owner can change roles")
+	}
+	if ownerID == targetID {
+		return nil, errors.New("the owner cannot change their own role")
+	}
+	if _, err := uc.userRepo.GetByID(targetID); err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if membership, err := uc.membershipRepo.Get(roomID, targetID); err == nil {
+		if err := uc.membershipRepo.SetRole(roomID, targetID, role); err != nil {
+			return nil, err
+		}
+		membership.Role = role
+		return membership, nil
+	}
+
+	if room.IsPrivate() {
+		return nil, errors.New("user is not a member of this room")
+	}
+	membership := &domain.Membership{RoomID: roomID, UserID: targetID, Role: role, JoinedAt: time.Now()}
+	if err := uc.membershipRepo.Add(membership); err != nil {
+		return nil, err
+	}
+	return membership, nil
+}
+
+// Kick removes targetID from the room. In a private room they lose access
+// until invited again; a public room they may join again right away.
+func (uc *RoomUsecase) Kick(roomID, moderatorID, targetID string) error {
+	if _, err := uc.moderate(roomID, moderatorID, targetID); err != nil {
+		return err
+	}
+
+	// Users of public rooms are usually not members.
+	_ = uc.membershipRepo.Remove(roomID, targetID)
+	return nil
+}
+
+// Ban removes targetID from the room and keeps them out of it for duration,
+// or until unbanned if duration is zero.
+func (uc *RoomUsecase) Ban(roomID, moderatorID, targetID string, duration time.Duration) (*domain.Sanction, error) {
+	sanction, err := uc.sanction(roomID, moderatorID, targetID, domain.SanctionBan, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = uc.membershipRepo.Remove(roomID, targetID)
+	return sanction, nil
 }
 
-func (uc *RoomUsecase) GetAllRooms() ([]*domain.Room, error) {
-	return uc.roomRepo.GetAll()
+func (uc *RoomUsecase) Unban(roomID, moderatorID, targetID string) error {
+	return uc.lift(roomID, moderatorID, targetID, domain.SanctionBan)
+}
+
+// Mute stops targetID from posting to the room for duration, or until
+// unmuted if duration is zero. They can still read it.
+func (uc *RoomUsecase) Mute(roomID, moderatorID, targetID string, duration time.Duration) (*domain.Sanction, error) {
+	return uc.sanction(roomID, moderatorID, targetID, domain.SanctionMute, duration)
+}
+
+func (uc *RoomUsecase) Unmute(roomID, moderatorID, targetID string) error {
+	return uc.lift(roomID, moderatorID, targetID, domain.SanctionMute)
+}
+
+func (uc *RoomUsecase) sanction(roomID, moderatorID, targetID, kind string, duration time.Duration) (*domain.Sanction, error) {
+	if duration < 0 {
+		return nil, errors.New("duration cannot be negative")
+	}
+
+	if _, err := uc.moderate(roomID, moderatorID, targetID); err != nil {
+		return nil, err
+	}
+
+	sanction := &domain.Sanction{
+		RoomID:    roomID,
+		UserID:    targetID,
+		Kind:      kind,
+		IssuedBy:  moderatorID,
+		CreatedAt: time.Now(),
+	}
+	if duration > 0 {
+		expiresAt := sanction.CreatedAt.Add(duration)
+		sanction.ExpiresAt = &expiresAt
+	}
+
+	if err := uc.sanctionRepo.Put(sanction); err != nil {
+		return nil, err
+	}
+	return sanction, nil
+}
+
+func (uc *RoomUsecase) lift(roomID, moderatorID, targetID, kind string) error {
+	if _, err := uc.moderate(roomID, moderatorID, targetID); err != nil {
+		return err
+	}
+
+	if !uc.access.sanctioned(roomID, targetID, kind) {
+		return errors.New("user has no active " + kind + " in this room")
+	}
+	return uc.sanctionRepo.Remove(roomID, targetID, kind)
+}
+
+// moderate returns the room if moderatorID may act on targetID in it.
+func (uc *RoomUsecase) moderate(roomID, moderatorID, targetID string) (*domain.Room, error) {
+	room, err := uc.access.check(roomID, moderatorID)
+	if err != nil {
+		return nil, err
+	}
+	if room.IsDirect() {
+		return nil, errors.New("direct rooms have no moderators")
+	}
+	if moderatorID == targetID {
+		return nil, errors.New("you cannot moderate yourself")
+	}
+	if _, err := uc.userRepo.GetByID(targetID); err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !uc.access.outranks(roomID, moderatorID, targetID) {
+		return nil, ErrNotRoomModerator
+	}
+
+	return room, nil
+}
+
+// SetTopic replaces the topic of the room; an empty topic clears it.
+func (uc *RoomUsecase) SetTopic(roomID, userID, topic string) (*domain.Room, error) {
+	topic = strings.TrimSpace(topic)
+	if utf8.RuneCountInString(topic) > maxTopicLength {
+		return nil, fmt.Errorf("topic cannot be longer than %d characters", maxTopicLength)
+	}
+
+	if _, err := uc.edit(roomID, userID); err != nil {
+		return nil, err
+	}
+	if err := uc.roomRepo.SetTopic(roomID, topic); err != nil {
+		return nil, err
+	}
+
+	return uc.roomRepo.GetByID(roomID)
+}
+
+// PinMessage adds a message of the room to its pinned messages and returns
+// the room with the message.
+func (uc *RoomUsecase) PinMessage(roomID, userID, messageID string) (*domain.Room, *domain.Message, error) {
+	room, err := uc.edit(roomID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message, err := uc.messageRepo.GetByID(messageID)
+	if err != nil || message.RoomID != roomID || message.DeletedAt != nil {
+		return nil, nil, ErrMessageNotFound
+	}
+	if len(room.PinnedMessageIDs) >= maxPins {
+		return nil, nil, fmt.Errorf("a room can have at most %d pinned messages", maxPins)
+	}
+
+	if err := uc.roomRepo.Pin(roomID, messageID); err != nil {
+		return nil, nil, err
+	}
+
+	room, err = uc.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return room, message, nil
+}
+
+// UnpinMessage removes a message from the pinned messages of the room, even
+// one deleted since it was pinned.
+func (uc *RoomUsecase) UnpinMessage(roomID, userID, messageID string) (*domain.Room, *domain.Message, error) {
+	if _, err := uc.edit(roomID, userID); err != nil {
+		return nil, nil, err
+	}
+
+	message, err := uc.messageRepo.GetByID(messageID)
+	if err != nil || message.RoomID != roomID {
+		return nil, nil, ErrMessageNotFound
+	}
+
+	if err := uc.roomRepo.Unpin(roomID, messageID); err != nil {
+		return nil, nil, err
+	}
+
+	room, err := uc.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return room, message, nil
+}
+
+// GetPinnedMessages returns the pinned messages of the room in the order
+// they were pinned, leaving out those deleted since.
+func (uc *RoomUsecase) GetPinnedMessages(roomID, userID string) ([]*domain.Message, error) {
+	room, err := uc.access.check(roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*domain.Message, 0, len(room.PinnedMessageIDs))
+	for _, id := range room.PinnedMessageIDs {
+		message, err := uc.messageRepo.GetByID(id)
+		if err != nil || message.DeletedAt != nil {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// edit returns the room if userID may change its topic and pinned messages:
+// its moderators and owner may, and in a direct room both participants.
+func (uc *RoomUsecase) edit(roomID, userID string) (*domain.Room, error) {
+	room, err := uc.access.check(roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if uc.access.sanctioned(roomID, userID, domain.SanctionMute) {
+		return nil, ErrMutedInRoom
+	}
+	if !room.IsDirect() && uc.access.role(roomID, userID) == domain.RoleMember {
+		return nil, ErrNotRoomEditor
+	}
+
+	return room, nil
+}
+
+// GetInvitations returns the pending invitations of userID, oldest first.
+func (uc *RoomUsecase) GetInvitations(userID string) ([]*domain.Invitation, error) {
+	invitations, err := uc.membershipRepo.GetInvitationsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, invitation := range invitations {
+		if room, err := uc.roomRepo.GetByID(invitation.RoomID); err == nil {
+			invitation.RoomName = room.Name
+		}
+		if inviter, err := uc.userRepo.GetByID(invitation.InvitedBy); err == nil {
+			invitation.InviterName = inviter.Username
+		}
+	}
+
+	return invitations, nil
+}
+
+func (uc *RoomUsecase) GetRoom(id, userID string) (*domain.Room, error) {
+	return uc.access.check(id, userID)
+}
+
+// GetAllRooms lists the public rooms and the private rooms userID is a
+// member of, leaving out those they are banned from; direct rooms are never
+// listed. Each room comes with the number of messages userID has not read
+// yet, not counting their own.
+func (uc *RoomUsecase) GetAllRooms(userID string) ([]*domain.Room, error) {
+	rooms, err := uc.roomRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	memberOf, err := uc.membershipRepo.GetRoomIDsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	member := make(map[string]bool, len(memberOf))
+	for _, id := range memberOf {
+		member[id] = true
+	}
+
+	visible := make([]*domain.Room, 0, len(rooms))
+	for _, room := range rooms {
+		if room.IsDirect() || (room.IsPrivate() && !member[room.ID]) {
+			continue
+		}
+		if uc.access.sanctioned(room.ID, userID, domain.SanctionBan) {
+			continue
+		}
+		visible = append(visible, room)
+	}
+
+	return uc.withUnreadCounts(visible, userID)
+}
+
+// withUnreadCounts fills in UnreadCount on copies of the rooms, leaving the
+// repository's values untouched.
+func (uc *RoomUsecase) withUnreadCounts(rooms []*domain.Room, userID string) ([]*domain.Room, error) {
+	markers, err := uc.readMarkerRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	lastRead := make(map[string]int64, len(markers))
+	for _, marker := range markers {
+		lastRead[marker.RoomID] = marker.LastReadSeq
+	}
+
+	sinceSeqs := make(map[string]int64, len(rooms))
+	for _, room := range rooms {
+		sinceSeqs[room.ID] = lastRead[room.ID]
+	}
+	unread, err := uc.messageRepo.CountSinceMany(sinceSeqs, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*domain.Room, len(rooms))
+	for i, room := range rooms {
+		counted := *room
+		counted.UnreadCount = unread[room.ID]
+		result[i] = &counted
+	}
+	return result, nil
+}
+
+// MarkRead advances userID's read marker in the room to the message with
+// seq, or to the newest message if seq is 0. The marker never moves back,
+// so a stale request leaves it where it is.
+func (uc *RoomUsecase) MarkRead(roomID, userID string, seq int64) (*domain.ReadMarker, error) {
+	if seq < 0 {
+		return nil, errors.New("seq must not be negative")
+	}
+
+	if _, err := uc.access.check(roomID, userID); err != nil {
+		return nil, err
+	}
+
+	last, err := uc.messageRepo.LastSeq(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if seq == 0 || seq > last {
+		seq = last
+	}
+
+	if current, err := uc.readMarkerRepo.Get(userID, roomID); err == nil && current.LastReadSeq >= seq {
+		return current, nil
+	}
+
+	marker := &domain.ReadMarker{
+		UserID:      userID,
+		RoomID:      roomID,
+		LastReadSeq: seq,
+		UpdatedAt:   time.Now(),
+	}
+	if err := uc.readMarkerRepo.Put(marker); err != nil {
+		return nil, err
+	}
+
+	return marker, nil
 }
 
 func (uc *RoomUsecase) RoomExists(id string) bool {
 	return uc.roomRepo.Exists(id)
 }
+
+// roomAccess decides who may read and write in a room: anyone in a public
+// room, members in a private one and the two participants in a direct one,
+// unless they are banned from it.
+type roomAccess struct {
+	roomRepo       domain.RoomRepository
+	membershipRepo domain.MembershipRepository
+	sanctionRepo   domain.SanctionRepository
+}
+
+// check returns the room if userID may read and write in it.
+func (a roomAccess) check(roomID, userID string) (*domain.Room, error) {
+	room, err := a.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, ErrRoomNotFound
+	}
+
+	switch {
+	case room.IsDirect() && !room.HasParticipant(userID):
+		return nil, ErrRoomAccessDenied
+	case room.IsPrivate() && !a.membershipRepo.IsMember(roomID, userID):
+		return nil, ErrRoomAccessDenied
+	case a.sanctioned(roomID, userID, domain.SanctionBan):
+		return nil, ErrBannedFromRoom
+	}
+
+	return room, nil
+}
+
+// sanctioned reports whether userID is under a sanction of kind in the room
+// right now. Expired sanctions are ignored rather than cleaned up.
+func (a roomAccess) sanctioned(roomID, userID, kind string) bool {
+	sanction, err := a.sanctionRepo.Get(roomID, userID, kind)
+	return err == nil && sanction.ActiveAt(time.Now())
+}
+
+// role returns the role of userID in the room; users without a membership
+// count as plain members.
+func (a roomAccess) role(roomID, userID string) string {
+	membership, err := a.membershipRepo.Get(roomID, userID)
+	if err != nil || membership.Role == "" {
+		return domain.RoleMember
+	}
+	return membership.Role
+}
+
+// outranks reports whether actorID is a moderator or owner of the room with
+// a higher role than targetID, which is what it takes to moderate them.
+func (a roomAccess) outranks(roomID, actorID, targetID string) bool {
+	rank := map[string]int{domain.RoleMember: 0, domain.RoleModerator: 1, domain.RoleOwner: 2}
+
+	actor := rank[a.role(roomID, actorID)]
+	return actor >= rank[domain.RoleModerator] && actor > rank[a.role(roomID, targetID)]
+}
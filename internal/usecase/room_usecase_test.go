@@ -0,0 +1,588 @@
+package usecase
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+type MockMembershipRepository struct {
+	members     map[string]*domain.Membership
+	invitations map[string]*domain.Invitation
+}
+
+func NewMockMembershipRepository() *MockMembershipRepository {
+	return &MockMembershipRepository{
+		members:     make(map[string]*domain.Membership),
+		invitations: make(map[string]*domain.Invitation),
+	}
+}
+
+func (m *MockMembershipRepository) Add(membership *domain.Membership) error {
+	key := membership.RoomID + "/" + membership.UserID
+	if _, exists := m.members[key]; exists {
+		return errors.New("user is already a member")
+	}
+	m.members[key] = membership
+	return nil
+}
+
+func (m *MockMembershipRepository) Get(roomID, userID string) (*domain.Membership, error) {
+	membership, exists := m.members[roomID+"/"+userID]
+	if !exists {
+		return nil, errors.New("membership not found")
+	}
+	return membership, nil
+}
+
+func (m *MockMembershipRepository) SetRole(roomID, userID, role string) error {
+	membership, exists := m.members[roomID+"/"+userID]
+	if !exists {
+		return errors.New("membership not found")
+	}
+	membership.Role = role
+	return nil
+}
+
+func (m *MockMembershipRepository) Remove(roomID, userID string) error {
+	if _, exists := m.members[roomID+"/"+userID]; !exists {
+		return errors.New("membership not found")
+	}
+	delete(m.members, roomID+"/"+userID)
+	return nil
+}
+
+func (m *MockMembershipRepository) IsMember(roomID, userID string) bool {
+	_, exists := m.members[roomID+"/"+userID]
+	return exists
+}
+
+func (m *MockMembershipRepository) GetRoomIDsByUserID(userID string) ([]string, error) {
+	roomIDs := make([]string, 0)
+	for _, membership := range m.members {
+		if membership.UserID == userID {
+			roomIDs = append(roomIDs, membership.RoomID)
+		}
+	}
+	return roomIDs, nil
+}
+
+func (m *MockMembershipRepository) AddInvitation(invitation *domain.Invitation) error {
+	key := invitation.RoomID + "/" + invitation.UserID
+	if _, exists := m.invitations[key]; exists {
+		return errors.New("user is already invited")
+	}
+	m.invitations[key] = invitation
+	return nil
+}
+
+func (m *MockMembershipRepository) GetInvitation(roomID, userID string) (*domain.Invitation, error) {
+	invitation, exists := m.invitations[roomID+"/"+userID]
+	if !exists {
+		return nil, errors.New("invitation not found")
+	}
+	return invitation, nil
+}
+
+func (m *MockMembershipRepository) RemoveInvitation(roomID, userID string) error {
+	if _, exists := m.invitations[roomID+"/"+userID]; !exists {
+		return errors.New("invitation not found")
+	}
+	delete(m.invitations, roomID+"/"+userID)
+	return nil
+}
+
+func (m *MockMembershipRepository) GetInvitationsByUserID(userID string) ([]*domain.Invitation, error) {
+	invitations := make([]*domain.Invitation, 0)
+	for _, invitation := range m.invitations {
+		if invitation.UserID == userID {
+			invitations = append(invitations, invitation)
+		}
+	}
+	return invitations, nil
+}
+
+type MockSanctionRepository struct {
+	sanctions map[string]*domain.Sanction
+}
+
+func NewMockSanctionRepository() *MockSanctionRepository {
+	return &MockSanctionRepository{
+		sanctions: make(map[string]*domain.Sanction),
+	}
+}
+
+func (m *MockSanctionRepository) Put(sanction *domain.Sanction) error {
+	m.sanctions[sanction.RoomID+"/"+sanction.UserID+"/"+sanction.Kind] = sanction
+	return nil
+}
+
+func (m *MockSanctionRepository) Get(roomID, userID, kind string) (*domain.Sanction, error) {
+	sanction, exists := m.sanctions[roomID+"/"+userID+"/"+kind]
+	if !exists {
+		return nil, errors.New("sanction not found")
+	}
+	return sanction, nil
+}
+
+func (m *MockSanctionRepository) Remove(roomID, userID, kind string) error {
+	if _, exists := m.sanctions[roomID+"/"+userID+"/"+kind]; !exists {
+		return errors.New("sanction not found")
+	}
+	delete(m.sanctions, roomID+"/"+userID+"/"+kind)
+	return nil
+}
+
+type MockReadMarkerRepository struct {
+	markers map[string]*domain.ReadMarker
+}
+
+func NewMockReadMarkerRepository() *MockReadMarkerRepository {
+	return &MockReadMarkerRepository{
+		markers: make(map[string]*domain.ReadMarker),
+	}
+}
+
+func (m *MockReadMarkerRepository) Put(marker *domain.ReadMarker) error {
+	m.markers[marker.UserID+"/"+marker.RoomID] = marker
+	return nil
+}
+
+func (m *MockReadMarkerRepository) Get(userID, roomID string) (*domain.ReadMarker, error) {
+	marker, exists := m.markers[userID+"/"+roomID]
+	if !exists {
+		return nil, errors.New("read marker not found")
+	}
+	return marker, nil
+}
+
+func (m *MockReadMarkerRepository) GetByUserID(userID string) ([]*domain.ReadMarker, error) {
+	markers := make([]*domain.ReadMarker, 0)
+	for _, marker := range m.markers {
+		if marker.UserID == userID {
+			markers = append(markers, marker)
+		}
+	}
+	return markers, nil
+}
+
+func TestRoomUsecase_OpenDirectRoom(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	usecase := NewRoomUsecase(roomRepo, userRepo, NewMockMembershipRepository(), NewMockSanctionRepository(), NewMockMessageRepository(), NewMockReadMarkerRepository())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+	userRepo.Create(&domain.User{ID: "user3", Username: "carol"})
+
+	if _, err := usecase.CreateRoom("user1", "General", false); err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+
+	room, err := usecase.OpenDirectRoom("user1", "user2")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !room.IsDirect() || !room.HasParticipant("user1") || !room.HasParticipant("user2") {
+		t.Errorf("Expected direct room between user1 and user2, got %+v", room)
+	}
+
+	again, err := usecase.OpenDirectRoom("user2", "user1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if again.ID != room.ID {
+		t.Errorf("Expected the existing room %s, got %s", room.ID, again.ID)
+	}
+
+	if _, err := usecase.OpenDirectRoom("user1", "user1"); err == nil {
+		t.Error("Expected error for a conversation with yourself, got nil")
+	}
+	if _, err := usecase.OpenDirectRoom("user1", "missing"); err == nil {
+		t.Error("Expected error for non-existent user, got nil")
+	}
+
+	rooms, err := usecase.GetAllRooms("user3")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rooms) != 1 || rooms[0].Name != "General" {
+		t.Errorf("Expected only the public room to be listed, got %v", rooms)
+	}
+
+	if _, err := usecase.GetRoom(room.ID, "user2"); err != nil {
+		t.Errorf("Expected participant to get the room, got %v", err)
+	}
+	if _, err := usecase.GetRoom(room.ID, "user3"); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied, got %v", err)
+	}
+}
+
+func TestRoomUsecase_PrivateRooms(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	membershipRepo := NewMockMembershipRepository()
+	sanctionRepo := NewMockSanctionRepository()
+	usecase := NewRoomUsecase(roomRepo, userRepo, membershipRepo, sanctionRepo, NewMockMessageRepository(), NewMockReadMarkerRepository())
+	messages := NewMessageUsecase(NewMockMessageRepository(), userRepo, roomRepo, NewMockReactionRepository(), membershipRepo, sanctionRepo, NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+
+	public, err := usecase.CreateRoom("user1", "General", false)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	room, err := usecase.CreateRoom("user1", "Secret", true)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	if !room.IsPrivate() {
+		t.Fatalf("Expected a private room, got type %s", room.Type)
+	}
+
+	if rooms, _ := usecase.GetAllRooms("user2"); len(rooms) != 1 || rooms[0].ID != public.ID {
+		t.Errorf("Expected outsiders to see only the public room, got %v", rooms)
+	}
+	if rooms, _ := usecase.GetAllRooms("user1"); len(rooms) != 2 {
+		t.Errorf("Expected the creator to see both rooms, got %v", rooms)
+	}
+
+	if _, err := messages.SendMessage(room.ID, "user2", "hi"); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied before joining, got %v", err)
+	}
+	if _, err := messages.GetMessagesHistory(room.ID, "user2", HistoryCursor{}, 10); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied on history before joining, got %v", err)
+	}
+
+	if _, err := usecase.InviteUser(room.ID, "user2", "user2"); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected outsiders not to invite, got %v", err)
+	}
+	if _, err := usecase.InviteUser(public.ID, "user1", "user2"); err == nil {
+		t.Error("Expected error for inviting to a public room, got nil")
+	}
+	if _, err := usecase.AcceptInvitation(room.ID, "user2"); !errors.Is(err, ErrInvitationNotFound) {
+		t.Errorf("Expected ErrInvitationNotFound, got %v", err)
+	}
+
+	invitation, err := usecase.InviteUser(room.ID, "user1", "user2")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if invitation.RoomName != "Secret" || invitation.InviterName != "alice" {
+		t.Errorf("Expected invitation to Secret from alice, got %+v", invitation)
+	}
+	if _, err := usecase.InviteUser(room.ID, "user1", "user2"); err == nil {
+		t.Error("Expected error for a repeated invitation, got nil")
+	}
+
+	if invitations, _ := usecase.GetInvitations("user2"); len(invitations) != 1 {
+		t.Errorf("Expected 1 pending invitation, got %v", invitations)
+	}
+
+	if _, err := usecase.AcceptInvitation(room.ID, "user2"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if invitations, _ := usecase.GetInvitations("user2"); len(invitations) != 0 {
+		t.Errorf("Expected the invitation to be used up, got %v", invitations)
+	}
+	if _, err := messages.SendMessage(room.ID, "user2", "hi"); err != nil {
+		t.Errorf("Expected member to send, got %v", err)
+	}
+
+	if err := usecase.LeaveRoom(room.ID, "user2"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := usecase.LeaveRoom(room.ID, "user2"); err == nil {
+		t.Error("Expected error for leaving twice, got nil")
+	}
+	if _, err := usecase.GetRoom(room.ID, "user2"); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied after leaving, got %v", err)
+	}
+}
+
+func TestRoomUsecase_OwnerCannotLeave(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	membershipRepo := NewMockMembershipRepository()
+	usecase := NewRoomUsecase(NewMockRoomRepository(), userRepo, membershipRepo, NewMockSanctionRepository(), NewMockMessageRepository(), NewMockReadMarkerRepository())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+
+	room, err := usecase.CreateRoom("user1", "Secret", true)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+
+	if err := usecase.LeaveRoom(room.ID, "user1"); !errors.Is(err, ErrOwnerCannotLeave) {
+		t.Fatalf("Expected ErrOwnerCannotLeave, got %v", err)
+	}
+	if membership, err := membershipRepo.Get(room.ID, "user1"); err != nil || membership.Role != domain.RoleOwner {
+		t.Errorf("Expected the owner to keep their membership, got %+v, %v", membership, err)
+	}
+}
+
+func TestRoomUsecase_Moderation(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	membershipRepo := NewMockMembershipRepository()
+	sanctionRepo := NewMockSanctionRepository()
+	usecase := NewRoomUsecase(roomRepo, userRepo, membershipRepo, sanctionRepo, NewMockMessageRepository(), NewMockReadMarkerRepository())
+	messages := NewMessageUsecase(NewMockMessageRepository(), userRepo, roomRepo, NewMockReactionRepository(), membershipRepo, sanctionRepo, NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+	userRepo.Create(&domain.User{ID: "user3", Username: "carol"})
+
+	room, err := usecase.CreateRoom("user1", "General", false)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	if membership, _ := membershipRepo.Get(room.ID, "user1"); membership == nil || membership.Role != domain.RoleOwner {
+		t.Fatalf("Expected the creator to own the room, got %+v", membership)
+	}
+
+	if err := usecase.Kick(room.ID, "user2", "user3"); !errors.Is(err, ErrNotRoomModerator) {
+		t.Errorf("Expected members not to kick, got %v", err)
+	}
+	if _, err := usecase.SetRole(room.ID, "user2", "user3", domain.RoleModerator); err == nil {
+		t.Error("Expected only the owner to change roles, got nil")
+	}
+
+	if _, err := usecase.SetRole(room.ID, "user1", "user2", domain.RoleModerator); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := usecase.Kick(room.ID, "user2", "user1"); !errors.Is(err, ErrNotRoomModerator) {
+		t.Errorf("Expected moderators not to kick the owner, got %v", err)
+	}
+	if err := usecase.Kick(room.ID, "user2", "user3"); err != nil {
+		t.Errorf("Expected moderator to kick, got %v", err)
+	}
+
+	message, err := messages.SendMessage(room.ID, "user3", "spam")
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	if _, err := messages.DeleteMessage(message.ID, "user2"); err != nil {
+		t.Errorf("Expected moderator to delete the message, got %v", err)
+	}
+
+	if _, err := usecase.Mute(room.ID, "user2", "user3", 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := messages.SendMessage(room.ID, "user3", "hi"); !errors.Is(err, ErrMutedInRoom) {
+		t.Errorf("Expected ErrMutedInRoom, got %v", err)
+	}
+	if _, err := messages.GetMessagesHistory(room.ID, "user3", HistoryCursor{}, 10); err != nil {
+		t.Errorf("Expected muted user to read, got %v", err)
+	}
+	if err := usecase.Unmute(room.ID, "user2", "user3"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := messages.SendMessage(room.ID, "user3", "hi"); err != nil {
+		t.Errorf("Expected unmuted user to send, got %v", err)
+	}
+
+	ban, err := usecase.Ban(room.ID, "user2", "user3", time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ban.ExpiresAt == nil {
+		t.Error("Expected the ban to expire")
+	}
+	if err := messages.CheckRoomAccess(room.ID, "user3"); !errors.Is(err, ErrBannedFromRoom) {
+		t.Errorf("Expected ErrBannedFromRoom, got %v", err)
+	}
+	if _, err := messages.SendMessage(room.ID, "user3", "hi"); !errors.Is(err, ErrBannedFromRoom) {
+		t.Errorf("Expected ErrBannedFromRoom on send, got %v", err)
+	}
+	if rooms, _ := usecase.GetAllRooms("user3"); len(rooms) != 0 {
+		t.Errorf("Expected the room to be hidden from the banned user, got %v", rooms)
+	}
+
+	expired := time.Now().Add(-time.Minute)
+	ban.ExpiresAt = &expired
+	if err := messages.CheckRoomAccess(room.ID, "user3"); err != nil {
+		t.Errorf("Expected an expired ban to be ignored, got %v", err)
+	}
+
+	if _, err := usecase.SetRole(room.ID, "user1", "user2", domain.RoleMember); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := usecase.Ban(room.ID, "user2", "user3", 0); !errors.Is(err, ErrNotRoomModerator) {
+		t.Errorf("Expected a demoted moderator to lose their powers, got %v", err)
+	}
+}
+
+func TestRoomUsecase_ReadMarkers(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	membershipRepo := NewMockMembershipRepository()
+	sanctionRepo := NewMockSanctionRepository()
+	messageRepo := NewMockMessageRepository()
+	usecase := NewRoomUsecase(roomRepo, userRepo, membershipRepo, sanctionRepo, messageRepo, NewMockReadMarkerRepository())
+	messages := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), membershipRepo, sanctionRepo, NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+
+	room, err := usecase.CreateRoom("user1", "General", false)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	secret, err := usecase.CreateRoom("user1", "Secret", true)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+
+	for _, content := range []string{"one", "two", "three"} {
+		if _, err := messages.SendMessage(room.ID, "user1", content); err != nil {
+			t.Fatalf("Failed to send message: %v", err)
+		}
+	}
+	if _, err := messages.SendMessage(room.ID, "user2", "mine"); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	unread := func(userID string) int {
+		t.Helper()
+		rooms, err := usecase.GetAllRooms(userID)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, listed := range rooms {
+			if listed.ID == room.ID {
+				return listed.UnreadCount
+			}
+		}
+		t.Fatalf("Expected %s in the listing", room.Name)
+		return 0
+	}
+
+	if got := unread("user2"); got != 3 {
+		t.Errorf("Expected 3 unread messages not counting bob's own, got %d", got)
+	}
+
+	marker, err := usecase.MarkRead(room.ID, "user2", 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if marker.LastReadSeq != 2 {
+		t.Errorf("Expected marker at seq 2, got %d", marker.LastReadSeq)
+	}
+	if got := unread("user2"); got != 1 {
+		t.Errorf("Expected 1 unread message, got %d", got)
+	}
+
+	if marker, _ := usecase.MarkRead(room.ID, "user2", 1); marker == nil || marker.LastReadSeq != 2 {
+		t.Errorf("Expected the marker not to move back, got %+v", marker)
+	}
+	if marker, _ := usecase.MarkRead(room.ID, "user2", 0); marker == nil || marker.LastReadSeq != 4 {
+		t.Errorf("Expected seq 0 to mark the newest message read, got %+v", marker)
+	}
+	if got := unread("user2"); got != 0 {
+		t.Errorf("Expected no unread messages, got %d", got)
+	}
+	if got := unread("user1"); got != 1 {
+		t.Errorf("Expected alice's count to be unaffected, got %d", got)
+	}
+
+	if _, err := usecase.MarkRead(secret.ID, "user2", 0); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied for a private room, got %v", err)
+	}
+	if _, err := usecase.MarkRead(room.ID, "user2", -1); err == nil {
+		t.Error("Expected error for a negative seq, got nil")
+	}
+}
+
+func TestRoomUsecase_TopicAndPins(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	membershipRepo := NewMockMembershipRepository()
+	sanctionRepo := NewMockSanctionRepository()
+	messageRepo := NewMockMessageRepository()
+	usecase := NewRoomUsecase(roomRepo, userRepo, membershipRepo, sanctionRepo, messageRepo, NewMockReadMarkerRepository())
+	messages := NewMessageUsecase(messageRepo, userRepo, roomRepo, NewMockReactionRepository(), membershipRepo, sanctionRepo, NewMockAttachmentRepository(), NewMockMentionRepository(), NewMockBlobStorage(), DefaultAttachmentLimits())
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+
+	room, err := usecase.CreateRoom("user1", "General", false)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	other, err := usecase.CreateRoom("user1", "Other", false)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+
+	updated, err := usecase.SetTopic(room.ID, "user1", "  Release planning  ")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updated.Topic != "Release planning" {
+		t.Errorf("Expected trimmed topic, got %q", updated.Topic)
+	}
+	if _, err := usecase.SetTopic(room.ID, "user2", "mine now"); !errors.Is(err, ErrNotRoomEditor) {
+		t.Errorf("Expected ErrNotRoomEditor for a member, got %v", err)
+	}
+	if _, err := usecase.SetTopic(room.ID, "user1", strings.Repeat("x", maxTopicLength+1)); err == nil {
+		t.Error("Expected error for a long topic, got nil")
+	}
+
+	first, _ := messages.SendMessage(room.ID, "user2", "first")
+	second, _ := messages.SendMessage(room.ID, "user2", "second")
+	elsewhere, _ := messages.SendMessage(other.ID, "user1", "elsewhere")
+
+	for _, message := range []*domain.Message{second, first} {
+		if _, _, err := usecase.PinMessage(room.ID, "user1", message.ID); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if _, _, err := usecase.PinMessage(room.ID, "user1", first.ID); err == nil {
+		t.Error("Expected error pinning twice, got nil")
+	}
+	if _, _, err := usecase.PinMessage(room.ID, "user1", elsewhere.ID); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound for a message of another room, got %v", err)
+	}
+	if _, _, err := usecase.PinMessage(room.ID, "user2", first.ID); !errors.Is(err, ErrNotRoomEditor) {
+		t.Errorf("Expected ErrNotRoomEditor for a member, got %v", err)
+	}
+
+	pinned, err := usecase.GetPinnedMessages(room.ID, "user2")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(pinned) != 2 || pinned[0].ID != second.ID || pinned[1].ID != first.ID {
+		t.Errorf("Expected pins in the order pinned, got %+v", pinned)
+	}
+
+	if _, err := messages.DeleteMessage(second.ID, "user2"); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+	if pinned, _ := usecase.GetPinnedMessages(room.ID, "user2"); len(pinned) != 1 || pinned[0].ID != first.ID {
+		t.Errorf("Expected deleted messages left out, got %+v", pinned)
+	}
+
+	updated, _, err = usecase.UnpinMessage(room.ID, "user1", second.ID)
+	if err != nil {
+		t.Fatalf("Expected no error unpinning a deleted message, got %v", err)
+	}
+	if len(updated.PinnedMessageIDs) != 1 || updated.PinnedMessageIDs[0] != first.ID {
+		t.Errorf("Expected only the first message pinned, got %v", updated.PinnedMessageIDs)
+	}
+	if _, _, err := usecase.UnpinMessage(room.ID, "user1", second.ID); err == nil {
+		t.Error("Expected error unpinning a message that is not pinned, got nil")
+	}
+
+	// Direct rooms have no moderators: both participants may edit them.
+	direct, err := usecase.OpenDirectRoom("user1", "user2")
+	if err != nil {
+		t.Fatalf("Failed to open direct room: %v", err)
+	}
+	if _, err := usecase.SetTopic(direct.ID, "user2", "weekend plans"); err != nil {
+		t.Errorf("Expected a participant to set the topic, got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package usecase
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"gochat/internal/domain"
+)
+
+const (
+	maxSearchResults = 100
+	// snippetLength is the most runes of a message a search hit shows,
+	// starting a little before the first matched word.
+	snippetLength  = 120
+	snippetContext = 30
+)
+
+// SearchFilter narrows a search. Zero values leave a filter out; Author is a
+// username.
+type SearchFilter struct {
+	RoomID string
+	Author string
+	Since  time.Time
+	Until  time.Time
+}
+
+type SearchUsecase struct {
+	index       domain.SearchIndex
+	messageRepo domain.MessageRepository
+	userRepo    domain.UserRepository
+	roomRepo    domain.RoomRepository
+	access      roomAccess
+}
+
+func NewSearchUsecase(
+	index domain.SearchIndex,
+	messageRepo domain.MessageRepository,
+	userRepo domain.UserRepository,
+	roomRepo domain.RoomRepository,
+	membershipRepo domain.MembershipRepository,
+	sanctionRepo domain.SanctionRepository,
+) *SearchUsecase {
+	return &SearchUsecase{
+		index:       index,
+		messageRepo: messageRepo,
+		userRepo:    userRepo,
+		roomRepo:    roomRepo,
+		access: roomAccess{
+			roomRepo:       roomRepo,
+			membershipRepo: membershipRepo,
+			sanctionRepo:   sanctionRepo,
+		},
+	}
+}
+
+// Search finds the messages containing every word of text in the rooms
+// userID can read, best matches first.
+func (uc *SearchUsecase) Search(userID, text string, filter SearchFilter, limit, offset int) ([]*domain.SearchHit, error) {
+	terms := uniqueTerms(text)
+	if len(terms) == 0 {
+		return nil, errors.New("search text must contain at least one word")
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Since.Before(filter.Until) {
+		return nil, errors.New("since must be before until")
+	}
+	if limit > maxSearchResults {
+		limit = maxSearchResults
+	}
+
+	roomIDs, err := uc.searchableRooms(userID, filter.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := domain.SearchQuery{
+		Terms:   terms,
+		RoomIDs: roomIDs,
+		Since:   filter.Since,
+		Until:   filter.Until,
+		Limit:   limit,
+		Offset:  offset,
+	}
+	if filter.Author != "" {
+		author, err := uc.userRepo.GetByUsername(filter.Author)
+		if err != nil {
+			return nil, errors.New("user not found")
+		}
+		query.UserID = author.ID
+	}
+
+	results, err := uc.index.Search(query)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]*domain.SearchHit, 0, len(results))
+	for _, result := range results {
+		message, err := uc.messageRepo.GetByID(result.MessageID)
+		if err != nil || message.DeletedAt != nil {
+			// The index may briefly lag behind a deletion.
+			continue
+		}
+
+		hits = append(hits, &domain.SearchHit{
+			Message: message,
+			Score:   result.Score,
+			Snippet: snippet(message.Content, terms),
+		})
+	}
+
+	return hits, nil
+}
+
+// searchableRooms returns roomID if userID may read it, or every room they
+// may read if roomID is empty.
+func (uc *SearchUsecase) searchableRooms(userID, roomID string) ([]string, error) {
+	if roomID != "" {
+		if _, err := uc.access.check(roomID, userID); err != nil {
+			return nil, err
+		}
+		return []string{roomID}, nil
+	}
+
+	rooms, err := uc.roomRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(rooms))
+	for _, room := range rooms {
+		if _, err := uc.access.check(room.ID, userID); err == nil {
+			ids = append(ids, room.ID)
+		}
+	}
+	return ids, nil
+}
+
+func uniqueTerms(text string) []string {
+	seen := make(map[string]bool)
+	terms := make([]string, 0)
+	for _, term := range domain.SearchTerms(text) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// snippet cuts content down to snippetLength runes around the first matched
+// word and wraps every matched word in "**".
+func snippet(content string, terms []string) string {
+	match := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		match[term] = true
+	}
+
+	runes := []rune(content)
+	isWordRune := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+	// Find the matched words as [start, end) rune ranges.
+	var matched [][2]int
+	for start := 0; start < len(runes); {
+		if !isWordRune(runes[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		if match[strings.ToLower(string(runes[start:end]))] {
+			matched = append(matched, [2]int{start, end})
+		}
+		start = end
+	}
+
+	from, to := 0, len(runes)
+	if len(runes) > snippetLength {
+		if len(matched) > 0 && matched[0][0] > snippetContext {
+			from = matched[0][0] - snippetContext
+			// Start at a word boundary rather than in the middle of a word.
+			for from > 0 && isWordRune(runes[from-1]) && isWordRune(runes[from]) {
+				from++
+			}
+			for unicode.IsSpace(runes[from]) {
+				from++
+			}
+		}
+		to = from + snippetLength
+		if to >= len(runes) {
+			to = len(runes)
+		} else {
+			// End at a word boundary too, dropping the space before it.
+			for to > from && isWordRune(runes[to-1]) && isWordRune(runes[to]) {
+				to--
+			}
+			for to > from && unicode.IsSpace(runes[to-1]) {
+				to--
+			}
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, m := range matched {
+		if m[1] <= from || m[0] >= to {
+			continue
+		}
+		start, end := m[0], m[1]
+		if start < from {
+			start = from
+		}
+		if end > to {
+			end = to
+		}
+		b.WriteString(string(runes[pos:start]))
+		b.WriteString("**" + string(runes[start:end]) + "**")
+		pos = end
+	}
+	b.WriteString(string(runes[pos:to]))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,197 @@
+package usecase
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gochat/internal/domain"
+)
+
+// MockSearchIndex scans every indexed message and scores it by how often
+// the terms occur in it.
+type MockSearchIndex struct {
+	messages map[string]*domain.Message
+}
+
+func NewMockSearchIndex() *MockSearchIndex {
+	return &MockSearchIndex{
+		messages: make(map[string]*domain.Message),
+	}
+}
+
+func (m *MockSearchIndex) Index(message *domain.Message) error {
+	m.messages[message.ID] = message
+	return nil
+}
+
+func (m *MockSearchIndex) Remove(messageID string) error {
+	delete(m.messages, messageID)
+	return nil
+}
+
+func (m *MockSearchIndex) Search(query domain.SearchQuery) ([]domain.SearchResult, error) {
+	rooms := make(map[string]bool)
+	for _, id := range query.RoomIDs {
+		rooms[id] = true
+	}
+
+	results := make([]domain.SearchResult, 0)
+	for id, message := range m.messages {
+		if !rooms[message.RoomID] || (query.UserID != "" && message.UserID != query.UserID) {
+			continue
+		}
+		if (!query.Since.IsZero() && message.CreatedAt.Before(query.Since)) || (!query.Until.IsZero() && !message.CreatedAt.Before(query.Until)) {
+			continue
+		}
+
+		words := " " + strings.Join(domain.SearchTerms(message.Content), " ") + " "
+		score := 0
+		for _, term := range query.Terms {
+			n := strings.Count(words, " "+term+" ")
+			if n == 0 {
+				score = 0
+				break
+			}
+			score += n
+		}
+		if score > 0 {
+			results = append(results, domain.SearchResult{MessageID: id, Score: float64(score)})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if query.Offset > len(results) {
+		return []domain.SearchResult{}, nil
+	}
+	results = results[query.Offset:]
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	return results, nil
+}
+
+func TestSearchUsecase_Search(t *testing.T) {
+	userRepo := NewMockUserRepository()
+	roomRepo := NewMockRoomRepository()
+	membershipRepo := NewMockMembershipRepository()
+	sanctionRepo := NewMockSanctionRepository()
+	messageRepo := NewMockMessageRepository()
+	index := NewMockSearchIndex()
+	rooms := NewRoomUsecase(roomRepo, userRepo, membershipRepo, sanctionRepo, messageRepo, NewMockReadMarkerRepository())
+	search := NewSearchUsecase(index, messageRepo, userRepo, roomRepo, membershipRepo, sanctionRepo)
+
+	userRepo.Create(&domain.User{ID: "user1", Username: "alice"})
+	userRepo.Create(&domain.User{ID: "user2", Username: "bob"})
+
+	public, err := rooms.CreateRoom("user1", "General", false)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	secret, err := rooms.CreateRoom("user1", "Secret", true)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+
+	start := time.Now()
+	for i, m := range []struct{ id, roomID, userID, content string }{
+		{"m1", public.ID, "user1", "deploy the gopher"},
+		{"m2", public.ID, "user2", "Gopher gopher gopher!"},
+		{"m3", secret.ID, "user1", "secret gopher plans"},
+		{"m4", public.ID, "user1", "unrelated"},
+	} {
+		message := &domain.Message{ID: m.id, RoomID: m.roomID, UserID: m.userID, Content: m.content, CreatedAt: start.Add(time.Duration(i) * time.Minute)}
+		messageRepo.Create(message)
+		index.Index(message)
+	}
+
+	ids := func(hits []*domain.SearchHit) []string {
+		result := make([]string, len(hits))
+		for i, hit := range hits {
+			result[i] = hit.Message.ID
+		}
+		return result
+	}
+
+	hits, err := search.Search("user2", "GOPHER", SearchFilter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := strings.Join(ids(hits), ","); got != "m2,m1" {
+		t.Errorf("Expected bob to find m2 then m1 but not the private room, got %s", got)
+	}
+	if hits[0].Snippet != "**Gopher** **gopher** **gopher**!" {
+		t.Errorf("Expected matched words to be highlighted, got %q", hits[0].Snippet)
+	}
+
+	hits, err = search.Search("user1", "gopher", SearchFilter{Author: "alice"}, 10, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := strings.Join(ids(hits), ","); got != "m1,m3" && got != "m3,m1" {
+		t.Errorf("Expected alice's messages in both rooms, got %s", got)
+	}
+
+	hits, _ = search.Search("user1", "gopher", SearchFilter{RoomID: secret.ID}, 10, 0)
+	if got := strings.Join(ids(hits), ","); got != "m3" {
+		t.Errorf("Expected only the private room, got %s", got)
+	}
+	hits, _ = search.Search("user1", "gopher", SearchFilter{Since: start.Add(time.Minute), Until: start.Add(2 * time.Minute)}, 10, 0)
+	if got := strings.Join(ids(hits), ","); got != "m2" {
+		t.Errorf("Expected only the message in the time range, got %s", got)
+	}
+
+	deletedAt := time.Now()
+	messageRepo.Update(&domain.Message{ID: "m2", DeletedAt: &deletedAt})
+	hits, _ = search.Search("user2", "gopher", SearchFilter{}, 10, 0)
+	if got := strings.Join(ids(hits), ","); got != "m1" {
+		t.Errorf("Expected deleted messages to be left out, got %s", got)
+	}
+
+	if _, err := search.Search("user2", "gopher", SearchFilter{RoomID: secret.ID}, 10, 0); !errors.Is(err, ErrRoomAccessDenied) {
+		t.Errorf("Expected ErrRoomAccessDenied, got %v", err)
+	}
+	if _, err := search.Search("user1", " ?! ", SearchFilter{}, 10, 0); err == nil {
+		t.Error("Expected error for a query without words, got nil")
+	}
+	if _, err := search.Search("user1", "gopher", SearchFilter{Author: "nobody"}, 10, 0); err == nil {
+		t.Error("Expected error for an unknown author, got nil")
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		terms   []string
+		want    string
+	}{
+		{"WholeWordsOnly", "Find the Needle, needles stay", []string{"needle"}, "Find the **Needle**, needles stay"},
+		{"Unicode", "Привет, мир", []string{"мир"}, "Привет, **мир**"},
+		{"NoMatch", "nothing here", []string{"needle"}, "nothing here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := snippet(tt.content, tt.terms); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("Long", func(t *testing.T) {
+		long := strings.Repeat("filler ", 30) + "the needle is here" + strings.Repeat(" more", 30)
+
+		got := snippet(long, []string{"needle"})
+		if !strings.HasPrefix(got, "…filler") || !strings.HasSuffix(got, "more…") {
+			t.Errorf("Expected a cut on word boundaries at both ends, got %q", got)
+		}
+		if !strings.Contains(got, "the **needle** is here") {
+			t.Errorf("Expected the match to be highlighted, got %q", got)
+		}
+		if n := len([]rune(strings.ReplaceAll(got, "**", ""))); n > snippetLength+2 {
+			t.Errorf("Expected at most %d runes and two ellipses, got %d", snippetLength, n)
+		}
+	})
+}
@@ -2,12 +2,20 @@ package usecase
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"gochat/internal/domain"
+	"golang.org/x/crypto/bcrypt"
 )
 
+const minPasswordLength = 6
+
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("gochat-dummy-password"), bcrypt.DefaultCost)
+
 type UserUsecase struct {
 	userRepo domain.UserRepository
 }
@@ -18,19 +26,29 @@ func NewUserUsecase(userRepo domain.UserRepository) *UserUsecase {
 	}
 }
 
-func (uc *UserUsecase) RegisterUser(username string) (*domain.User, error) {
+func (uc *UserUsecase) RegisterUser(username, password string) (*domain.User, error) {
 	if username == "" {
 		return nil, errors.New("username cannot be empty")
 	}
 
+	if len(password) < minPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+
 	if uc.userRepo.Exists(username) {
 		return nil, errors.New("username already exists")
 	}
 
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
 	user := &domain.User{
-		ID:        uuid.New().String(),
-		Username:  username,
-		CreatedAt: time.Now(),
+		ID:           uuid.New().String(),
+		Username:     username,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now(),
 	}
 
 	if err := uc.userRepo.Create(user); err != nil {
@@ -40,6 +58,26 @@ func (uc *UserUsecase) RegisterUser(username string) (*domain.User, error) {
 	return user, nil
 }
 
+func (uc *UserUsecase) Login(username, password string) (*domain.User, error) {
+	user, err := uc.userRepo.GetByUsername(username)
+	if err != nil {
+		// Still spend the time of a hash comparison so that response timing
+		// does not reveal which usernames exist.
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	if user.PasswordHash == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
 func (uc *UserUsecase) GetUser(id string) (*domain.User, error) {
 	return uc.userRepo.GetByID(id)
 }
@@ -53,7 +53,7 @@ func TestUserUsecase_RegisterUser(t *testing.T) {
 	repo := NewMockUserRepository()
 	usecase := NewUserUsecase(repo)
 
-	user, err := usecase.RegisterUser("testuser")
+	user, err := usecase.RegisterUser("testuser", "secret123")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -66,22 +66,69 @@ func TestUserUsecase_RegisterUser(t *testing.T) {
 		t.Error("Expected user ID to be set")
 	}
 
-	_, err = usecase.RegisterUser("testuser")
+	_, err = usecase.RegisterUser("testuser", "secret123")
 	if err == nil {
 		t.Fatal("Expected error for duplicate username, got nil")
 	}
 
-	_, err = usecase.RegisterUser("")
+	_, err = usecase.RegisterUser("", "secret123")
 	if err == nil {
 		t.Fatal("Expected error for empty username, got nil")
 	}
+
+	_, err = usecase.RegisterUser("otheruser", "short")
+	if err == nil {
+		t.Fatal("Expected error for short password, got nil")
+	}
+}
+
+func TestUserUsecase_RegisterUser_HashesPassword(t *testing.T) {
+	repo := NewMockUserRepository()
+	usecase := NewUserUsecase(repo)
+
+	user, err := usecase.RegisterUser("testuser", "secret123")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	stored, _ := repo.GetByID(user.ID)
+	if stored.PasswordHash == "" || stored.PasswordHash == "secret123" {
+		t.Errorf("Expected password to be stored hashed, got %q", stored.PasswordHash)
+	}
+}
+
+func TestUserUsecase_Login(t *testing.T) {
+	repo := NewMockUserRepository()
+	usecase := NewUserUsecase(repo)
+
+	user, err := usecase.RegisterUser("testuser", "secret123")
+	if err != nil {
+		t.Fatalf("Failed to register user: %v", err)
+	}
+
+	loggedIn, err := usecase.Login("testuser", "secret123")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if loggedIn.ID != user.ID {
+		t.Errorf("Expected ID %s, got %s", user.ID, loggedIn.ID)
+	}
+
+	if _, err := usecase.Login("testuser", "wrongpass"); err != ErrInvalidCredentials {
+		t.Errorf("Expected ErrInvalidCredentials for wrong password, got %v", err)
+	}
+
+	if _, err := usecase.Login("nobody", "secret123"); err != ErrInvalidCredentials {
+		t.Errorf("Expected ErrInvalidCredentials for unknown user, got %v", err)
+	}
 }
 
 func TestUserUsecase_GetUser(t *testing.T) {
 	repo := NewMockUserRepository()
 	usecase := NewUserUsecase(repo)
 
-	user, _ := usecase.RegisterUser("testuser")
+	user, _ := usecase.RegisterUser("testuser", "secret123")
 
 	retrieved, err := usecase.GetUser(user.ID)
 	if err != nil {
@@ -97,7 +144,7 @@ func TestUserUsecase_GetUserByUsername(t *testing.T) {
 	repo := NewMockUserRepository()
 	usecase := NewUserUsecase(repo)
 
-	user, _ := usecase.RegisterUser("testuser")
+	user, _ := usecase.RegisterUser("testuser", "secret123")
 
 	retrieved, err := usecase.GetUserByUsername("testuser")
 	if err != nil {